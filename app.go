@@ -9,12 +9,12 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"regexp"
 	rntm "runtime"
 	"strings"
 	"sync"
 	"time"
 
+	"sql_script_maker/schema"
 	"sql_script_maker/sqlai"
 	sqlaiModels "sql_script_maker/sqlai/models"
 
@@ -26,7 +26,9 @@ import (
 
 // App struct
 type App struct {
-	ctx context.Context
+	ctx           context.Context
+	connections   *connectionRegistry
+	sharedLibrary *sharedLibraryWatcher
 }
 
 // Variable struct
@@ -41,26 +43,45 @@ type Query struct {
 	Title       string
 	Query       string
 	Description string
+	FolderID    *int
+	Tags        []string
 	CreatedAt   *string
 	UpdatedAt   *string
 	DeletedAt   *string
 }
 
 type DatabaseConnection struct {
-	ID        *int
-	Username  string
-	Password  string
-	Host      string
-	Port      int
-	Database  string
-	CreatedAt *string
-	UpdatedAt *string
-	DeletedAt *string
+	ID          *int
+	Username    string
+	Password    string
+	Host        string
+	Port        int
+	Database    string
+	TLSMode     string
+	TLSCAPath   string
+	TLSCertPath string
+	TLSKeyPath  string
+	Params      map[string]string
+	// SSH jump host the database is reached through, when enabled
+	SSHEnabled        bool
+	SSHHost           string
+	SSHPort           int
+	SSHUser           string
+	SSHKeyPath        string
+	SSHKeyPassphrase  string
+	SSHUseAgent       bool
+	SSHKnownHostsPath string
+	CreatedAt         *string
+	UpdatedAt         *string
+	DeletedAt         *string
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
-	return &App{}
+	return &App{
+		connections:   newConnectionRegistry(defaultPoolSettings),
+		sharedLibrary: newSharedLibraryWatcher(sharedLibraryPollInterval),
+	}
 }
 
 // startup is called when the app starts. The context is saved
@@ -68,7 +89,27 @@ func NewApp() *App {
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 
-	createSqliteTables()
+	err := storage.Prepare(legacyDatabaseCandidates())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrateSqliteDatabase()
+
+	purgeExpiredQueriesOnOpen()
+
+	a.connections.Start()
+
+	a.sharedLibrary.Start(func(result SharedLibrarySyncResult) {
+		runtime.EventsEmit(a.ctx, sharedLibrarySyncedEvent, result)
+	})
+}
+
+// shutdown is called when the app is closing. Pooled database
+// connections are released here
+func (a *App) shutdown(ctx context.Context) {
+	a.sharedLibrary.Close()
+	a.connections.Close()
 }
 
 func (a *App) getSQLAssistant(structureJSON string) *sqlai.SQLAssistant {
@@ -239,35 +280,19 @@ func processBatch(content *[]map[string]string, batch [][]string, headers []stri
 	}
 }
 
-func (a *App) MakeBindedSQL(query string, data []map[string]interface{}, variables []Variable, minify bool) string {
-	var result strings.Builder
-
-	re := regexp.MustCompile(`{{ \w+ }}`)
-
-	for index, row := range data {
-		modifiedQuery := re.ReplaceAllStringFunc(query, func(match string) string {
-			for _, variable := range variables {
-				if match == fmt.Sprintf("{{ %s }}", variable.Value) {
-					if value, ok := row[variable.Field]; ok {
-						return fmt.Sprintf("%v", value)
-					}
-				}
-			}
-			return match
-		})
-
-		result.WriteString(modifiedQuery)
-
-		if index != len(data)-1 {
-			result.WriteString("\n")
-		}
+// MakeBindedSQL binds the query to every row of data. The query may use
+// {% if %}, {% else %}, {% group %} and {% each %} blocks
+func (a *App) MakeBindedSQL(query string, data []map[string]interface{}, variables []Variable, minify bool) (string, error) {
+	result, err := renderTemplate(query, data, variables)
+	if err != nil {
+		return "", err
 	}
 
 	if minify {
-		return strings.ReplaceAll(result.String(), "\n", " ")
+		return strings.ReplaceAll(result, "\n", " "), nil
 	}
 
-	return result.String()
+	return result, nil
 }
 
 func (a *App) CreateSQLFile(data string) (string, error) {
@@ -314,120 +339,97 @@ func (a *App) InsertQueryInDatabase(data Query) error {
 	tx, err := db.Begin()
 
 	if err != nil {
-		fmt.Println(err.Error())
+		return err
 	}
 
-	insertQuery := `INSERT INTO queries(title, query, description) VALUES(?, ?, ?)`
-
-	stmt, err := tx.Prepare(insertQuery)
+	defer tx.Rollback()
 
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-
-	defer stmt.Close()
+	insertQuery := `INSERT INTO queries(title, query, description, folder_id, referenced_tables) VALUES(?, ?, ?, ?, ?)`
 
-	_, err = stmt.Exec(data.Title, data.Query, data.Description)
+	result, err := tx.Exec(insertQuery, data.Title, data.Query, data.Description, data.FolderID, referencedTablesColumn(data.Query))
 
 	if err != nil {
-		fmt.Println(err.Error())
+		return err
 	}
 
-	err = tx.Commit()
+	id, err := result.LastInsertId()
 
 	if err != nil {
-		fmt.Println(err.Error())
-	}
-
-	return nil
-}
-
-func (a *App) GetQueriesList(withTrashed bool) ([]Query, error) {
-	db := openSqliteConnection()
-	defer db.Close()
-
-	var queries []Query = make([]Query, 0)
-
-	var selectQuery string
-
-	if withTrashed {
-		selectQuery = `SELECT * FROM queries`
-	} else {
-		selectQuery = `SELECT * FROM queries WHERE deleted_at IS NULL`
+		return err
 	}
 
-	rows, err := db.Query(selectQuery)
+	err = storeQueryRevision(tx, int(id), "")
 
 	if err != nil {
-		fmt.Println(err.Error())
+		return err
 	}
 
-	defer rows.Close()
-
-	for rows.Next() {
-		var query Query
-
-		err = rows.Scan(&query.ID, &query.Title, &query.Query, &query.Description, &query.CreatedAt, &query.UpdatedAt, &query.DeletedAt)
+	if len(data.Tags) > 0 {
+		err = setQueryTags(tx, int(id), data.Tags)
 
 		if err != nil {
-			fmt.Println(err.Error())
-			continue
+			return err
 		}
-
-		queries = append(queries, query)
 	}
 
-	err = rows.Err()
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return queries, nil
+	return tx.Commit()
 }
 
+// DeleteQuery moves a query to the trash, from where it can be restored
+// until the trash retention purges it
 func (a *App) DeleteQuery(id int) error {
 	db := openSqliteConnection()
 
 	defer db.Close()
 
-	deleteQuery := `UPDATE queries SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?`
-
-	stmt, err := db.Prepare(deleteQuery)
-
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-
-	_, err = stmt.Exec(id)
+	result, err := db.Exec(`UPDATE queries SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL`, id)
 
 	if err != nil {
-		fmt.Println(err.Error())
+		return err
 	}
 
-	return nil
+	return expectAffected(result, "query not found")
 }
 
+// UpdateQuery saves new contents for a query and records them as a revision
 func (a *App) UpdateQuery(id int, data Query) error {
+	return a.UpdateQueryWithNote(id, data, "")
+}
+
+// UpdateQueryWithNote is UpdateQuery with a note describing the change
+func (a *App) UpdateQueryWithNote(id int, data Query, note string) error {
 	db := openSqliteConnection()
 
 	defer db.Close()
 
-	updateQuery := `UPDATE queries SET query = ?, description = ? WHERE id = ?`
+	return updateQuery(db, id, data, note)
+}
+
+const databaseConnectionColumns = `id, username, password, host, port, database, tls_mode, tls_ca_path, tls_cert_path, tls_key_path, params, ssh_enabled, ssh_host, ssh_port, ssh_user, ssh_key_path, ssh_key_passphrase, ssh_use_agent, ssh_known_hosts_path, created_at, updated_at, deleted_at`
 
-	stmt, err := db.Prepare(updateQuery)
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDatabaseConnection(row rowScanner) (DatabaseConnection, error) {
+	var databaseConnection DatabaseConnection
+	var params sql.NullString
+
+	err := row.Scan(&databaseConnection.ID, &databaseConnection.Username, &databaseConnection.Password, &databaseConnection.Host, &databaseConnection.Port, &databaseConnection.Database, &databaseConnection.TLSMode, &databaseConnection.TLSCAPath, &databaseConnection.TLSCertPath, &databaseConnection.TLSKeyPath, &params, &databaseConnection.SSHEnabled, &databaseConnection.SSHHost, &databaseConnection.SSHPort, &databaseConnection.SSHUser, &databaseConnection.SSHKeyPath, &databaseConnection.SSHKeyPassphrase, &databaseConnection.SSHUseAgent, &databaseConnection.SSHKnownHostsPath, &databaseConnection.CreatedAt, &databaseConnection.UpdatedAt, &databaseConnection.DeletedAt)
 
 	if err != nil {
-		fmt.Println(err.Error())
+		return DatabaseConnection{}, err
 	}
 
-	_, err = stmt.Exec(data.Query, data.Description, id)
+	if params.Valid && params.String != "" {
+		err = json.Unmarshal([]byte(params.String), &databaseConnection.Params)
 
-	if err != nil {
-		fmt.Println(err.Error())
+		if err != nil {
+			return DatabaseConnection{}, fmt.Errorf("invalid stored DSN parameters: %w", err)
+		}
 	}
 
-	return nil
+	return databaseConnection, nil
 }
 
 func (a *App) GetDatabaseConnection() (DatabaseConnection, error) {
@@ -435,94 +437,64 @@ func (a *App) GetDatabaseConnection() (DatabaseConnection, error) {
 
 	defer db.Close()
 
-	databaseConnectionQuery := `SELECT * FROM database_connections LIMIT 1`
+	databaseConnectionQuery := `SELECT ` + databaseConnectionColumns + ` FROM database_connections LIMIT 1`
 
-	rows, err := db.Query(databaseConnectionQuery)
+	databaseConnection, err := scanDatabaseConnection(db.QueryRow(databaseConnectionQuery))
 
-	if err != nil {
-		return DatabaseConnection{}, err
+	if err == sql.ErrNoRows {
+		return DatabaseConnection{}, nil
 	}
 
-	defer rows.Close()
-
-	var databaseConnection DatabaseConnection
-
-	for rows.Next() {
-		err = rows.Scan(&databaseConnection.ID, &databaseConnection.Username, &databaseConnection.Password, &databaseConnection.Host, &databaseConnection.Port, &databaseConnection.Database, &databaseConnection.CreatedAt, &databaseConnection.UpdatedAt, &databaseConnection.DeletedAt)
-
-		if err != nil {
-			return DatabaseConnection{}, err
-		}
-	}
+	return databaseConnection, err
+}
 
-	err = rows.Err()
+func (a *App) CreateOrUpdateDatabaseConnection(input DatabaseConnection) (DatabaseConnection, error) {
+	err := a.ValidateDatabaseConnection(input)
 
 	if err != nil {
 		return DatabaseConnection{}, err
 	}
 
-	return databaseConnection, nil
-}
-
-func (a *App) CreateOrUpdateDatabaseConnection(input DatabaseConnection) (DatabaseConnection, error) {
-	db := openSqliteConnection()
-
-	defer db.Close()
-
-	databaseConnectionQuery := `SELECT * FROM database_connections LIMIT 1`
-
-	rows, err := db.Query(databaseConnectionQuery)
+	params, err := json.Marshal(input.Params)
 
 	if err != nil {
 		return DatabaseConnection{}, err
 	}
 
-	defer rows.Close()
-
-	var databaseConnection DatabaseConnection
+	db := openSqliteConnection()
 
-	for rows.Next() {
-		err = rows.Scan(&databaseConnection.ID, &databaseConnection.Username, &databaseConnection.Password, &databaseConnection.Host, &databaseConnection.Port, &databaseConnection.Database, &databaseConnection.CreatedAt, &databaseConnection.UpdatedAt, &databaseConnection.DeletedAt)
+	defer db.Close()
 
-		if err != nil {
-			return DatabaseConnection{}, err
-		}
-	}
+	databaseConnectionQuery := `SELECT ` + databaseConnectionColumns + ` FROM database_connections LIMIT 1`
 
-	err = rows.Err()
+	databaseConnection, err := scanDatabaseConnection(db.QueryRow(databaseConnectionQuery))
 
-	if err != nil {
+	if err != nil && err != sql.ErrNoRows {
 		return DatabaseConnection{}, err
 	}
 
 	if input.ID != nil {
-		updateQuery := `UPDATE database_connections SET username = ?, password = ?, database = ?, host = ?, port = ? WHERE id = ?`
+		updateQuery := `UPDATE database_connections SET username = ?, password = ?, database = ?, host = ?, port = ?, tls_mode = ?, tls_ca_path = ?, tls_cert_path = ?, tls_key_path = ?, params = ?, ssh_enabled = ?, ssh_host = ?, ssh_port = ?, ssh_user = ?, ssh_key_path = ?, ssh_key_passphrase = ?, ssh_use_agent = ?, ssh_known_hosts_path = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
 
-		stmt, err := db.Prepare(updateQuery)
+		_, err = db.Exec(updateQuery, input.Username, input.Password, input.Database, input.Host, input.Port, input.TLSMode, input.TLSCAPath, input.TLSCertPath, input.TLSKeyPath, string(params), input.SSHEnabled, input.SSHHost, input.SSHPort, input.SSHUser, input.SSHKeyPath, input.SSHKeyPassphrase, input.SSHUseAgent, input.SSHKnownHostsPath, *input.ID)
 
 		if err != nil {
-			fmt.Println(err.Error())
-		}
-
-		_, err = stmt.Exec(input.Username, input.Password, input.Database, input.Host, input.Port, *input.ID)
-
-		if err != nil {
-			fmt.Println(err.Error())
+			return DatabaseConnection{}, err
 		}
-
 	} else {
-		insertQuery := `INSERT INTO database_connections(username, password, database, host, port) VALUES(?, ?, ?, ?, ?)`
+		insertQuery := `INSERT INTO database_connections(username, password, database, host, port, tls_mode, tls_ca_path, tls_cert_path, tls_key_path, params, ssh_enabled, ssh_host, ssh_port, ssh_user, ssh_key_path, ssh_key_passphrase, ssh_use_agent, ssh_known_hosts_path) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-		stmt, err := db.Prepare(insertQuery)
+		result, err := db.Exec(insertQuery, input.Username, input.Password, input.Database, input.Host, input.Port, input.TLSMode, input.TLSCAPath, input.TLSCertPath, input.TLSKeyPath, string(params), input.SSHEnabled, input.SSHHost, input.SSHPort, input.SSHUser, input.SSHKeyPath, input.SSHKeyPassphrase, input.SSHUseAgent, input.SSHKnownHostsPath)
 
 		if err != nil {
-			fmt.Println(err.Error())
+			return DatabaseConnection{}, err
 		}
 
-		_, err = stmt.Exec(input.Username, input.Password, input.Database, input.Host, input.Port)
+		id, err := result.LastInsertId()
 
-		if err != nil {
-			fmt.Println(err.Error())
+		if err == nil {
+			insertedID := int(id)
+			databaseConnection.ID = &insertedID
 		}
 	}
 
@@ -531,110 +503,119 @@ func (a *App) CreateOrUpdateDatabaseConnection(input DatabaseConnection) (Databa
 	databaseConnection.Host = input.Host
 	databaseConnection.Port = input.Port
 	databaseConnection.Database = input.Database
+	databaseConnection.TLSMode = input.TLSMode
+	databaseConnection.TLSCAPath = input.TLSCAPath
+	databaseConnection.TLSCertPath = input.TLSCertPath
+	databaseConnection.TLSKeyPath = input.TLSKeyPath
+	databaseConnection.Params = input.Params
+	databaseConnection.SSHEnabled = input.SSHEnabled
+	databaseConnection.SSHHost = input.SSHHost
+	databaseConnection.SSHPort = input.SSHPort
+	databaseConnection.SSHUser = input.SSHUser
+	databaseConnection.SSHKeyPath = input.SSHKeyPath
+	databaseConnection.SSHKeyPassphrase = input.SSHKeyPassphrase
+	databaseConnection.SSHUseAgent = input.SSHUseAgent
+	databaseConnection.SSHKnownHostsPath = input.SSHKnownHostsPath
 
 	return databaseConnection, nil
 }
 
-func (a *App) ImportDatabaseFile() error {
-	selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "Select File",
-		Filters: []runtime.FileFilter{
-			{
-				DisplayName: "Sqlite 3 (*.db)",
-				Pattern:     "*.db",
-			},
-		},
-	})
-
+func (a *App) TestQueryInDatabase(input DatabaseConnection, query string, useTransaction bool) ([]map[string]interface{}, error) {
+	session, err := a.connections.Session(input)
 	if err != nil {
-		return err
-	}
-
-	if selection == "" {
-		return fmt.Errorf("no file selected")
+		return nil, err
 	}
 
-	_, err = os.Stat("database.db")
-
-	if err == nil {
-		err = os.Remove("database.db")
+	ctx := context.Background()
 
+	// Begin transaction if requested
+	if useTransaction {
+		tx, err := session.BeginTx(ctx, nil)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to start transaction: %w", err)
 		}
-	}
-
-	err = os.Rename(selection, "database.db")
+		defer tx.Rollback() // Always rollback to ensure no changes are committed
 
-	if err != nil {
-		return err
+		return runTestQuery(ctx, tx, query)
 	}
 
-	return nil
+	return runTestQuery(ctx, session, query)
 }
 
-func (a *App) ExportDatabaseFile() error {
-	selection, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
-		Title: "Save File",
-		Filters: []runtime.FileFilter{
-			{
-				DisplayName: "Sqlite 3 (*.db)",
-				Pattern:     "*.db",
-			},
-		},
-	})
+func (a *App) TestBatchQueryInDatabase(input DatabaseConnection, queries []string, useTransaction bool) ([][]map[string]interface{}, error) {
+	if len(queries) == 0 {
+		return [][]map[string]interface{}{}, nil
+	}
 
+	session, err := a.connections.Session(input)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if selection == "" {
-		return fmt.Errorf("no file selected")
-	}
+	ctx := context.Background()
 
-	_, err = os.Stat("database.db")
+	var runner queryRunner = session
 
-	if err != nil {
-		return err
+	// Begin transaction if requested
+	if useTransaction {
+		tx, err := session.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start transaction: %w", err)
+		}
+		defer tx.Rollback() // Always rollback to ensure no changes are committed
+
+		runner = tx
 	}
 
-	err = os.Rename("database.db", selection)
+	var results [][]map[string]interface{}
 
-	if err != nil {
-		return err
+	// Execute each query, within the same transaction when one was started
+	for _, query := range queries {
+		result, err := runTestQuery(ctx, runner, query)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
 	}
 
-	return nil
+	return results, nil
 }
 
-func (a *App) TestQueryInDatabase(input DatabaseConnection, query string, useTransaction bool) ([]map[string]interface{}, error) {
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", input.Username, input.Password, input.Host, input.Port, input.Database))
+func (a *App) TestDatabaseConnection(input DatabaseConnection) bool {
+	session, err := a.connections.Session(input)
+
 	if err != nil {
-		return nil, err
+		return false
 	}
-	defer db.Close()
 
-	// Begin transaction if requested
-	var tx *sql.Tx
-	if useTransaction {
-		tx, err = db.Begin()
-		if err != nil {
-			return nil, fmt.Errorf("failed to start transaction: %w", err)
-		}
-		defer tx.Rollback() // Always rollback to ensure no changes are committed
-	}
+	err = session.PingContext(context.Background())
 
-	// Execute query based on whether we're in a transaction
-	var rows *sql.Rows
-	if useTransaction {
-		rows, err = tx.Query(query)
-	} else {
-		rows, err = db.Query(query)
+	if err != nil {
+		// Drop the pool so a fixed profile gets a fresh start next time
+		a.connections.Evict(input)
+		return false
 	}
 
+	return true
+}
+
+// queryRunner is satisfied by pools, sticky connections and transactions
+type queryRunner interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// runTestQuery executes the query and collects every row as a column map
+func runTestQuery(ctx context.Context, runner queryRunner, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := runner.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+
+	return collectRows(rows)
+}
+
+// collectRows reads every row as a column map and closes rows
+func collectRows(rows *sql.Rows) ([]map[string]interface{}, error) {
 	defer rows.Close()
 
 	columns, err := rows.Columns()
@@ -670,108 +651,16 @@ func (a *App) TestQueryInDatabase(input DatabaseConnection, query string, useTra
 		result = append(result, row)
 	}
 
-	return result, nil
-}
-
-func (a *App) TestBatchQueryInDatabase(input DatabaseConnection, queries []string, useTransaction bool) ([][]map[string]interface{}, error) {
-	if len(queries) == 0 {
-		return [][]map[string]interface{}{}, nil
-	}
-
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", input.Username, input.Password, input.Host, input.Port, input.Database))
-	if err != nil {
-		return nil, err
-	}
-	defer db.Close()
-
-	var results [][]map[string]interface{}
-
-	// Begin transaction if requested
-	if useTransaction {
-		tx, err := db.Begin()
-		if err != nil {
-			return nil, fmt.Errorf("failed to start transaction: %w", err)
-		}
-		defer tx.Rollback() // Always rollback to ensure no changes are committed
-
-		// Execute each query within the same transaction
-		for _, query := range queries {
-			rows, err := tx.Query(query)
-			if err != nil {
-				return nil, err
-			}
-
-			columns, err := rows.Columns()
-			if err != nil {
-				rows.Close()
-				return nil, err
-			}
-
-			var result []map[string]interface{}
-			for rows.Next() {
-				values := make([]interface{}, len(columns))
-				valuePtrs := make([]interface{}, len(columns))
-
-				for i := range columns {
-					valuePtrs[i] = &values[i]
-				}
-
-				err = rows.Scan(valuePtrs...)
-				if err != nil {
-					rows.Close()
-					return nil, err
-				}
-
-				row := make(map[string]interface{})
-				for i, col := range columns {
-					val := values[i]
-					switch v := val.(type) {
-					case []byte:
-						row[col] = string(v)
-					default:
-						row[col] = v
-					}
-				}
-
-				result = append(result, row)
-			}
-			rows.Close()
-			results = append(results, result)
-		}
-	} else {
-		// Run each query individually without transaction
-		for _, query := range queries {
-			rows, err := a.TestQueryInDatabase(input, query, false)
-			if err != nil {
-				return nil, err
-			}
-			results = append(results, rows)
-		}
-	}
-
-	return results, nil
+	return result, rows.Err()
 }
 
-func (a *App) TestDatabaseConnection(input DatabaseConnection) bool {
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", input.Username, input.Password, input.Host, input.Port, input.Database))
-
-	if err != nil {
-		return false
-	}
-
-	defer db.Close()
-
-	err = db.Ping()
-
-	if err != nil {
-		return false
-	}
-
-	return true
+// sqliteDatabasePath is where the query library is stored
+func sqliteDatabasePath() string {
+	return storage.Path()
 }
 
 func openSqliteConnection() *sql.DB {
-	db, err := sql.Open("sqlite3", "./database.db")
+	db, err := sql.Open("sqlite3", sqliteDatabasePath())
 
 	if err != nil {
 		log.Fatal(err)
@@ -780,47 +669,6 @@ func openSqliteConnection() *sql.DB {
 	return db
 }
 
-func createSqliteTables() {
-	db := openSqliteConnection()
-
-	defer db.Close()
-
-	createTableSQL := `
-		CREATE TABLE IF NOT EXISTS queries (
-			id integer NOT NULL PRIMARY KEY,
-			title TEXT,
-			query TEXT,
-			description TEXT DEFAULT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			deleted_at TIMESTAMP DEFAULT NULL
-		);
-
-		CREATE TABLE IF NOT EXISTS database_connections (
-			id integer NOT NULL PRIMARY KEY,
-			username TEXT,
-			password TEXT,
-			host TEXT,
-			port INTEGER,
-			database TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			deleted_at TIMESTAMP DEFAULT NULL
-		);
-
-		CREATE TABLE IF NOT EXISTS database_structure (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			structure TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-	`
-	_, err := db.Exec(createTableSQL)
-
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
 func (a *App) GetBuildParams() map[string]interface{} {
 	buildParams := make(map[string]interface{})
 
@@ -856,166 +704,53 @@ func (a *App) CheckHasUpdate() bool {
 	return latestVersion > version
 }
 
-func (a *App) GetDatabaseStructure(input DatabaseConnection) (string, error) {
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", input.Username, input.Password, input.Host, input.Port, input.Database))
+// databaseStructureProgressEvent is emitted while GetDatabaseStructure runs
+const databaseStructureProgressEvent = "database-structure:progress"
 
-	if err != nil {
-		return "", err
-	}
-
-	defer db.Close()
+func (a *App) GetDatabaseStructure(input DatabaseConnection) (string, error) {
+	db, err := a.connections.DB(input)
 
-	// Get all tables
-	tableRows, err := db.Query("SHOW TABLES")
 	if err != nil {
 		return "", err
 	}
-	defer tableRows.Close()
-
-	type Column struct {
-		Name      string `json:"name"`
-		Type      string `json:"type"`
-		Nullable  string `json:"nullable"`
-		Key       string `json:"key"`
-		Default   string `json:"default"`
-		Extra     string `json:"extra"`
-		IsPrimary bool   `json:"isPrimary"`
-	}
-
-	type ForeignKey struct {
-		ColumnName       string `json:"columnName"`
-		ReferencedTable  string `json:"referencedTable"`
-		ReferencedColumn string `json:"referencedColumn"`
-		ConstraintName   string `json:"constraintName"`
-	}
-
-	type Table struct {
-		Name        string       `json:"name"`
-		Columns     []Column     `json:"columns"`
-		ForeignKeys []ForeignKey `json:"foreignKeys"`
-	}
-
-	type DatabaseStructure struct {
-		Tables []Table `json:"tables"`
-	}
-
-	structure := DatabaseStructure{
-		Tables: []Table{},
-	}
-
-	// Collect all tables
-	var tables []string
-	for tableRows.Next() {
-		var tableName string
-		if err := tableRows.Scan(&tableName); err != nil {
-			return "", err
-		}
-		tables = append(tables, tableName)
-	}
-
-	// For each table, get columns and foreign keys
-	for _, tableName := range tables {
-		table := Table{
-			Name:        tableName,
-			Columns:     []Column{},
-			ForeignKeys: []ForeignKey{},
-		}
-
-		// Get columns
-		columnRows, err := db.Query(fmt.Sprintf("DESCRIBE `%s`", tableName))
-		if err != nil {
-			return "", err
-		}
-
-		for columnRows.Next() {
-			var col Column
-			var field, colType, null, key, defaultVal, extra sql.NullString
-			if err := columnRows.Scan(&field, &colType, &null, &key, &defaultVal, &extra); err != nil {
-				columnRows.Close()
-				return "", err
-			}
 
-			col.Name = field.String
-			col.Type = colType.String
-			col.Nullable = null.String
-			col.Key = key.String
-			col.Default = defaultVal.String
-			col.Extra = extra.String
-			col.IsPrimary = key.String == "PRI"
-
-			table.Columns = append(table.Columns, col)
-		}
-		columnRows.Close()
-
-		// Get foreign keys
-		fkQuery := `
-		SELECT 
-			COLUMN_NAME, 
-			REFERENCED_TABLE_NAME, 
-			REFERENCED_COLUMN_NAME,
-			CONSTRAINT_NAME
-		FROM 
-			INFORMATION_SCHEMA.KEY_COLUMN_USAGE 
-		WHERE 
-			TABLE_SCHEMA = ? 
-			AND TABLE_NAME = ? 
-			AND REFERENCED_TABLE_NAME IS NOT NULL
-		`
-		fkRows, err := db.Query(fkQuery, input.Database, tableName)
-		if err != nil {
-			return "", err
-		}
-
-		for fkRows.Next() {
-			var fk ForeignKey
-			if err := fkRows.Scan(&fk.ColumnName, &fk.ReferencedTable, &fk.ReferencedColumn, &fk.ConstraintName); err != nil {
-				fkRows.Close()
-				return "", err
-			}
-			table.ForeignKeys = append(table.ForeignKeys, fk)
+	structure, err := schema.ScanMySQL(context.Background(), db, input.Database, func(progress schema.Progress) {
+		if a.ctx != nil {
+			runtime.EventsEmit(a.ctx, databaseStructureProgressEvent, progress)
 		}
-		fkRows.Close()
-
-		structure.Tables = append(structure.Tables, table)
-	}
-
-	// Convert to JSON
-	structureJSON, err := json.Marshal(structure)
+	})
 	if err != nil {
 		return "", err
 	}
 
-	// Store in SQLite
-	sqliteDB := openSqliteConnection()
-	defer sqliteDB.Close()
-
-	// Create table if not exists
-	_, err = sqliteDB.Exec(`
-		CREATE TABLE IF NOT EXISTS database_structure (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			structure TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return "", err
-	}
+	return storeDatabaseStructure(input.ID, structureSource(input), structure)
+}
 
-	// Insert new structure
-	_, err = sqliteDB.Exec("INSERT INTO database_structure (structure) VALUES (?)", string(structureJSON))
+// GetLatestDatabaseStructure returns the newest snapshot of the database
+// the saved connection currently points at. When there is none, snapshots
+// stored before they were scoped to connections are used, then the newest
+// imported DDL file, so the assistant works without database access
+func (a *App) GetLatestDatabaseStructure() (string, error) {
+	connection, err := a.GetDatabaseConnection()
 	if err != nil {
 		return "", err
 	}
 
-	return string(structureJSON), nil
-}
-
-func (a *App) GetLatestDatabaseStructure() (string, error) {
 	db := openSqliteConnection()
 	defer db.Close()
 
+	source := structureSource(connection)
+
 	var structure string
-	err := db.QueryRow("SELECT structure FROM database_structure ORDER BY created_at DESC LIMIT 1").Scan(&structure)
+	err = db.QueryRow(`
+		SELECT structure FROM database_structure
+		WHERE (connection_id IS ? AND source = ?)
+			OR (connection_id IS NULL AND (source = '' OR source LIKE 'file:%'))
+		ORDER BY
+			CASE WHEN connection_id IS ? AND source = ? THEN 0 WHEN source = '' THEN 1 ELSE 2 END,
+			created_at DESC, id DESC
+		LIMIT 1
+	`, connection.ID, source, connection.ID, source).Scan(&structure)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", nil
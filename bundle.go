@@ -0,0 +1,747 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of ExportQueries and ImportQueries. Bundles hold every query in a
+// single JSON or YAML file; the sql format writes one annotated file per
+// query into a folder tree that mirrors the library folders
+const (
+	BundleJSON = "json"
+	BundleYAML = "yaml"
+	BundleSQL  = "sql"
+)
+
+// queryBundleVersion is bumped when the bundle layout changes incompatibly
+const queryBundleVersion = 1
+
+// frontMatterFence opens and closes the metadata comment of a .sql file
+const frontMatterFence = "-- ---"
+
+// QueryBundle is the portable form of part of the library. It carries no
+// connection details, so it is safe to share and to keep in git
+type QueryBundle struct {
+	Version    int           `json:"version" yaml:"version"`
+	ExportedAt string        `json:"exportedAt,omitempty" yaml:"exportedAt,omitempty"`
+	Queries    []BundleQuery `json:"queries" yaml:"queries"`
+}
+
+// BundleQuery is a saved query with its tags and variable mappings. Folder
+// is the path of the library folder, with / between levels
+type BundleQuery struct {
+	Title       string            `json:"title" yaml:"title"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Folder      string            `json:"folder,omitempty" yaml:"folder,omitempty"`
+	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty,flow"`
+	Variables   []BundleVariable  `json:"variables,omitempty" yaml:"variables,omitempty"`
+	Parameters  []BundleParameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Query       string            `json:"query" yaml:"query"`
+}
+
+// BundleVariable is a QueryVariable in a bundle
+type BundleVariable struct {
+	Placeholder string `json:"placeholder" yaml:"placeholder"`
+	Field       string `json:"field,omitempty" yaml:"field,omitempty"`
+	Type        string `json:"type,omitempty" yaml:"type,omitempty"`
+	Default     string `json:"default,omitempty" yaml:"default,omitempty"`
+}
+
+// BundleParameter is a QueryParameter in a bundle
+type BundleParameter struct {
+	Name          string   `json:"name" yaml:"name"`
+	Type          string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Default       string   `json:"default,omitempty" yaml:"default,omitempty"`
+	AllowedValues []string `json:"allowedValues,omitempty" yaml:"allowedValues,omitempty,flow"`
+}
+
+var bundleFileFilters = []runtime.FileFilter{
+	{
+		DisplayName: "Query bundles (*.json, *.yaml, *.yml)",
+		Pattern:     "*.json;*.yaml;*.yml",
+	},
+}
+
+// folderPaths maps the id of every folder to its full path
+func folderPaths(db *sql.DB) (map[int]string, error) {
+	paths := make(map[int]string)
+
+	rows, err := db.Query(`
+		WITH RECURSIVE tree(id, path) AS (
+			SELECT id, name FROM folders WHERE parent_id IS NULL
+			UNION ALL
+			SELECT folders.id, tree.path || '/' || folders.name FROM folders JOIN tree ON folders.parent_id = tree.id
+		)
+		SELECT id, path FROM tree
+	`)
+	if err != nil {
+		return paths, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var path string
+
+		err = rows.Scan(&id, &path)
+		if err != nil {
+			return paths, err
+		}
+
+		paths[id] = path
+	}
+
+	return paths, rows.Err()
+}
+
+// ensureFolderPath returns the folder at path, creating missing levels
+func ensureFolderPath(tx *sql.Tx, path string) (*int, error) {
+	var parentID *int
+
+	for _, name := range strings.Split(path, "/") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		var id int
+
+		err := tx.QueryRow("SELECT id FROM folders WHERE COALESCE(parent_id, 0) = COALESCE(?, 0) AND name = ? COLLATE NOCASE", parentID, name).Scan(&id)
+
+		if err == sql.ErrNoRows {
+			result, err := tx.Exec("INSERT INTO folders (name, parent_id) VALUES (?, ?)", name, parentID)
+			if err != nil {
+				return nil, err
+			}
+
+			created, err := result.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+
+			id = int(created)
+		} else if err != nil {
+			return nil, err
+		}
+
+		parentID = &id
+	}
+
+	return parentID, nil
+}
+
+// buildQueryBundle collects the given active queries, or all of them when
+// ids is empty, in library order
+func buildQueryBundle(db *sql.DB, ids []int) (QueryBundle, error) {
+	bundle := QueryBundle{Version: queryBundleVersion, Queries: []BundleQuery{}}
+
+	queries, err := listQueries(db, false, QueryFilter{})
+	if err != nil {
+		return bundle, err
+	}
+
+	paths, err := folderPaths(db)
+	if err != nil {
+		return bundle, err
+	}
+
+	selected := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	for _, query := range queries {
+		if len(ids) > 0 && !selected[*query.ID] {
+			continue
+		}
+
+		entry, err := bundleEntry(db, query, paths)
+		if err != nil {
+			return bundle, err
+		}
+
+		bundle.Queries = append(bundle.Queries, entry)
+	}
+
+	return bundle, nil
+}
+
+// bundleEntry is the portable form of a saved query. paths comes from
+// folderPaths
+func bundleEntry(db *sql.DB, query Query, paths map[int]string) (BundleQuery, error) {
+	entry := BundleQuery{
+		Title:       query.Title,
+		Description: query.Description,
+		Tags:        query.Tags,
+		Query:       query.Query,
+	}
+
+	if query.FolderID != nil {
+		entry.Folder = paths[*query.FolderID]
+	}
+
+	template, err := loadQueryTemplate(db, *query.ID)
+	if err != nil {
+		return entry, err
+	}
+
+	for _, variable := range template.Variables {
+		entry.Variables = append(entry.Variables, BundleVariable{
+			Placeholder: variable.Placeholder,
+			Field:       variable.Field,
+			Type:        variable.Type,
+			Default:     variable.Default,
+		})
+	}
+
+	parameters, err := loadQueryParameters(db, *query.ID)
+	if err != nil {
+		return entry, err
+	}
+
+	for _, parameter := range parameters {
+		exported := BundleParameter{Name: parameter.Name, Type: parameter.Type, Default: parameter.Default}
+
+		if len(parameter.AllowedValues) > 0 {
+			exported.AllowedValues = parameter.AllowedValues
+		}
+
+		entry.Parameters = append(entry.Parameters, exported)
+	}
+
+	return entry, nil
+}
+
+// importQueryBundle adds the queries of a bundle in one transaction. Folders,
+// tags and variables are applied to the queries written; duplicates and
+// clashes are handled as in MergeDatabaseFile
+func importQueryBundle(db *sql.DB, bundle QueryBundle, strategy string) (DatabaseMergeResult, error) {
+	result := DatabaseMergeResult{Conflicts: []string{}}
+
+	if bundle.Version > queryBundleVersion {
+		return result, fmt.Errorf("the bundle was made by a newer version of the app (version %d)", bundle.Version)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	for _, entry := range bundle.Queries {
+		if strings.TrimSpace(entry.Title) == "" {
+			return result, fmt.Errorf("a query in the bundle has no title")
+		}
+
+		id, err := mergeQuery(tx,
+			sql.NullString{String: entry.Title, Valid: true},
+			sql.NullString{String: entry.Query, Valid: true},
+			sql.NullString{String: entry.Description, Valid: true},
+			sql.NullString{},
+			strategy, &result)
+		if err != nil {
+			return result, err
+		}
+
+		if id == 0 {
+			continue
+		}
+
+		err = applyBundleMetadata(tx, id, entry)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+// applyBundleMetadata gives a saved query the folder, tags, variables and
+// parameters of a bundle entry
+func applyBundleMetadata(tx *sql.Tx, id int, entry BundleQuery) error {
+	folderID, err := ensureFolderPath(tx, entry.Folder)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE queries SET folder_id = ? WHERE id = ?", folderID, id)
+	if err != nil {
+		return err
+	}
+
+	err = setQueryTags(tx, id, entry.Tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM query_variables WHERE query_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	for i, variable := range entry.Variables {
+		variableType := variable.Type
+		if variableType == "" {
+			variableType = VariableRaw
+		}
+
+		if !variableTypes[variableType] || !placeholderName.MatchString(variable.Placeholder) {
+			return fmt.Errorf("query %q has an invalid variable %q", entry.Title, variable.Placeholder)
+		}
+
+		_, err = tx.Exec("INSERT INTO query_variables (query_id, position, field, placeholder, type, default_value) VALUES (?, ?, ?, ?, ?, ?)",
+			id, i, variable.Field, variable.Placeholder, variableType, variable.Default)
+		if err != nil {
+			return err
+		}
+	}
+
+	parameters := make([]QueryParameter, len(entry.Parameters))
+	for i, parameter := range entry.Parameters {
+		parameters[i] = QueryParameter{Name: parameter.Name, Type: parameter.Type, Default: parameter.Default, AllowedValues: parameter.AllowedValues}
+	}
+
+	err = saveQueryParameters(tx, id, parameters)
+	if err != nil {
+		return fmt.Errorf("query %q: %w", entry.Title, err)
+	}
+
+	return nil
+}
+
+func encodeQueryBundle(bundle QueryBundle, format string) ([]byte, error) {
+	switch format {
+	case BundleJSON:
+		return json.MarshalIndent(bundle, "", "  ")
+	case BundleYAML:
+		return yaml.Marshal(bundle)
+	}
+
+	return nil, fmt.Errorf("unknown bundle format %q", format)
+}
+
+func decodeQueryBundle(data []byte, format string) (QueryBundle, error) {
+	var bundle QueryBundle
+	var err error
+
+	switch format {
+	case BundleJSON:
+		err = json.Unmarshal(data, &bundle)
+	case BundleYAML:
+		err = yaml.Unmarshal(data, &bundle)
+	default:
+		return bundle, fmt.Errorf("unknown bundle format %q", format)
+	}
+
+	if err != nil {
+		return bundle, fmt.Errorf("invalid %s bundle: %w", format, err)
+	}
+
+	return bundle, nil
+}
+
+// bundleFormat picks the bundle format from a file extension
+func bundleFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return BundleJSON, nil
+	case ".yaml", ".yml":
+		return BundleYAML, nil
+	}
+
+	return "", fmt.Errorf("%s is not a .json or .yaml bundle", filepath.Base(path))
+}
+
+// formatSQLFile writes a query as SQL preceded by its metadata as YAML in a
+// comment block, so the file still runs as is in any SQL client
+func formatSQLFile(entry BundleQuery) (string, error) {
+	encoded, err := yaml.Marshal(frontMatter{
+		Title:       entry.Title,
+		Description: entry.Description,
+		Tags:        entry.Tags,
+		Variables:   entry.Variables,
+		Parameters:  entry.Parameters,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(frontMatterFence + "\n")
+
+	for _, line := range strings.Split(strings.TrimRight(string(encoded), "\n"), "\n") {
+		sb.WriteString(strings.TrimRight("-- "+line, " ") + "\n")
+	}
+
+	sb.WriteString(frontMatterFence + "\n")
+	sb.WriteString(strings.TrimRight(entry.Query, "\n") + "\n")
+
+	return sb.String(), nil
+}
+
+// frontMatter is the part of a BundleQuery kept in the comment of a .sql
+// file; the folder comes from where the file is
+type frontMatter struct {
+	Title       string            `yaml:"title"`
+	Description string            `yaml:"description,omitempty"`
+	Tags        []string          `yaml:"tags,omitempty,flow"`
+	Variables   []BundleVariable  `yaml:"variables,omitempty"`
+	Parameters  []BundleParameter `yaml:"parameters,omitempty"`
+}
+
+// parseSQLFile reads a file written by formatSQLFile. Files without front
+// matter are accepted, titled after fallbackTitle
+func parseSQLFile(content string, fallbackTitle string) (BundleQuery, error) {
+	entry := BundleQuery{Title: fallbackTitle}
+
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	if !strings.HasPrefix(content, frontMatterFence+"\n") {
+		entry.Query = strings.TrimRight(content, "\n")
+		return entry, nil
+	}
+
+	lines := strings.Split(content, "\n")
+	metadata := []string{}
+	closed := false
+
+	for i, line := range lines[1:] {
+		if line == frontMatterFence {
+			entry.Query = strings.TrimRight(strings.Join(lines[i+2:], "\n"), "\n")
+			closed = true
+			break
+		}
+
+		if line != "--" && !strings.HasPrefix(line, "-- ") {
+			return entry, fmt.Errorf("front matter line %q is not a -- comment", line)
+		}
+
+		metadata = append(metadata, strings.TrimPrefix(strings.TrimPrefix(line, "--"), " "))
+	}
+
+	if !closed {
+		return entry, fmt.Errorf("front matter is not closed with %q", frontMatterFence)
+	}
+
+	var fields frontMatter
+
+	err := yaml.Unmarshal([]byte(strings.Join(metadata, "\n")), &fields)
+	if err != nil {
+		return entry, fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	if strings.TrimSpace(fields.Title) != "" {
+		entry.Title = fields.Title
+	}
+
+	entry.Description = fields.Description
+	entry.Tags = fields.Tags
+	entry.Variables = fields.Variables
+	entry.Parameters = fields.Parameters
+
+	return entry, nil
+}
+
+var unsafeFileNameCharacters = regexp.MustCompile(`[^\pL\pN]+`)
+
+// sqlFileName turns a title into a file name that is valid on every OS
+func sqlFileName(title string) string {
+	name := strings.Trim(unsafeFileNameCharacters.ReplaceAllString(strings.ToLower(title), "-"), "-")
+
+	if len(name) > 80 {
+		name = strings.TrimRight(name[:80], "-")
+	}
+
+	if name == "" {
+		name = "query"
+	}
+
+	return name
+}
+
+var unsafeDirectoryCharacters = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+
+// safeDirectoryName keeps a folder name readable while making it valid as a
+// directory on every OS
+func safeDirectoryName(name string) string {
+	return strings.Trim(unsafeDirectoryCharacters.ReplaceAllString(name, "_"), " .")
+}
+
+// sqlFolderPath is the directory, relative and with / between levels, that
+// holds the files of a library folder
+func sqlFolderPath(folder string) string {
+	names := []string{}
+
+	for _, name := range strings.Split(folder, "/") {
+		if name = safeDirectoryName(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, "/")
+}
+
+// writeSQLFolder writes a bundle as a tree of .sql files under dir and
+// returns the path of each file relative to dir, in bundle order. A folder
+// that already holds .sql files is refused, so hand-edited files are never
+// overwritten and files of an earlier export don't mix with the new ones
+func writeSQLFolder(dir string, bundle QueryBundle) ([]string, error) {
+	files := make([]string, 0, len(bundle.Queries))
+	taken := make(map[string]bool)
+
+	existing, err := listSQLFiles(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return files, err
+	}
+
+	if len(existing) > 0 {
+		return files, fmt.Errorf("%s already has %d .sql files, choose an empty folder or keep it in sync as a shared library instead", dir, len(existing))
+	}
+
+	for _, entry := range bundle.Queries {
+		base := filepath.Join(filepath.FromSlash(sqlFolderPath(entry.Folder)), sqlFileName(entry.Title))
+		relative := base + ".sql"
+
+		for i := 2; taken[strings.ToLower(relative)]; i++ {
+			relative = fmt.Sprintf("%s-%d.sql", base, i)
+		}
+
+		taken[strings.ToLower(relative)] = true
+
+		content, err := formatSQLFile(entry)
+		if err != nil {
+			return files, err
+		}
+
+		path := filepath.Join(dir, relative)
+
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			return files, err
+		}
+
+		err = os.WriteFile(path, []byte(content), 0o644)
+		if err != nil {
+			return files, err
+		}
+
+		files = append(files, filepath.ToSlash(relative))
+	}
+
+	return files, nil
+}
+
+// listSQLFiles returns the .sql files under dir, sorted and relative to dir
+// with / between levels. Hidden directories such as .git are skipped
+func listSQLFiles(dir string) ([]string, error) {
+	paths := []string{}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() && path != dir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".sql") {
+			relative, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			paths = append(paths, filepath.ToSlash(relative))
+		}
+
+		return nil
+	})
+
+	sort.Strings(paths)
+
+	return paths, err
+}
+
+// mergeMarkers finds the lines git leaves in a file it could not merge
+var mergeMarkers = regexp.MustCompile(`(?m)^(<{7}|>{7})( |$)`)
+
+// readSQLFile parses a file written by writeSQLFolder at relative, a path
+// inside the folder with / between levels
+func readSQLFile(relative string, content string) (BundleQuery, error) {
+	name := path.Base(relative)
+
+	if mergeMarkers.MatchString(content) {
+		return BundleQuery{}, fmt.Errorf("%s has unresolved git merge markers", relative)
+	}
+
+	entry, err := parseSQLFile(content, strings.TrimSuffix(name, path.Ext(name)))
+	if err != nil {
+		return entry, fmt.Errorf("%s: %w", relative, err)
+	}
+
+	if folder := path.Dir(relative); folder != "." {
+		entry.Folder = folder
+	}
+
+	return entry, nil
+}
+
+// readSQLFolder reads every .sql file under dir. The folder of each query is
+// taken from the directories between dir and the file
+func readSQLFolder(dir string) (QueryBundle, error) {
+	bundle := QueryBundle{Version: queryBundleVersion, Queries: []BundleQuery{}}
+
+	paths, err := listSQLFiles(dir)
+	if err != nil {
+		return bundle, err
+	}
+
+	for _, relative := range paths {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(relative)))
+		if err != nil {
+			return bundle, err
+		}
+
+		entry, err := readSQLFile(relative, string(content))
+		if err != nil {
+			return bundle, err
+		}
+
+		bundle.Queries = append(bundle.Queries, entry)
+	}
+
+	return bundle, nil
+}
+
+// ExportQueries saves the given queries, or the whole library when ids is
+// empty, as a json or yaml bundle file or as a folder of sql files. It
+// returns the chosen path
+func (a *App) ExportQueries(ids []int, format string) (string, error) {
+	if format != BundleJSON && format != BundleYAML && format != BundleSQL {
+		return "", fmt.Errorf("unknown export format %q", format)
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	bundle, err := buildQueryBundle(db, ids)
+	if err != nil {
+		return "", err
+	}
+
+	bundle.ExportedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if format == BundleSQL {
+		selection, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+			Title:                "Select Folder",
+			CanCreateDirectories: true,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if selection == "" {
+			return "", fmt.Errorf("no folder selected")
+		}
+
+		_, err = writeSQLFolder(selection, bundle)
+
+		return selection, err
+	}
+
+	selection, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Save File",
+		DefaultFilename: "queries." + format,
+		Filters:         bundleFileFilters,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if selection == "" {
+		return "", fmt.Errorf("no file selected")
+	}
+
+	data, err := encodeQueryBundle(bundle, format)
+	if err != nil {
+		return "", err
+	}
+
+	return selection, os.WriteFile(selection, data, 0o644)
+}
+
+// ImportQueries adds the queries of a json or yaml bundle, or of a folder of
+// sql files when format is sql. Queries identical to one already saved are
+// left out; other title clashes are resolved with strategy
+func (a *App) ImportQueries(format string, strategy string) (DatabaseMergeResult, error) {
+	if strategy != MergeSkip && strategy != MergeOverwrite && strategy != MergeKeepBoth {
+		return DatabaseMergeResult{}, fmt.Errorf("unknown merge strategy %q", strategy)
+	}
+
+	var bundle QueryBundle
+
+	if format == BundleSQL {
+		selection, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+			Title: "Select Folder",
+		})
+		if err != nil {
+			return DatabaseMergeResult{}, err
+		}
+
+		if selection == "" {
+			return DatabaseMergeResult{}, fmt.Errorf("no folder selected")
+		}
+
+		bundle, err = readSQLFolder(selection)
+		if err != nil {
+			return DatabaseMergeResult{}, err
+		}
+	} else {
+		selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title:   "Select File",
+			Filters: bundleFileFilters,
+		})
+		if err != nil {
+			return DatabaseMergeResult{}, err
+		}
+
+		if selection == "" {
+			return DatabaseMergeResult{}, fmt.Errorf("no file selected")
+		}
+
+		detected, err := bundleFormat(selection)
+		if err != nil {
+			return DatabaseMergeResult{}, err
+		}
+
+		data, err := os.ReadFile(selection)
+		if err != nil {
+			return DatabaseMergeResult{}, err
+		}
+
+		bundle, err = decodeQueryBundle(data, detected)
+		if err != nil {
+			return DatabaseMergeResult{}, err
+		}
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return importQueryBundle(db, bundle, strategy)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// seedBundleLibrary saves queries with a folder, tags and variables
+func seedBundleLibrary(t *testing.T, app *App) {
+	t.Helper()
+
+	reports, err := app.CreateFolder("Reports", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	monthly, err := app.CreateFolder("Monthly: Sales", &reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := []Query{
+		{Title: "Insert users", Query: "INSERT INTO users (name) VALUES ({{ name }});", Description: "Bulk import", Tags: []string{"users"}},
+		{Title: "Sales by month", Query: "SELECT month, SUM(total)\nFROM sales\nWHERE year = :year\n-- ---\nGROUP BY month", FolderID: &monthly, Tags: []string{"finance", "monthly"}},
+	}
+
+	for _, query := range saved {
+		if err := app.InsertQueryInDatabase(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = app.SaveQueryTemplate(1, QueryTemplate{Variables: []QueryVariable{{Field: "Name", Placeholder: "name", Type: VariableString}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.SaveQueryParameters(2, []QueryParameter{{Name: "year", Type: VariableNumber, Default: "2024", AllowedValues: []string{"2023", "2024"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLFileRoundTrip(t *testing.T) {
+	entry := BundleQuery{
+		Title:       "Sales: by month",
+		Description: "Totals\nper month",
+		Tags:        []string{"finance"},
+		Variables:   []BundleVariable{{Placeholder: "year", Field: "Year", Type: VariableNumber, Default: "2024"}},
+		Query:       "SELECT 1;\n-- ---\nSELECT 2;",
+	}
+
+	content, err := formatSQLFile(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(content, "-- ---\n-- title: 'Sales: by month'\n") {
+		t.Errorf("unexpected front matter:\n%s", content)
+	}
+
+	parsed, err := parseSQLFile(content, "fallback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(parsed, entry) {
+		t.Errorf("expected %+v, got %+v", entry, parsed)
+	}
+
+	plain, err := parseSQLFile("SELECT 3;\n", "plain")
+	if err != nil || plain.Title != "plain" || plain.Query != "SELECT 3;" {
+		t.Errorf("expected a file without front matter to be titled after it, got %+v (%v)", plain, err)
+	}
+
+	if _, err := parseSQLFile("-- ---\n-- title: x\nSELECT 1;", "broken"); err == nil {
+		t.Error("expected unclosed front matter to be rejected")
+	}
+}
+
+func TestQueryBundleRoundTrip(t *testing.T) {
+	for _, format := range []string{BundleJSON, BundleYAML, BundleSQL} {
+		t.Run(format, func(t *testing.T) {
+			useTemporaryLibrary(t)
+			app := NewApp()
+			seedBundleLibrary(t, app)
+
+			db := openSqliteConnection()
+			defer db.Close()
+
+			bundle, err := buildQueryBundle(db, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(bundle.Queries) != 2 || bundle.Queries[1].Folder != "Reports/Monthly: Sales" || len(bundle.Queries[0].Variables) != 1 || len(bundle.Queries[1].Parameters) != 1 {
+				t.Fatalf("unexpected bundle %+v", bundle)
+			}
+
+			if format == BundleSQL {
+				dir := t.TempDir()
+
+				files, err := writeSQLFolder(dir, bundle)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(files, []string{"insert-users.sql", "Reports/Monthly_ Sales/sales-by-month.sql"}) {
+					t.Errorf("unexpected files %v", files)
+				}
+
+				// Exporting again must not overwrite the files, edited or not
+				if _, err := writeSQLFolder(dir, bundle); err == nil || !strings.Contains(err.Error(), "already has 2 .sql files") {
+					t.Errorf("expected a folder with .sql files to be refused, got %v", err)
+				}
+
+				bundle, err = readSQLFolder(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Directory names are sanitised, so the folder comes back
+				// as the directory it was written to
+				bundle.Queries[1].Folder = "Reports/Monthly: Sales"
+			} else {
+				data, err := encodeQueryBundle(bundle, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				bundle, err = decodeQueryBundle(data, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Importing into the same library finds only duplicates
+			result, err := importQueryBundle(db, bundle, MergeSkip)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Duplicates != 2 || result.Imported != 0 {
+				t.Errorf("expected two duplicates, got %+v", result)
+			}
+
+			// Into an empty library everything comes back
+			useTemporaryLibrary(t)
+
+			empty := openSqliteConnection()
+			defer empty.Close()
+
+			result, err = importQueryBundle(empty, bundle, MergeSkip)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Imported != 2 {
+				t.Errorf("expected two imported queries, got %+v", result)
+			}
+
+			restored, err := buildQueryBundle(empty, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bundle.ExportedAt = ""
+
+			if !reflect.DeepEqual(restored, bundle) {
+				t.Errorf("expected the library to round-trip:\n%+v\n%+v", bundle, restored)
+			}
+		})
+	}
+}
+
+func TestImportBundleOverwrite(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+	seedBundleLibrary(t, app)
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	bundle := QueryBundle{Version: 1, Queries: []BundleQuery{
+		{Title: "insert users", Query: "INSERT INTO people (name) VALUES ({{ name }});", Tags: []string{"people"}, Folder: "Imports"},
+	}}
+
+	result, err := importQueryBundle(db, bundle, MergeOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Overwritten != 1 {
+		t.Fatalf("expected the clash to be overwritten, got %+v", result)
+	}
+
+	queries, _ := listQueries(db, false, QueryFilter{Tags: []string{"people"}})
+	if len(queries) != 1 || queries[0].Title != "Insert users" || queries[0].FolderID == nil {
+		t.Errorf("expected the existing query to take the imported tags and folder, got %+v", queries)
+	}
+
+	if _, err := importQueryBundle(db, QueryBundle{Version: 99}, MergeSkip); err == nil {
+		t.Error("expected a bundle from a newer version to be rejected")
+	}
+}
+
+func TestReadSQLFolderSkipsHiddenDirectories(t *testing.T) {
+	dir := t.TempDir()
+
+	os.MkdirAll(filepath.Join(dir, ".git"), 0o755)
+	os.WriteFile(filepath.Join(dir, ".git", "hook.sql"), []byte("SELECT 0;"), 0o644)
+	os.WriteFile(filepath.Join(dir, "one.SQL"), []byte("SELECT 1;"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a query"), 0o644)
+
+	bundle, err := readSQLFolder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bundle.Queries) != 1 || bundle.Queries[0].Title != "one" {
+		t.Errorf("unexpected queries %+v", bundle.Queries)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// PoolSettings controls how pooled MySQL connections are sized and recycled
+type PoolSettings struct {
+	MaxOpenConns        int
+	MaxIdleConns        int
+	ConnMaxLifetime     time.Duration
+	ConnMaxIdleTime     time.Duration
+	IdleTimeout         time.Duration
+	HealthCheckInterval time.Duration
+	PingTimeout         time.Duration
+}
+
+// ConnectionPoolStats describes the state of a managed pool for the frontend
+type ConnectionPoolStats struct {
+	Profile         string
+	OpenConnections int
+	InUse           int
+	Idle            int
+	StickySession   bool
+	LastUsedAt      string
+}
+
+// defaultPoolSettings are tuned for an interactive desktop client: few
+// connections, kept warm for a while and dropped when the user walks away
+var defaultPoolSettings = PoolSettings{
+	MaxOpenConns:        5,
+	MaxIdleConns:        2,
+	ConnMaxLifetime:     30 * time.Minute,
+	ConnMaxIdleTime:     5 * time.Minute,
+	IdleTimeout:         15 * time.Minute,
+	HealthCheckInterval: time.Minute,
+	PingTimeout:         5 * time.Second,
+}
+
+// dbSession is the subset of *sql.DB and *sql.Conn used to run user queries,
+// so the same code path serves pooled and sticky connections
+type dbSession interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+	PingContext(ctx context.Context) error
+}
+
+// managedPool is a connection pool for a single connection profile
+type managedPool struct {
+	db       *sql.DB
+	dsn      string
+	sticky   *sql.Conn
+	lastUsed time.Time
+}
+
+// connectionRegistry keeps one pool per connection profile alive across calls,
+// so repeated test executions reuse established connections
+type connectionRegistry struct {
+	mu       sync.Mutex
+	pools    map[string]*managedPool
+	tunnels  *tunnelManager
+	settings PoolSettings
+	stop     chan struct{}
+}
+
+func newConnectionRegistry(settings PoolSettings) *connectionRegistry {
+	return &connectionRegistry{
+		pools:    make(map[string]*managedPool),
+		tunnels:  newTunnelManager(),
+		settings: settings,
+	}
+}
+
+// profileKey identifies a connection profile. Saved profiles are keyed by ID,
+// unsaved ones by their address so ad-hoc connections still get pooled
+func profileKey(input DatabaseConnection) string {
+	if input.ID != nil {
+		return fmt.Sprintf("profile:%d", *input.ID)
+	}
+
+	return fmt.Sprintf("%s@%s:%d/%s", input.Username, input.Host, input.Port, input.Database)
+}
+
+// pool returns the pool for the profile, opening it on first use. When the
+// profile's credentials changed since the pool was opened it is replaced
+func (r *connectionRegistry) pool(input DatabaseConnection) (*managedPool, error) {
+	key := profileKey(input)
+
+	cfg, err := mysqlConfig(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.SSHEnabled {
+		cfg.Addr, err = r.tunnels.LocalAddr(input)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dsn := cfg.FormatDSN()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.pools[key]; ok {
+		if p.dsn == dsn {
+			p.lastUsed = time.Now()
+			return p, nil
+		}
+
+		r.closePool(key, p)
+	}
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(connector)
+
+	db.SetMaxOpenConns(r.settings.MaxOpenConns)
+	db.SetMaxIdleConns(r.settings.MaxIdleConns)
+	db.SetConnMaxLifetime(r.settings.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(r.settings.ConnMaxIdleTime)
+
+	p := &managedPool{db: db, dsn: dsn, lastUsed: time.Now()}
+	r.pools[key] = p
+
+	return p, nil
+}
+
+// DB returns the shared pool for the profile
+func (r *connectionRegistry) DB(input DatabaseConnection) (*sql.DB, error) {
+	p, err := r.pool(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.db, nil
+}
+
+// Session returns the sticky connection for the profile when one is open,
+// otherwise the shared pool
+func (r *connectionRegistry) Session(input DatabaseConnection) (dbSession, error) {
+	p, err := r.pool(input)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p.sticky != nil {
+		return p.sticky, nil
+	}
+
+	return p.db, nil
+}
+
+// BeginSticky pins a single connection to the profile so session state such
+// as variables and temporary tables survives between queries
+func (r *connectionRegistry) BeginSticky(ctx context.Context, input DatabaseConnection) error {
+	p, err := r.pool(input)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if p.sticky != nil {
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
+
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open sticky session: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p.sticky != nil {
+		conn.Close()
+		return nil
+	}
+
+	p.sticky = conn
+
+	return nil
+}
+
+// EndSticky returns the pinned connection to the pool. Session state is lost
+func (r *connectionRegistry) EndSticky(input DatabaseConnection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.pools[profileKey(input)]
+	if !ok || p.sticky == nil {
+		return nil
+	}
+
+	err := p.sticky.Close()
+	p.sticky = nil
+
+	return err
+}
+
+// Evict closes and forgets the pool and SSH tunnel for the profile
+func (r *connectionRegistry) Evict(input DatabaseConnection) {
+	key := profileKey(input)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.pools[key]; ok {
+		r.closePool(key, p)
+	}
+
+	r.tunnels.Close(input)
+}
+
+// Stats reports the state of every managed pool
+func (r *connectionRegistry) Stats() []ConnectionPoolStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]ConnectionPoolStats, 0, len(r.pools))
+
+	for key, p := range r.pools {
+		dbStats := p.db.Stats()
+
+		stats = append(stats, ConnectionPoolStats{
+			Profile:         key,
+			OpenConnections: dbStats.OpenConnections,
+			InUse:           dbStats.InUse,
+			Idle:            dbStats.Idle,
+			StickySession:   p.sticky != nil,
+			LastUsedAt:      p.lastUsed.Format(time.RFC3339),
+		})
+	}
+
+	return stats
+}
+
+// Start launches the background health checker
+func (r *connectionRegistry) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		return
+	}
+
+	r.stop = make(chan struct{})
+
+	go r.healthLoop(r.stop)
+}
+
+// Close stops the health checker and closes every pool
+func (r *connectionRegistry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+
+	for key, p := range r.pools {
+		r.closePool(key, p)
+	}
+
+	r.tunnels.CloseAll()
+}
+
+func (r *connectionRegistry) healthLoop(stop chan struct{}) {
+	ticker := time.NewTicker(r.settings.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.checkHealth()
+		}
+	}
+}
+
+// checkHealth drops pools that sat idle past the timeout and pings the rest,
+// discarding any that no longer answer so the next call reconnects cleanly
+func (r *connectionRegistry) checkHealth() {
+	r.mu.Lock()
+	candidates := make(map[string]*managedPool, len(r.pools))
+
+	for key, p := range r.pools {
+		if p.sticky == nil && time.Since(p.lastUsed) > r.settings.IdleTimeout {
+			r.closePool(key, p)
+			continue
+		}
+
+		candidates[key] = p
+	}
+	r.mu.Unlock()
+
+	for key, p := range candidates {
+		r.mu.Lock()
+		var target dbSession = p.db
+		if p.sticky != nil {
+			target = p.sticky
+		}
+		r.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.settings.PingTimeout)
+		err := target.PingContext(ctx)
+
+		cancel()
+
+		if err == nil {
+			continue
+		}
+
+		log.Printf("connection pool %s failed health check: %v", key, err)
+
+		r.mu.Lock()
+		if current, ok := r.pools[key]; ok && current == p {
+			r.closePool(key, p)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// closePool must be called with r.mu held
+func (r *connectionRegistry) closePool(key string, p *managedPool) {
+	if p.sticky != nil {
+		p.sticky.Close()
+		p.sticky = nil
+	}
+
+	p.db.Close()
+
+	delete(r.pools, key)
+}
+
+// BeginStickySession keeps one connection open for the profile so that
+// subsequent test queries share session variables and temporary tables
+func (a *App) BeginStickySession(input DatabaseConnection) error {
+	return a.connections.BeginSticky(context.Background(), input)
+}
+
+// EndStickySession releases the connection pinned by BeginStickySession
+func (a *App) EndStickySession(input DatabaseConnection) error {
+	return a.connections.EndSticky(input)
+}
+
+// CloseDatabaseConnection closes the pool kept for the profile
+func (a *App) CloseDatabaseConnection(input DatabaseConnection) {
+	a.connections.Evict(input)
+}
+
+// GetConnectionPoolStats lists the pools currently kept open
+func (a *App) GetConnectionPoolStats() []ConnectionPoolStats {
+	return a.connections.Stats()
+}
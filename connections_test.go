@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSession is a database/sql driver whose connections only answer pings
+type fakeSession struct {
+	pingErr error
+	pings   int32
+}
+
+func (s *fakeSession) Connect(ctx context.Context) (driver.Conn, error) {
+	return fakeSessionConn{s}, nil
+}
+
+func (s *fakeSession) Driver() driver.Driver {
+	return fakeSessionDriver{s}
+}
+
+type fakeSessionDriver struct {
+	session *fakeSession
+}
+
+func (d fakeSessionDriver) Open(name string) (driver.Conn, error) {
+	return fakeSessionConn{d.session}, nil
+}
+
+type fakeSessionConn struct {
+	session *fakeSession
+}
+
+func (c fakeSessionConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake session can't run queries")
+}
+
+func (c fakeSessionConn) Close() error {
+	return nil
+}
+
+func (c fakeSessionConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake session can't begin transactions")
+}
+
+func (c fakeSessionConn) Ping(ctx context.Context) error {
+	atomic.AddInt32(&c.session.pings, 1)
+	return c.session.pingErr
+}
+
+func addFakePool(r *connectionRegistry, key string, session *fakeSession, lastUsed time.Time) *managedPool {
+	p := &managedPool{db: sql.OpenDB(session), dsn: key, lastUsed: lastUsed}
+	r.pools[key] = p
+
+	return p
+}
+
+func TestConnectionRegistryReplacesPoolWhenDSNChanges(t *testing.T) {
+	registry := newConnectionRegistry(defaultPoolSettings)
+	defer registry.Close()
+
+	id := 1
+	input := DatabaseConnection{ID: &id, Username: "app", Password: "secret", Host: "127.0.0.1", Port: 3306, Database: "shop"}
+
+	first, err := registry.pool(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same, err := registry.pool(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if same != first {
+		t.Error("expected an unchanged profile to reuse its pool")
+	}
+
+	input.Password = "rotated"
+
+	replaced, err := registry.pool(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replaced == first || replaced.dsn == first.dsn {
+		t.Fatal("expected changed credentials to open a new pool")
+	}
+
+	if err := first.db.Ping(); err == nil || err.Error() != "sql: database is closed" {
+		t.Errorf("expected the replaced pool to be closed, got %v", err)
+	}
+
+	if len(registry.pools) != 1 || registry.pools[profileKey(input)] != replaced {
+		t.Errorf("expected only the new pool to be kept, got %v", registry.pools)
+	}
+
+	input.Params = map[string]string{"parseTime": "maybe"}
+
+	if _, err := registry.pool(input); err == nil {
+		t.Error("expected an invalid profile to be rejected")
+	}
+
+	if registry.pools[profileKey(input)] != replaced {
+		t.Error("expected an invalid profile to leave the current pool alone")
+	}
+}
+
+func TestConnectionRegistryCheckHealth(t *testing.T) {
+	settings := defaultPoolSettings
+	settings.IdleTimeout = time.Minute
+	settings.PingTimeout = time.Second
+
+	registry := newConnectionRegistry(settings)
+	defer registry.Close()
+
+	healthy := &fakeSession{}
+	broken := &fakeSession{pingErr: errors.New("server has gone away")}
+	idle := &fakeSession{}
+	pinned := &fakeSession{}
+
+	addFakePool(registry, "healthy", healthy, time.Now())
+	addFakePool(registry, "broken", broken, time.Now())
+	addFakePool(registry, "idle", idle, time.Now().Add(-time.Hour))
+
+	// A sticky session keeps its pool even when it sat idle
+	sticky := addFakePool(registry, "sticky", pinned, time.Now().Add(-time.Hour))
+
+	conn, err := sticky.db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sticky.sticky = conn
+
+	registry.checkHealth()
+
+	for key, kept := range map[string]bool{"healthy": true, "broken": false, "idle": false, "sticky": true} {
+		if _, ok := registry.pools[key]; ok != kept {
+			t.Errorf("%s: expected kept to be %t", key, kept)
+		}
+	}
+
+	if idle.pings != 0 {
+		t.Errorf("expected the idle pool to be dropped without a ping, got %d pings", idle.pings)
+	}
+
+	if healthy.pings == 0 || broken.pings == 0 || pinned.pings == 0 {
+		t.Errorf("expected the remaining pools to be pinged, got %d, %d and %d", healthy.pings, broken.pings, pinned.pings)
+	}
+}
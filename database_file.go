@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Conflict strategies for MergeDatabaseFile and ImportQueries, applied when an imported query
+// has the title of a different query already in the library
+const (
+	MergeSkip      = "skip"
+	MergeOverwrite = "overwrite"
+	MergeKeepBoth  = "keep-both"
+)
+
+// DatabaseMergeResult reports what MergeDatabaseFile did with each query
+type DatabaseMergeResult struct {
+	Imported    int
+	Duplicates  int
+	Skipped     int
+	Overwritten int
+	Renamed     int
+	Conflicts   []string
+}
+
+var sqliteFileFilters = []runtime.FileFilter{
+	{
+		DisplayName: "Sqlite 3 (*.db)",
+		Pattern:     "*.db",
+	},
+}
+
+// backupSqliteDatabase copies a database page by page with SQLite's online
+// backup API, which is safe while the source is in use
+func backupSqliteDatabase(sourcePath string, destinationPath string) error {
+	source, err := sql.Open("sqlite3", sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := sql.Open("sqlite3", destinationPath)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	ctx := context.Background()
+
+	sourceConn, err := source.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sourceConn.Close()
+
+	destinationConn, err := destination.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destinationConn.Close()
+
+	return destinationConn.Raw(func(destinationDriver interface{}) error {
+		return sourceConn.Raw(func(sourceDriver interface{}) error {
+			backup, err := destinationDriver.(*sqlite3.SQLiteConn).Backup("main", sourceDriver.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+
+			_, err = backup.Step(-1)
+			if err != nil {
+				backup.Finish()
+				return err
+			}
+
+			return backup.Finish()
+		})
+	})
+}
+
+// readOnlySqliteDSN opens the database at path read-only. The path is
+// escaped so that a ? or # in it is not taken for the query or fragment
+func readOnlySqliteDSN(path string) string {
+	path = filepath.ToSlash(path)
+
+	// Windows paths become file:///C:/...
+	if filepath.VolumeName(path) != "" {
+		path = "/" + path
+	}
+
+	return (&url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro"}).String()
+}
+
+// prepareImportedDatabase validates a database chosen for import and returns
+// a migrated working copy of it, next to the live database so that it can be
+// swapped in without crossing filesystems. The caller removes the copy
+func prepareImportedDatabase(selection string) (string, error) {
+	source, err := sql.Open("sqlite3", readOnlySqliteDSN(selection))
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	var integrity string
+
+	err = source.QueryRow("PRAGMA integrity_check").Scan(&integrity)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a valid database: %w", filepath.Base(selection), err)
+	}
+
+	if integrity != "ok" {
+		return "", fmt.Errorf("%s is corrupted: %s", filepath.Base(selection), integrity)
+	}
+
+	var queriesTable int
+
+	err = source.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'queries'").Scan(&queriesTable)
+	if err != nil {
+		return "", err
+	}
+
+	if queriesTable == 0 {
+		return "", fmt.Errorf("%s is not a query library", filepath.Base(selection))
+	}
+
+	version, err := schemaVersion(source)
+	if err != nil {
+		return "", err
+	}
+
+	if version > latestSchemaVersion() {
+		return "", fmt.Errorf("%s was saved by a newer version of the app (schema %d, this version supports %d)",
+			filepath.Base(selection), version, latestSchemaVersion())
+	}
+
+	working, err := os.CreateTemp(filepath.Dir(sqliteDatabasePath()), "import-*.db")
+	if err != nil {
+		return "", err
+	}
+	working.Close()
+
+	err = backupSqliteDatabase(selection, working.Name())
+
+	if err == nil {
+		err = migrateDatabaseFile(working.Name())
+	}
+
+	if err != nil {
+		os.Remove(working.Name())
+		return "", err
+	}
+
+	return working.Name(), nil
+}
+
+func migrateDatabaseFile(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return runMigrations(db)
+}
+
+// ImportDatabaseFile replaces the library with a database file after checking
+// that it is a valid library from this or an older version. The previous
+// library is kept next to it as a .bak file
+func (a *App) ImportDatabaseFile() error {
+	selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Select File",
+		Filters: sqliteFileFilters,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if selection == "" {
+		return fmt.Errorf("no file selected")
+	}
+
+	working, err := prepareImportedDatabase(selection)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(working)
+
+	err = backupSqliteDatabase(sqliteDatabasePath(), sqliteDatabasePath()+".bak")
+	if err != nil {
+		return fmt.Errorf("failed to back up the current library: %w", err)
+	}
+
+	return backupSqliteDatabase(working, sqliteDatabasePath())
+}
+
+// MergeDatabaseFile adds the queries of a database file to the library
+// instead of replacing it. Queries identical to one already saved are left
+// out; other title clashes are resolved with strategy: skip, overwrite or
+// keep-both
+func (a *App) MergeDatabaseFile(strategy string) (DatabaseMergeResult, error) {
+	if strategy != MergeSkip && strategy != MergeOverwrite && strategy != MergeKeepBoth {
+		return DatabaseMergeResult{}, fmt.Errorf("unknown merge strategy %q", strategy)
+	}
+
+	selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Select File",
+		Filters: sqliteFileFilters,
+	})
+
+	if err != nil {
+		return DatabaseMergeResult{}, err
+	}
+
+	if selection == "" {
+		return DatabaseMergeResult{}, fmt.Errorf("no file selected")
+	}
+
+	working, err := prepareImportedDatabase(selection)
+	if err != nil {
+		return DatabaseMergeResult{}, err
+	}
+	defer os.Remove(working)
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return mergeQueries(db, working, strategy)
+}
+
+// mergeQueries copies the active queries of the database at sourcePath into
+// db in a single transaction
+func mergeQueries(db *sql.DB, sourcePath string, strategy string) (DatabaseMergeResult, error) {
+	result := DatabaseMergeResult{Conflicts: []string{}}
+
+	source, err := sql.Open("sqlite3", readOnlySqliteDSN(sourcePath))
+	if err != nil {
+		return result, err
+	}
+	defer source.Close()
+
+	// The source is a migrated copy, so its queries are read with their
+	// folders, tags, variables and parameters as for a bundle export
+	queries, err := listQueries(source, false, QueryFilter{})
+	if err != nil {
+		return result, err
+	}
+
+	paths, err := folderPaths(source)
+	if err != nil {
+		return result, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	for _, query := range queries {
+		entry, err := bundleEntry(source, query, paths)
+		if err != nil {
+			return result, err
+		}
+
+		var createdAt sql.NullString
+		if query.CreatedAt != nil {
+			createdAt = sql.NullString{String: *query.CreatedAt, Valid: true}
+		}
+
+		id, err := mergeQuery(tx,
+			sql.NullString{String: query.Title, Valid: true},
+			sql.NullString{String: query.Query, Valid: true},
+			sql.NullString{String: query.Description, Valid: true},
+			createdAt,
+			strategy, &result)
+		if err != nil {
+			return result, err
+		}
+
+		if id == 0 {
+			continue
+		}
+
+		err = applyBundleMetadata(tx, id, entry)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+// mergeQuery adds one query to the library under strategy and counts what
+// happened in result. It returns the id of the query written, or 0 when the
+// query was left out as a duplicate or a skipped clash
+func mergeQuery(tx *sql.Tx, title, query, description, createdAt sql.NullString, strategy string, result *DatabaseMergeResult) (int, error) {
+	var existingID int
+	var existingQuery sql.NullString
+
+	err := tx.QueryRow(
+		"SELECT id, query FROM queries WHERE deleted_at IS NULL AND LOWER(TRIM(title)) = LOWER(TRIM(?)) ORDER BY id LIMIT 1",
+		title.String,
+	).Scan(&existingID, &existingQuery)
+
+	switch {
+	case err == sql.ErrNoRows:
+		// No clash
+	case err != nil:
+		return 0, err
+	case existingQuery.String == query.String:
+		result.Duplicates++
+		return 0, nil
+	case strategy == MergeSkip:
+		result.Skipped++
+		result.Conflicts = append(result.Conflicts, title.String)
+		return 0, nil
+	case strategy == MergeOverwrite:
+		_, err = tx.Exec("UPDATE queries SET query = ?, description = ?, referenced_tables = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			query, description, referencedTablesColumn(query.String), existingID)
+		if err != nil {
+			return 0, err
+		}
+
+		err = storeQueryRevision(tx, existingID, "Overwritten by an imported library")
+		if err != nil {
+			return 0, err
+		}
+
+		result.Overwritten++
+		result.Conflicts = append(result.Conflicts, title.String)
+		return existingID, nil
+	default:
+		result.Renamed++
+		result.Conflicts = append(result.Conflicts, title.String)
+
+		title.String, err = availableTitle(tx, title.String)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	inserted, err := tx.Exec("INSERT INTO queries (title, query, description, referenced_tables, created_at) VALUES (?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))",
+		title.String, query, description, referencedTablesColumn(query.String), createdAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := inserted.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = storeQueryRevision(tx, int(id), "Imported")
+	if err != nil {
+		return 0, err
+	}
+
+	result.Imported++
+
+	return int(id), nil
+}
+
+// availableTitle suffixes an imported title until no active query uses it
+func availableTitle(tx *sql.Tx, title string) (string, error) {
+	for i := 1; ; i++ {
+		candidate := strings.TrimSpace(title) + " (imported)"
+		if i > 1 {
+			candidate = fmt.Sprintf("%s (imported %d)", strings.TrimSpace(title), i)
+		}
+
+		var taken int
+
+		err := tx.QueryRow("SELECT COUNT(*) FROM queries WHERE deleted_at IS NULL AND LOWER(TRIM(title)) = LOWER(?)", candidate).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+
+		if taken == 0 {
+			return candidate, nil
+		}
+	}
+}
+
+// ExportDatabaseFile saves a consistent copy of the library, leaving the
+// live database in place
+func (a *App) ExportDatabaseFile() error {
+	selection, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:   "Save File",
+		Filters: sqliteFileFilters,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if selection == "" {
+		return fmt.Errorf("no file selected")
+	}
+
+	// Write next to the destination first so a failed copy never leaves a
+	// half-written file under the chosen name
+	working, err := os.CreateTemp(filepath.Dir(selection), "export-*.db")
+	if err != nil {
+		return err
+	}
+	working.Close()
+	defer os.Remove(working.Name())
+
+	err = backupSqliteDatabase(sqliteDatabasePath(), working.Name())
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(working.Name(), selection)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBackupAndPrepareImportedDatabase(t *testing.T) {
+	legacy := openFixtureDatabase(t)
+
+	var legacyPath string
+	if err := legacy.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&legacyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	copyPath := filepath.Join(t.TempDir(), "copy.db")
+
+	if err := backupSqliteDatabase(legacyPath, copyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	working, err := prepareImportedDatabase(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(working)
+
+	db, err := sql.Open("sqlite3", working)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if version, err := schemaVersion(db); err != nil || version != latestSchemaVersion() {
+		t.Errorf("expected the imported copy to be migrated, got version %d (%v)", version, err)
+	}
+
+	// The chosen file itself is left untouched
+	if version, err := schemaVersion(legacy); err != nil || version != 0 {
+		t.Errorf("expected the original file to stay unmigrated, got version %d (%v)", version, err)
+	}
+
+	if _, err := legacy.Exec("CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, name TEXT); INSERT INTO schema_migrations VALUES (999, 'future')"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := prepareImportedDatabase(legacyPath); err == nil {
+		t.Error("expected a database from a newer release to be rejected")
+	}
+
+	notLibrary := filepath.Join(t.TempDir(), "other.db")
+	other, _ := sql.Open("sqlite3", notLibrary)
+	other.Exec("CREATE TABLE things (id INTEGER)")
+	other.Close()
+
+	if _, err := prepareImportedDatabase(notLibrary); err == nil {
+		t.Error("expected a database without queries to be rejected")
+	}
+}
+
+func TestMergeQueries(t *testing.T) {
+	metadata := BundleQuery{
+		Folder:     "reports/monthly",
+		Tags:       []string{"daily"},
+		Variables:  []BundleVariable{{Placeholder: "id", Field: "ID", Type: VariableNumber}},
+		Parameters: []BundleParameter{{Name: "since", Type: VariableDate}},
+	}
+
+	strategies := map[string]struct {
+		result DatabaseMergeResult
+		titles []string
+	}{
+		MergeSkip:      {DatabaseMergeResult{Imported: 1, Duplicates: 1, Skipped: 1}, []string{"Insert users", "Report", "New one"}},
+		MergeOverwrite: {DatabaseMergeResult{Imported: 1, Duplicates: 1, Overwritten: 1}, []string{"Insert users", "Report", "New one"}},
+		MergeKeepBoth:  {DatabaseMergeResult{Imported: 2, Duplicates: 1, Renamed: 1}, []string{"Insert users", "Report", "report (imported)", "New one"}},
+	}
+
+	for strategy, expected := range strategies {
+		t.Run(strategy, func(t *testing.T) {
+			source := openFixtureDatabase(t)
+			_, err := source.Exec(`
+				INSERT INTO queries (title, query) VALUES ('report ', 'SELECT 2'), ('New one', 'SELECT 3');
+			`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// MergeDatabaseFile always reads a migrated copy
+			if err := runMigrations(source); err != nil {
+				t.Fatal(err)
+			}
+
+			var newID int
+			if err := source.QueryRow("SELECT id FROM queries WHERE title = 'New one'").Scan(&newID); err != nil {
+				t.Fatal(err)
+			}
+
+			tx, err := source.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = applyBundleMetadata(tx, newID, metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			// A ? or # in the path must not cut it short
+			sourcePath := filepath.Join(t.TempDir(), "shared?v=2#copy.db")
+			if _, err := source.Exec("VACUUM INTO ?", sourcePath); err != nil {
+				t.Fatal(err)
+			}
+
+			library := openFixtureDatabase(t)
+			if err := runMigrations(library); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := library.Exec("INSERT INTO queries (title, query) VALUES ('Report', 'SELECT 1')"); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := mergeQueries(library, sourcePath, strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.Imported != expected.result.Imported || result.Duplicates != expected.result.Duplicates ||
+				result.Skipped != expected.result.Skipped || result.Overwritten != expected.result.Overwritten ||
+				result.Renamed != expected.result.Renamed {
+				t.Errorf("unexpected result %+v", result)
+			}
+
+			if len(result.Conflicts) != 1 || result.Conflicts[0] != "report " {
+				t.Errorf("expected the report clash to be reported, got %v", result.Conflicts)
+			}
+
+			rows, err := library.Query("SELECT title FROM queries WHERE deleted_at IS NULL ORDER BY id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+
+			titles := []string{}
+			for rows.Next() {
+				var title string
+				rows.Scan(&title)
+				titles = append(titles, title)
+			}
+
+			if len(titles) != len(expected.titles) {
+				t.Fatalf("expected titles %v, got %v", expected.titles, titles)
+			}
+
+			for i := range titles {
+				if titles[i] != expected.titles[i] {
+					t.Errorf("expected titles %v, got %v", expected.titles, titles)
+					break
+				}
+			}
+
+			var report string
+			library.QueryRow("SELECT query FROM queries WHERE title = 'Report'").Scan(&report)
+
+			if (strategy == MergeOverwrite) != (report == "SELECT 2") {
+				t.Errorf("unexpected query %q after %s", report, strategy)
+			}
+
+			bundle, err := buildQueryBundle(library, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			merged := bundle.Queries[len(bundle.Queries)-1]
+			expected := metadata
+			expected.Title, expected.Query = "New one", "SELECT 3"
+
+			if !reflect.DeepEqual(merged, expected) {
+				t.Errorf("expected the folder, tags, variables and parameters to be merged, got %+v", merged)
+			}
+		})
+	}
+}
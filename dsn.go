@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TLS modes follow the vocabulary of the mysql client's --ssl-mode option
+const (
+	TLSModeDisabled       = "disabled"
+	TLSModePreferred      = "preferred"
+	TLSModeRequired       = "required"
+	TLSModeVerifyCA       = "verify-ca"
+	TLSModeVerifyIdentity = "verify-identity"
+)
+
+// reservedDSNParams are configured through dedicated DatabaseConnection fields
+var reservedDSNParams = map[string]bool{
+	"tls":                      true,
+	"allowFallbackToPlaintext": true,
+}
+
+// ValidateDatabaseConnection checks the connection's SSH, TLS and DSN options
+// without opening a connection
+func (a *App) ValidateDatabaseConnection(input DatabaseConnection) error {
+	err := validateSSHOptions(input)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConfig(input)
+
+	return err
+}
+
+// mysqlConfig builds the driver configuration for a connection profile. The
+// credentials are set on the config directly instead of being formatted into
+// a DSN string, so passwords containing '@', '/' or '?' need no escaping
+func mysqlConfig(input DatabaseConnection) (*mysql.Config, error) {
+	params := url.Values{}
+
+	for key, value := range input.Params {
+		key = strings.TrimSpace(key)
+
+		if key == "" {
+			return nil, fmt.Errorf("DSN parameter names cannot be empty")
+		}
+
+		if reservedDSNParams[key] {
+			return nil, fmt.Errorf("DSN parameter %q is controlled by the TLS mode", key)
+		}
+
+		params.Set(key, value)
+	}
+
+	tlsConfig, tlsName, err := buildTLSConfig(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the driver parse and validate the parameters the same way it would
+	// for a hand-written DSN
+	cfg, err := mysql.ParseDSN("/?" + params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection parameters: %w", err)
+	}
+
+	if tlsConfig != nil {
+		// The config is handed to the driver directly, so nothing is added to
+		// its global TLS registry. The name only shows up in FormatDSN, where
+		// it makes changed TLS options or certificates replace the pool
+		cfg.TLS = tlsConfig
+		cfg.TLSConfig = tlsName
+		cfg.AllowFallbackToPlaintext = normalizeTLSMode(input.TLSMode) == TLSModePreferred
+	}
+
+	cfg.User = input.Username
+	cfg.Passwd = input.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(input.Host, strconv.Itoa(input.Port))
+	cfg.DBName = input.Database
+
+	return cfg, nil
+}
+
+// normalizeTLSMode accepts TLS modes in any case and with stray spaces
+func normalizeTLSMode(mode string) string {
+	return strings.ToLower(strings.TrimSpace(mode))
+}
+
+// buildTLSConfig returns nil when TLS is disabled. The name it returns
+// covers the mode, the paths and the contents of the certificate files, so a
+// certificate rotated in place gets a new name too
+func buildTLSConfig(input DatabaseConnection) (*tls.Config, string, error) {
+	mode := normalizeTLSMode(input.TLSMode)
+
+	switch mode {
+	case "", TLSModeDisabled:
+		if input.TLSCAPath != "" || input.TLSCertPath != "" || input.TLSKeyPath != "" {
+			return nil, "", fmt.Errorf("TLS certificates are set but the TLS mode is disabled")
+		}
+
+		return nil, "", nil
+	case TLSModePreferred, TLSModeRequired, TLSModeVerifyCA, TLSModeVerifyIdentity:
+	default:
+		return nil, "", fmt.Errorf("unknown TLS mode %q", input.TLSMode)
+	}
+
+	name := sha1.New()
+	for _, part := range []string{profileKey(input), mode, input.TLSCAPath, input.TLSCertPath, input.TLSKeyPath} {
+		name.Write([]byte(part + "\x00"))
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if (input.TLSCertPath == "") != (input.TLSKeyPath == "") {
+		return nil, "", fmt.Errorf("client certificate and key must be provided together")
+	}
+
+	if input.TLSCertPath != "" {
+		certPEM, err := os.ReadFile(input.TLSCertPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load client certificate: %w", err)
+		}
+
+		keyPEM, err := os.ReadFile(input.TLSKeyPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load client certificate: %w", err)
+		}
+
+		certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load client certificate: %w", err)
+		}
+
+		name.Write(certPEM)
+		name.Write(keyPEM)
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	if input.TLSCAPath != "" {
+		pem, err := os.ReadFile(input.TLSCAPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, "", fmt.Errorf("no PEM certificates found in %s", input.TLSCAPath)
+		}
+
+		name.Write(pem)
+		config.RootCAs = pool
+	}
+
+	switch mode {
+	case TLSModePreferred, TLSModeRequired:
+		// Encrypt without verifying the server, like the mysql client does
+		config.InsecureSkipVerify = true
+	case TLSModeVerifyCA:
+		// Verify the chain but not the host name, which managed databases
+		// often don't put in their certificates
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyChainOnly(config.RootCAs)
+	case TLSModeVerifyIdentity:
+		config.ServerName = input.Host
+	}
+
+	return config, "profile-" + hex.EncodeToString(name.Sum(nil)[:8]), nil
+}
+
+func verifyChainOnly(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("server presented no certificate")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+
+		return err
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestMySQLConfigKeepsSpecialCharactersInCredentials(t *testing.T) {
+	input := DatabaseConnection{Username: "app@shop", Password: `p@ss/w?rd:#%&\`, Host: "db.internal", Port: 3307, Database: "shop"}
+
+	cfg, err := mysqlConfig(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.User != input.Username || cfg.Passwd != input.Password || cfg.Addr != "db.internal:3307" || cfg.DBName != "shop" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	// The formatted DSN, used to tell pools apart, reads back the same
+	parsed, err := mysql.ParseDSN(cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.User != input.Username || parsed.Passwd != input.Password {
+		t.Errorf("credentials did not survive the DSN: %q %q", parsed.User, parsed.Passwd)
+	}
+
+	input.Host = "::1"
+
+	if cfg, err := mysqlConfig(input); err != nil || cfg.Addr != "[::1]:3307" {
+		t.Errorf("expected an IPv6 address in brackets, got %v (%v)", cfg, err)
+	}
+}
+
+func TestMySQLConfigParams(t *testing.T) {
+	cfg, err := mysqlConfig(DatabaseConnection{Host: "db", Port: 3306, Params: map[string]string{"parseTime": "true", " charset ": "utf8mb4", "timeout": "5s"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cfg.ParseTime || cfg.Timeout.Seconds() != 5 || cfg.Params["charset"] != "utf8mb4" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	failures := map[string]map[string]string{
+		"cannot be empty":          {" ": "x"},
+		"controlled by the TLS":    {"tls": "skip-verify"},
+		"invalid connection":       {"parseTime": "maybe"},
+		"allowFallbackToPlaintext": {"allowFallbackToPlaintext": "true"},
+	}
+
+	for message, params := range failures {
+		_, err := mysqlConfig(DatabaseConnection{Host: "db", Port: 3306, Params: params})
+
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%v: expected an error about %q, got %v", params, message, err)
+		}
+	}
+}
+
+func TestMySQLConfigTLSModes(t *testing.T) {
+	id := 7
+	input := DatabaseConnection{ID: &id, Host: "db.example.com", Port: 3306, TLSMode: " Preferred "}
+
+	cfg, err := mysqlConfig(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.TLS == nil || !cfg.TLS.InsecureSkipVerify || !cfg.AllowFallbackToPlaintext {
+		t.Errorf("expected preferred to encrypt without verifying and allow plaintext, got %+v", cfg)
+	}
+
+	// Validation leaves the driver's TLS registry alone
+	if _, err := mysql.ParseDSN("/?tls=" + cfg.TLSConfig); err == nil {
+		t.Errorf("expected %s not to be registered with the driver", cfg.TLSConfig)
+	}
+
+	input.TLSMode = "REQUIRED"
+
+	required, err := mysqlConfig(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if required.AllowFallbackToPlaintext || required.TLSConfig == cfg.TLSConfig || required.FormatDSN() == cfg.FormatDSN() {
+		t.Errorf("expected required to refuse plaintext and format differently, got %+v", required)
+	}
+
+	input.TLSMode = TLSModeVerifyIdentity
+
+	if cfg, err := mysqlConfig(input); err != nil || cfg.TLS.InsecureSkipVerify || cfg.TLS.ServerName != "db.example.com" {
+		t.Errorf("expected verify-identity to check the host name, got %+v (%v)", cfg, err)
+	}
+
+	if cfg, err := mysqlConfig(DatabaseConnection{Host: "db", Port: 3306, TLSMode: TLSModeDisabled}); err != nil || cfg.TLS != nil || cfg.TLSConfig != "" {
+		t.Errorf("expected no TLS when disabled, got %+v (%v)", cfg, err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+
+	failures := []struct {
+		input   DatabaseConnection
+		message string
+	}{
+		{DatabaseConnection{TLSMode: "sometimes"}, "unknown TLS mode"},
+		{DatabaseConnection{TLSMode: TLSModeDisabled, TLSCAPath: missing}, "TLS mode is disabled"},
+		{DatabaseConnection{TLSMode: TLSModeRequired, TLSCertPath: missing}, "must be provided together"},
+		{DatabaseConnection{TLSMode: TLSModeVerifyCA, TLSCAPath: missing}, "failed to read CA certificate"},
+	}
+
+	for _, f := range failures {
+		_, err := mysqlConfig(f.input)
+
+		if err == nil || !strings.Contains(err.Error(), f.message) {
+			t.Errorf("%+v: expected an error about %q, got %v", f.input, f.message, err)
+		}
+	}
+}
+
+// writeTestCA writes a fresh self-signed CA certificate to path
+func writeTestCA(t *testing.T, path string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMySQLConfigFollowsRotatedCertificates(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	writeTestCA(t, ca)
+
+	id := 7
+	input := DatabaseConnection{ID: &id, Host: "db.example.com", Port: 3306, TLSMode: TLSModeVerifyCA, TLSCAPath: ca}
+
+	before, err := mysqlConfig(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := mysqlConfig(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.FormatDSN() != before.FormatDSN() {
+		t.Error("expected unchanged certificates to keep the DSN")
+	}
+
+	// Replacing the CA at the same path opens a new pool
+	writeTestCA(t, ca)
+
+	rotated, err := mysqlConfig(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rotated.FormatDSN() == before.FormatDSN() {
+		t.Error("expected a rotated CA certificate to change the DSN")
+	}
+}
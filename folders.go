@@ -0,0 +1,415 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Folder groups saved queries; folders nest through ParentID
+type Folder struct {
+	ID         int
+	Name       string
+	ParentID   *int
+	QueryCount int
+	CreatedAt  *string
+}
+
+// Tag labels saved queries; a query can have any number of tags
+type Tag struct {
+	ID         int
+	Name       string
+	QueryCount int
+	CreatedAt  *string
+}
+
+// GetFolders returns every folder, parents before their children
+func (a *App) GetFolders() ([]Folder, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	folders := make([]Folder, 0)
+
+	rows, err := db.Query(`
+		WITH RECURSIVE tree(id, path) AS (
+			SELECT id, name FROM folders WHERE parent_id IS NULL
+			UNION ALL
+			SELECT folders.id, tree.path || '/' || folders.name FROM folders JOIN tree ON folders.parent_id = tree.id
+		)
+		SELECT folders.id, folders.name, folders.parent_id, folders.created_at,
+			(SELECT COUNT(*) FROM queries WHERE queries.folder_id = folders.id AND queries.deleted_at IS NULL)
+		FROM tree JOIN folders ON folders.id = tree.id
+		ORDER BY tree.path COLLATE NOCASE
+	`)
+	if err != nil {
+		return folders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var folder Folder
+
+		err = rows.Scan(&folder.ID, &folder.Name, &folder.ParentID, &folder.CreatedAt, &folder.QueryCount)
+		if err != nil {
+			return folders, err
+		}
+
+		folders = append(folders, folder)
+	}
+
+	return folders, rows.Err()
+}
+
+// CreateFolder adds a folder under parentID, or at the top level when nil
+func (a *App) CreateFolder(name string, parentID *int) (int, error) {
+	name, err := folderName(name)
+	if err != nil {
+		return 0, err
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	if parentID != nil {
+		err = folderExists(db, *parentID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := db.Exec("INSERT INTO folders (name, parent_id) VALUES (?, ?)", name, parentID)
+	if err != nil {
+		return 0, folderNameError(err, fmt.Sprintf("named %q", name))
+	}
+
+	id, err := result.LastInsertId()
+
+	return int(id), err
+}
+
+// RenameFolder changes the name of a folder
+func (a *App) RenameFolder(id int, name string) error {
+	name, err := folderName(name)
+	if err != nil {
+		return err
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE folders SET name = ? WHERE id = ?", name, id)
+	if err != nil {
+		return folderNameError(err, fmt.Sprintf("named %q", name))
+	}
+
+	return expectAffected(result, "folder not found")
+}
+
+// MoveFolder moves a folder, with its queries and subfolders, under parentID
+func (a *App) MoveFolder(id int, parentID *int) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	if parentID != nil {
+		var cycle int
+
+		err := db.QueryRow(`
+			WITH RECURSIVE ancestors(id) AS (
+				SELECT ?
+				UNION SELECT folders.parent_id FROM folders JOIN ancestors ON folders.id = ancestors.id WHERE folders.parent_id IS NOT NULL
+			)
+			SELECT COUNT(*) FROM ancestors WHERE id = ?
+		`, *parentID, id).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+
+		if cycle > 0 {
+			return fmt.Errorf("a folder cannot be moved into itself")
+		}
+
+		err = folderExists(db, *parentID)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := db.Exec("UPDATE folders SET parent_id = ? WHERE id = ?", parentID, id)
+	if err != nil {
+		return folderNameError(err, "with this name")
+	}
+
+	return expectAffected(result, "folder not found")
+}
+
+// DeleteFolder removes a folder. Its queries and subfolders move up to the
+// folder's parent so nothing saved is lost
+func (a *App) DeleteFolder(id int) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID *int
+
+	err = tx.QueryRow("SELECT parent_id FROM folders WHERE id = ?", id).Scan(&parentID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("folder not found")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE queries SET folder_id = ? WHERE folder_id = ?", parentID, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE folders SET parent_id = ? WHERE parent_id = ?", parentID, id)
+	if err != nil {
+		return fmt.Errorf("a subfolder has the same name as a folder it would move next to: %w", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM folders WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MoveQueryToFolder files a query in a folder, or at the top level when nil
+func (a *App) MoveQueryToFolder(queryID int, folderID *int) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	if folderID != nil {
+		err := folderExists(db, *folderID)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := db.Exec("UPDATE queries SET folder_id = ? WHERE id = ?", folderID, queryID)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, "query not found")
+}
+
+// GetTags returns every tag with the number of active queries using it
+func (a *App) GetTags() ([]Tag, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	tags := make([]Tag, 0)
+
+	rows, err := db.Query(`
+		SELECT tags.id, tags.name, tags.created_at, COUNT(queries.id)
+		FROM tags
+		LEFT JOIN query_tags ON query_tags.tag_id = tags.id
+		LEFT JOIN queries ON queries.id = query_tags.query_id AND queries.deleted_at IS NULL
+		GROUP BY tags.id
+		ORDER BY tags.name COLLATE NOCASE
+	`)
+	if err != nil {
+		return tags, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag Tag
+
+		err = rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt, &tag.QueryCount)
+		if err != nil {
+			return tags, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// SetQueryTags replaces the tags of a query, creating new tags as needed
+func (a *App) SetQueryTags(queryID int, tags []string) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+
+	err = tx.QueryRow("SELECT COUNT(*) FROM queries WHERE id = ?", queryID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		return fmt.Errorf("query not found")
+	}
+
+	err = setQueryTags(tx, queryID, tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setQueryTags(tx *sql.Tx, queryID int, tags []string) error {
+	_, err := tx.Exec("DELETE FROM query_tags WHERE query_id = ?", queryID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "" {
+			continue
+		}
+
+		_, err = tx.Exec("INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING", tag)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT OR IGNORE INTO query_tags (query_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", queryID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RenameTag changes the name of a tag on every query. Renaming to the name
+// of another tag merges the two
+func (a *App) RenameTag(id int, name string) error {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return fmt.Errorf("the tag name is required")
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existing int
+
+	err = tx.QueryRow("SELECT id FROM tags WHERE name = ? AND id != ?", name, id).Scan(&existing)
+
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := tx.Exec("UPDATE tags SET name = ? WHERE id = ?", name, id)
+		if err != nil {
+			return err
+		}
+
+		err = expectAffected(result, "tag not found")
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		_, err = tx.Exec("INSERT OR IGNORE INTO query_tags (query_id, tag_id) SELECT query_id, ? FROM query_tags WHERE tag_id = ?", existing, id)
+		if err != nil {
+			return err
+		}
+
+		err = deleteTag(tx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTag removes a tag from every query
+func (a *App) DeleteTag(id int) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = deleteTag(tx, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func deleteTag(tx *sql.Tx, id int) error {
+	_, err := tx.Exec("DELETE FROM query_tags WHERE tag_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM tags WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, "tag not found")
+}
+
+func folderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return "", fmt.Errorf("the folder name is required")
+	}
+
+	if strings.Contains(name, "/") {
+		return "", fmt.Errorf("folder names cannot contain /")
+	}
+
+	return name, nil
+}
+
+func folderNameError(err error, description string) error {
+	if strings.Contains(err.Error(), "UNIQUE") {
+		return fmt.Errorf("a folder %s already exists here", description)
+	}
+
+	return err
+}
+
+func folderExists(db *sql.DB, id int) error {
+	var exists int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM folders WHERE id = ?", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		return fmt.Errorf("folder not found")
+	}
+
+	return nil
+}
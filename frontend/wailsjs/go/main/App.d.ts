@@ -22,7 +22,7 @@ export function GetDatabaseStructure(arg1:main.DatabaseConnection):Promise<strin
 
 export function GetLatestDatabaseStructure():Promise<string>;
 
-export function GetQueriesList(arg1:boolean):Promise<Array<main.Query>>;
+export function GetQueriesList(arg1:boolean,arg2:main.QueryFilter):Promise<Array<main.Query>>;
 
 export function ImportDatabaseFile():Promise<void>;
 
@@ -42,8 +42,8 @@ export function GetLatestDatabaseStructure() {
   return window['go']['main']['App']['GetLatestDatabaseStructure']();
 }
 
-export function GetQueriesList(arg1) {
-  return window['go']['main']['App']['GetQueriesList'](arg1);
+export function GetQueriesList(arg1, arg2) {
+  return window['go']['main']['App']['GetQueriesList'](arg1, arg2);
 }
 
 export function ImportDatabaseFile() {
@@ -52,6 +52,32 @@ export namespace main {
 	        this.DeletedAt = source["DeletedAt"];
 	    }
 	}
+	export class QueryFilter {
+	    FolderID?: number;
+	    IncludeSubfolders: boolean;
+	    Tags: string[];
+	    Search: string;
+	    Sort: string;
+	    Descending: boolean;
+	    Limit: number;
+	    Offset: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new QueryFilter(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.FolderID = source["FolderID"];
+	        this.IncludeSubfolders = source["IncludeSubfolders"];
+	        this.Tags = source["Tags"];
+	        this.Search = source["Search"];
+	        this.Sort = source["Sort"];
+	        this.Descending = source["Descending"];
+	        this.Limit = source["Limit"];
+	        this.Offset = source["Offset"];
+	    }
+	}
 	export class Variable {
 	    Field: string;
 	    Value: string;
@@ -2,6 +2,8 @@ package main
 
 import (
 	"embed"
+	"log"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -12,11 +14,16 @@ import (
 var assets embed.FS
 
 func main() {
+	err := configureStorage(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Create an instance of the app structure
 	app := NewApp()
 
 	// Create application with options
-	err := wails.Run(&options.App{
+	err = wails.Run(&options.App{
 		Title:  "Sql Script Maker",
 		Width:  1024,
 		Height: 768,
@@ -25,6 +32,7 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 30, G: 41, B: 57, A: 1},
 		OnStartup:        app.startup,
+		OnShutdown:       app.shutdown,
 		Bind: []interface{}{
 			app,
 		},
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// migration is one step of the local database schema. Migrations run in
+// version order, each in its own transaction, and must be idempotent so that
+// databases upgraded by the ad-hoc column checks of earlier releases migrate
+// cleanly
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change of the local database. New
+// migrations are appended with the next version; released ones never change
+var migrations = []migration{
+	{1, "create base tables", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS queries (
+				id integer NOT NULL PRIMARY KEY,
+				title TEXT,
+				query TEXT,
+				description TEXT DEFAULT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				deleted_at TIMESTAMP DEFAULT NULL
+			);
+
+			CREATE TABLE IF NOT EXISTS database_connections (
+				id integer NOT NULL PRIMARY KEY,
+				username TEXT,
+				password TEXT,
+				host TEXT,
+				port INTEGER,
+				database TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				deleted_at TIMESTAMP DEFAULT NULL
+			);
+
+			CREATE TABLE IF NOT EXISTS database_structure (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				structure TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+		`)
+
+		return err
+	}},
+	{2, "add connection TLS and DSN options", func(tx *sql.Tx) error {
+		return addMissingColumns(tx, "database_connections", []string{
+			"tls_mode TEXT NOT NULL DEFAULT ''",
+			"tls_ca_path TEXT NOT NULL DEFAULT ''",
+			"tls_cert_path TEXT NOT NULL DEFAULT ''",
+			"tls_key_path TEXT NOT NULL DEFAULT ''",
+			"params TEXT DEFAULT NULL",
+		})
+	}},
+	{3, "add connection SSH tunnel options", func(tx *sql.Tx) error {
+		return addMissingColumns(tx, "database_connections", []string{
+			"ssh_enabled INTEGER NOT NULL DEFAULT 0",
+			"ssh_host TEXT NOT NULL DEFAULT ''",
+			"ssh_port INTEGER NOT NULL DEFAULT 22",
+			"ssh_user TEXT NOT NULL DEFAULT ''",
+			"ssh_key_path TEXT NOT NULL DEFAULT ''",
+			"ssh_key_passphrase TEXT NOT NULL DEFAULT ''",
+			"ssh_use_agent INTEGER NOT NULL DEFAULT 0",
+			"ssh_known_hosts_path TEXT NOT NULL DEFAULT ''",
+		})
+	}},
+	{4, "scope schema snapshots to connections", func(tx *sql.Tx) error {
+		err := addMissingColumns(tx, "database_structure", []string{
+			"connection_id INTEGER DEFAULT NULL",
+			"source TEXT NOT NULL DEFAULT ''",
+			"label TEXT NOT NULL DEFAULT ''",
+			"content_hash TEXT NOT NULL DEFAULT ''",
+			"table_count INTEGER NOT NULL DEFAULT 0",
+		})
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS database_structure_connection_index ON database_structure (connection_id, source, created_at)`)
+		if err != nil {
+			return err
+		}
+
+		// Snapshots taken before they were scoped belong to the saved
+		// connection, the only one there was, with the source it points at
+		_, err = tx.Exec(`
+			UPDATE database_structure SET
+				connection_id = (SELECT id FROM database_connections LIMIT 1),
+				source = (SELECT COALESCE(host, '') || ':' || COALESCE(port, 0) || '/' || COALESCE(database, '') FROM database_connections LIMIT 1)
+			WHERE connection_id IS NULL AND source = ''
+			AND EXISTS (SELECT 1 FROM database_connections)
+		`)
+
+		return err
+	}},
+	{5, "add query folders and tags", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS folders (
+				id INTEGER NOT NULL PRIMARY KEY,
+				name TEXT NOT NULL,
+				parent_id INTEGER DEFAULT NULL REFERENCES folders (id),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE UNIQUE INDEX IF NOT EXISTS folders_name_index ON folders (COALESCE(parent_id, 0), name COLLATE NOCASE);
+
+			CREATE TABLE IF NOT EXISTS tags (
+				id INTEGER NOT NULL PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE TABLE IF NOT EXISTS query_tags (
+				query_id INTEGER NOT NULL REFERENCES queries (id),
+				tag_id INTEGER NOT NULL REFERENCES tags (id),
+				PRIMARY KEY (query_id, tag_id)
+			);
+
+			CREATE INDEX IF NOT EXISTS query_tags_tag_index ON query_tags (tag_id);
+		`)
+
+		if err != nil {
+			return err
+		}
+
+		err = addMissingColumns(tx, "queries", []string{
+			"folder_id INTEGER DEFAULT NULL REFERENCES folders (id)",
+		})
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS queries_folder_index ON queries (folder_id)`)
+
+		return err
+	}},
+	{6, "record the tables each query references", func(tx *sql.Tx) error {
+		err := addMissingColumns(tx, "queries", []string{
+			"referenced_tables TEXT NOT NULL DEFAULT ''",
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return backfillReferencedTables(tx)
+	}},
+	{7, "add query revisions", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS query_revisions (
+				id INTEGER NOT NULL PRIMARY KEY,
+				query_id INTEGER NOT NULL REFERENCES queries (id),
+				title TEXT,
+				query TEXT,
+				description TEXT DEFAULT NULL,
+				note TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE INDEX IF NOT EXISTS query_revisions_query_index ON query_revisions (query_id, id);
+		`)
+
+		return err
+	}},
+	{8, "add settings", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS settings (
+				key TEXT NOT NULL PRIMARY KEY,
+				value TEXT NOT NULL,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE INDEX IF NOT EXISTS queries_deleted_index ON queries (deleted_at);
+		`)
+
+		return err
+	}},
+	{9, "add query templates", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS query_variables (
+				id INTEGER NOT NULL PRIMARY KEY,
+				query_id INTEGER NOT NULL REFERENCES queries (id),
+				position INTEGER NOT NULL DEFAULT 0,
+				field TEXT NOT NULL DEFAULT '',
+				placeholder TEXT NOT NULL,
+				type TEXT NOT NULL DEFAULT 'raw',
+				default_value TEXT NOT NULL DEFAULT ''
+			);
+
+			CREATE INDEX IF NOT EXISTS query_variables_query_index ON query_variables (query_id, position);
+		`)
+
+		if err != nil {
+			return err
+		}
+
+		return addMissingColumns(tx, "queries", []string{
+			"data_source TEXT NOT NULL DEFAULT ''",
+		})
+	}},
+	{10, "add shared library files", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS shared_library_files (
+				path TEXT NOT NULL PRIMARY KEY,
+				query_id INTEGER NOT NULL REFERENCES queries (id),
+				file_hash TEXT NOT NULL,
+				query_hash TEXT NOT NULL,
+				synced_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE UNIQUE INDEX IF NOT EXISTS shared_library_files_query_index ON shared_library_files (query_id);
+		`)
+
+		return err
+	}},
+	{11, "add query parameters", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS query_parameters (
+				id INTEGER NOT NULL PRIMARY KEY,
+				query_id INTEGER NOT NULL REFERENCES queries (id),
+				position INTEGER NOT NULL DEFAULT 0,
+				name TEXT NOT NULL,
+				type TEXT NOT NULL DEFAULT 'string',
+				default_value TEXT NOT NULL DEFAULT '',
+				allowed_values TEXT NOT NULL DEFAULT ''
+			);
+
+			CREATE INDEX IF NOT EXISTS query_parameters_query_index ON query_parameters (query_id, position);
+		`)
+
+		return err
+	}},
+	{12, "recompute the tables each query references", func(tx *sql.Tx) error {
+		// Earlier versions took ON DUPLICATE KEY UPDATE columns and the FROM
+		// of calls such as EXTRACT for tables
+		_, err := tx.Exec("UPDATE queries SET referenced_tables = ''")
+		if err != nil {
+			return err
+		}
+
+		return backfillReferencedTables(tx)
+	}},
+}
+
+// latestSchemaVersion is the version a fully migrated database is at
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrateSqliteDatabase brings the local database up to date at startup
+func migrateSqliteDatabase() {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	err := runMigrations(db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runMigrations applies every migration the database has not seen yet
+func runMigrations(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+
+	if err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if current > latestSchemaVersion() {
+		return fmt.Errorf("the database is at schema version %d, newer than this version of the app supports (%d)", current, latestSchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		err = applyMigration(db, m)
+
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+
+	// The search index depends on how the app was built rather than on the
+	// schema version, so it is checked on every start
+	return ensureQuerySearchIndex(db)
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.up(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// schemaVersion returns the highest migration applied to the database, or 0
+// for a database that predates schema_migrations
+func schemaVersion(db *sql.DB) (int, error) {
+	var exists int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&exists)
+	if err != nil || exists == 0 {
+		return 0, err
+	}
+
+	var version int
+
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+
+	return version, err
+}
+
+// sqliteExecutor is implemented by both *sql.DB and *sql.Tx
+type sqliteExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// addMissingColumns adds each column definition whose column is not yet in the table
+func addMissingColumns(db sqliteExecutor, table string, definitions []string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk)
+
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		existing[name] = true
+	}
+
+	rows.Close()
+
+	for _, definition := range definitions {
+		name := strings.Fields(definition)[0]
+
+		if existing[name] {
+			continue
+		}
+
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, definition))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openFixtureDatabase creates a database as released before migrations existed
+func openFixtureDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "database.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	fixture, err := os.ReadFile(filepath.Join("testdata", "database_v0.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(string(fixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func tableColumns(t *testing.T, db *sql.DB, table string) map[string]bool {
+	t.Helper()
+
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		columns[name] = true
+	}
+
+	return columns
+}
+
+func TestMigrationsUpgradeFixture(t *testing.T) {
+	db := openFixtureDatabase(t)
+
+	if err := runMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != latestSchemaVersion() {
+		t.Fatalf("expected schema version %d, got %d", latestSchemaVersion(), version)
+	}
+
+	for _, column := range []string{"tls_mode", "params", "ssh_enabled", "ssh_known_hosts_path"} {
+		if !tableColumns(t, db, "database_connections")[column] {
+			t.Errorf("expected database_connections.%s to exist", column)
+		}
+	}
+
+	for _, column := range []string{"connection_id", "source", "label", "content_hash", "table_count"} {
+		if !tableColumns(t, db, "database_structure")[column] {
+			t.Errorf("expected database_structure.%s to exist", column)
+		}
+	}
+
+	var title string
+	var sshPort int
+
+	if err := db.QueryRow("SELECT title FROM queries WHERE id = 1").Scan(&title); err != nil || title != "Insert users" {
+		t.Errorf("expected the saved query to survive, got %q (%v)", title, err)
+	}
+
+	if err := db.QueryRow("SELECT ssh_port FROM database_connections WHERE id = 1").Scan(&sshPort); err != nil || sshPort != 22 {
+		t.Errorf("expected existing connections to get the default SSH port, got %d (%v)", sshPort, err)
+	}
+
+	var connectionID int
+	var source string
+
+	if err := db.QueryRow("SELECT connection_id, source FROM database_structure").Scan(&connectionID, &source); err != nil || connectionID != 1 || source != "localhost:3306/shop" {
+		t.Errorf("expected the old snapshot to be scoped to the saved connection, got %d %q (%v)", connectionID, source, err)
+	}
+
+	// A second run finds nothing left to do
+	if err := runMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var applied int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil || applied != len(migrations) {
+		t.Errorf("expected %d recorded migrations, got %d (%v)", len(migrations), applied, err)
+	}
+}
+
+func TestEachMigrationIsIdempotent(t *testing.T) {
+	for i, m := range migrations {
+		t.Run(m.name, func(t *testing.T) {
+			db := openFixtureDatabase(t)
+
+			if _, err := db.Exec(`CREATE TABLE schema_migrations (version INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, previous := range migrations[:i] {
+				if err := applyMigration(db, previous); err != nil {
+					t.Fatalf("migration %d: %v", previous.version, err)
+				}
+			}
+
+			if err := applyMigration(db, m); err != nil {
+				t.Fatal(err)
+			}
+
+			// Databases patched by older releases may already hold the changes
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			if err := m.up(tx); err != nil {
+				t.Errorf("running migration %d twice failed: %v", m.version, err)
+			}
+		})
+	}
+}
+
+func TestMigrationsRejectNewerDatabase(t *testing.T) {
+	db := openFixtureDatabase(t)
+
+	if err := runMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, 'from the future')", latestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runMigrations(db); err == nil {
+		t.Error("expected a database from a newer release to be rejected")
+	}
+}
+
+func TestMigrationVersionsAreOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Fatalf("migration %q has version %d, expected %d", m.name, m.version, i+1)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// parameterTypes are the types a QueryParameter can have. Unlike spreadsheet
+// variables there is no raw type, since values are never spliced into SQL
+var parameterTypes = map[string]bool{
+	VariableString:  true,
+	VariableNumber:  true,
+	VariableDate:    true,
+	VariableBoolean: true,
+}
+
+// QueryParameter describes a :name or ? parameter of a query, which is
+// asked for when the query runs and sent to the server separately from the
+// SQL. Positional parameters are named after their position, from "1".
+// When AllowedValues is set the value has to be one of them
+type QueryParameter struct {
+	Name          string
+	Type          string
+	Default       string
+	AllowedValues []string
+	Position      int
+}
+
+// parsedQuery is a query with every parameter replaced by the ? the driver
+// expects. Names holds the parameter at each ?, in order, so a named
+// parameter used twice appears twice
+type parsedQuery struct {
+	SQL   string
+	Names []string
+}
+
+// parseQueryParameters finds the :name and ? parameters of a query.
+// Parameters inside quotes, comments and {{ }} placeholders are left alone,
+// as are :: casts. Mixing both styles is an error
+func parseQueryParameters(query string) (parsedQuery, error) {
+	parsed := parsedQuery{Names: []string{}}
+	runes := []rune(query)
+
+	var out strings.Builder
+	named, positional := false, 0
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := rune(0)
+
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		start := i
+
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\\' && r != '`' {
+					i++
+				} else if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						i++
+					} else {
+						break
+					}
+				}
+			}
+		case r == '#' || r == '-' && next == '-' && (i+2 >= len(runes) || unicode.IsSpace(runes[i+2])):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+			i--
+		case r == '/' && next == '*':
+			i = skipPast(runes, i+2, "*/")
+		case r == '{' && next == '{':
+			i = skipPast(runes, i+2, "}}")
+		case r == ':' && next == ':':
+			i++
+		case r == ':' && (unicode.IsLetter(next) || next == '_') && (i == 0 || !isWordRune(runes[i-1])):
+			end := i + 1
+			for end < len(runes) && isWordRune(runes[end]) {
+				end++
+			}
+
+			named = true
+			parsed.Names = append(parsed.Names, string(runes[i+1:end]))
+			out.WriteRune('?')
+			i = end - 1
+
+			continue
+		case r == '?':
+			positional++
+			parsed.Names = append(parsed.Names, strconv.Itoa(positional))
+			out.WriteRune('?')
+
+			continue
+		}
+
+		if i >= len(runes) {
+			i = len(runes) - 1
+		}
+
+		out.WriteString(string(runes[start : i+1]))
+	}
+
+	if named && positional > 0 {
+		return parsed, fmt.Errorf("use either :name or ? parameters in a query, not both")
+	}
+
+	parsed.SQL = out.String()
+
+	return parsed, nil
+}
+
+// skipPast returns the index of the last rune of the first closing at or
+// after from, or of the last rune when it is never closed
+func skipPast(runes []rune, from int, closing string) int {
+	for i := from; i+len(closing) <= len(runes); i++ {
+		if string(runes[i:i+len(closing)]) == closing {
+			return i + len(closing) - 1
+		}
+	}
+
+	return len(runes) - 1
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// describeQueryParameters lists the parameters of a query in order of first
+// use, with the saved metadata of each. Parameters without metadata are
+// strings, and metadata of parameters no longer in the query is dropped
+func describeQueryParameters(query string, saved []QueryParameter) ([]QueryParameter, error) {
+	parameters := []QueryParameter{}
+
+	parsed, err := parseQueryParameters(query)
+	if err != nil {
+		return parameters, err
+	}
+
+	known := make(map[string]QueryParameter, len(saved))
+	for _, parameter := range saved {
+		known[parameter.Name] = parameter
+	}
+
+	seen := make(map[string]bool)
+
+	for _, name := range parsed.Names {
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		parameter, ok := known[name]
+		if !ok {
+			parameter = QueryParameter{Name: name, Type: VariableString}
+		}
+
+		if parameter.AllowedValues == nil {
+			parameter.AllowedValues = []string{}
+		}
+
+		parameter.Position = len(parameters)
+		parameters = append(parameters, parameter)
+	}
+
+	return parameters, nil
+}
+
+func parameterLabel(name string) string {
+	if _, err := strconv.Atoi(name); err == nil {
+		return "parameter " + name
+	}
+
+	return ":" + name
+}
+
+// parameterValue converts what was typed for a parameter into the Go value
+// sent to the driver. An empty value takes the default; if that is empty
+// too, strings stay empty and other types become NULL
+func parameterValue(parameter QueryParameter, value string) (interface{}, error) {
+	if strings.TrimSpace(value) == "" {
+		value = parameter.Default
+	}
+
+	trimmed := strings.TrimSpace(value)
+
+	if len(parameter.AllowedValues) > 0 && trimmed != "" {
+		allowed := false
+
+		for _, candidate := range parameter.AllowedValues {
+			if strings.TrimSpace(candidate) == trimmed {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return nil, fmt.Errorf("%q is not one of the allowed values", value)
+		}
+	}
+
+	switch parameter.Type {
+	case VariableString, "":
+		return value, nil
+	case VariableNumber:
+		if trimmed == "" {
+			return nil, nil
+		}
+
+		normalized := normalizeDecimal(trimmed)
+
+		if integer, err := strconv.ParseInt(normalized, 10, 64); err == nil {
+			return integer, nil
+		}
+
+		// Other numbers are bound as exact decimal text, which the server
+		// converts to the column type without going through a float
+		number, err := parseDecimal(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+
+		return decimalText(number), nil
+	case VariableDate:
+		if trimmed == "" {
+			return nil, nil
+		}
+
+		return parseSpreadsheetDate(trimmed)
+	case VariableBoolean:
+		if trimmed == "" {
+			return nil, nil
+		}
+
+		return parseBoolean(trimmed)
+	}
+
+	return nil, fmt.Errorf("unknown type %q", parameter.Type)
+}
+
+// bindQueryParameters returns the SQL to prepare and the argument for each
+// of its ?, converted according to the parameter metadata
+func bindQueryParameters(query string, saved []QueryParameter, values map[string]string) (string, []interface{}, error) {
+	parsed, err := parseQueryParameters(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	parameters, err := describeQueryParameters(query, saved)
+	if err != nil {
+		return "", nil, err
+	}
+
+	converted := make(map[string]interface{}, len(parameters))
+
+	for _, parameter := range parameters {
+		value, err := parameterValue(parameter, values[parameter.Name])
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", parameterLabel(parameter.Name), err)
+		}
+
+		converted[parameter.Name] = value
+	}
+
+	args := make([]interface{}, len(parsed.Names))
+	for i, name := range parsed.Names {
+		args[i] = converted[name]
+	}
+
+	return parsed.SQL, args, nil
+}
+
+func loadQueryParameters(db *sql.DB, queryID int) ([]QueryParameter, error) {
+	parameters := []QueryParameter{}
+
+	rows, err := db.Query("SELECT name, type, default_value, allowed_values, position FROM query_parameters WHERE query_id = ? ORDER BY position, id", queryID)
+	if err != nil {
+		return parameters, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var parameter QueryParameter
+		var allowedValues string
+
+		err = rows.Scan(&parameter.Name, &parameter.Type, &parameter.Default, &allowedValues, &parameter.Position)
+		if err != nil {
+			return parameters, err
+		}
+
+		parameter.AllowedValues = []string{}
+
+		if allowedValues != "" {
+			err = json.Unmarshal([]byte(allowedValues), &parameter.AllowedValues)
+			if err != nil {
+				return parameters, fmt.Errorf("invalid allowed values saved for %s: %w", parameterLabel(parameter.Name), err)
+			}
+		}
+
+		parameters = append(parameters, parameter)
+	}
+
+	return parameters, rows.Err()
+}
+
+// validateQueryParameter checks the metadata of a parameter, including that
+// its default and allowed values are valid for its type
+func validateQueryParameter(parameter *QueryParameter) error {
+	parameter.Name = strings.TrimPrefix(strings.TrimSpace(parameter.Name), ":")
+
+	if parameter.Type == "" {
+		parameter.Type = VariableString
+	}
+
+	if !placeholderName.MatchString(parameter.Name) {
+		return fmt.Errorf("invalid parameter name %q: use letters, digits and underscores", parameter.Name)
+	}
+
+	label := parameterLabel(parameter.Name)
+
+	if !parameterTypes[parameter.Type] {
+		return fmt.Errorf("unknown type %q for %s", parameter.Type, label)
+	}
+
+	for _, allowed := range parameter.AllowedValues {
+		if strings.TrimSpace(allowed) == "" {
+			return fmt.Errorf("the allowed values of %s cannot be empty", label)
+		}
+
+		if _, err := parameterValue(QueryParameter{Type: parameter.Type}, allowed); err != nil {
+			return fmt.Errorf("allowed value of %s: %w", label, err)
+		}
+	}
+
+	if _, err := parameterValue(*parameter, parameter.Default); err != nil {
+		return fmt.Errorf("default of %s: %w", label, err)
+	}
+
+	return nil
+}
+
+func saveQueryParameters(tx *sql.Tx, queryID int, parameters []QueryParameter) error {
+	seen := make(map[string]bool)
+
+	for i := range parameters {
+		err := validateQueryParameter(&parameters[i])
+		if err != nil {
+			return err
+		}
+
+		if seen[parameters[i].Name] {
+			return fmt.Errorf("%s is defined twice", parameterLabel(parameters[i].Name))
+		}
+
+		seen[parameters[i].Name] = true
+	}
+
+	_, err := tx.Exec("DELETE FROM query_parameters WHERE query_id = ?", queryID)
+	if err != nil {
+		return err
+	}
+
+	for i, parameter := range parameters {
+		allowedValues := ""
+
+		if len(parameter.AllowedValues) > 0 {
+			encoded, err := json.Marshal(parameter.AllowedValues)
+			if err != nil {
+				return err
+			}
+
+			allowedValues = string(encoded)
+		}
+
+		_, err = tx.Exec("INSERT INTO query_parameters (query_id, position, name, type, default_value, allowed_values) VALUES (?, ?, ?, ?, ?, ?)",
+			queryID, i, parameter.Name, parameter.Type, parameter.Default, allowedValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statementPreparer is satisfied by sessions and transactions
+type statementPreparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// runPreparedQuery runs a query as a server-side prepared statement. This
+// holds even when the connection sets interpolateParams, which only applies
+// to queries run with arguments directly
+func runPreparedQuery(ctx context.Context, preparer statementPreparer, query string, args []interface{}) ([]map[string]interface{}, error) {
+	statement, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer statement.Close()
+
+	rows, err := statement.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows)
+}
+
+// DetectQueryParameters lists the :name or ? parameters of a query that has
+// not been saved, typed as strings
+func (a *App) DetectQueryParameters(query string) ([]QueryParameter, error) {
+	return describeQueryParameters(query, nil)
+}
+
+// GetQueryParameters lists the parameters of a saved query with the types,
+// defaults and allowed values saved for them
+func (a *App) GetQueryParameters(queryID int) ([]QueryParameter, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	query, saved, err := loadParameterizedQuery(db, queryID)
+	if err != nil {
+		return []QueryParameter{}, err
+	}
+
+	return describeQueryParameters(query, saved)
+}
+
+func loadParameterizedQuery(db *sql.DB, queryID int) (string, []QueryParameter, error) {
+	var query sql.NullString
+
+	err := db.QueryRow("SELECT query FROM queries WHERE id = ?", queryID).Scan(&query)
+	if err == sql.ErrNoRows {
+		return "", nil, fmt.Errorf("query not found")
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	saved, err := loadQueryParameters(db, queryID)
+
+	return query.String, saved, err
+}
+
+// SaveQueryParameters replaces the parameter metadata of a saved query
+func (a *App) SaveQueryParameters(queryID int, parameters []QueryParameter) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+
+	err = tx.QueryRow("SELECT COUNT(*) FROM queries WHERE id = ?", queryID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		return fmt.Errorf("query not found")
+	}
+
+	err = saveQueryParameters(tx, queryID, parameters)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TestParameterizedQueryInDatabase runs a query with :name or ? parameters
+// as a prepared statement. values holds what was typed for each parameter,
+// by name, and is converted with the metadata in parameters
+func (a *App) TestParameterizedQueryInDatabase(input DatabaseConnection, query string, parameters []QueryParameter, values map[string]string, useTransaction bool) ([]map[string]interface{}, error) {
+	prepared, args, err := bindQueryParameters(query, parameters, values)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := a.connections.Session(input)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	if useTransaction {
+		tx, err := session.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start transaction: %w", err)
+		}
+		defer tx.Rollback() // Always rollback to ensure no changes are committed
+
+		return runPreparedQuery(ctx, tx, prepared, args)
+	}
+
+	return runPreparedQuery(ctx, session, prepared, args)
+}
+
+// TestSavedQueryInDatabase runs a saved query with its parameter metadata
+func (a *App) TestSavedQueryInDatabase(input DatabaseConnection, queryID int, values map[string]string, useTransaction bool) ([]map[string]interface{}, error) {
+	db := openSqliteConnection()
+	query, saved, err := loadParameterizedQuery(db, queryID)
+	db.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a.TestParameterizedQueryInDatabase(input, query, saved, values, useTransaction)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQueryParameters(t *testing.T) {
+	cases := []struct {
+		query string
+		sql   string
+		names []string
+	}{
+		{
+			"SELECT * FROM t WHERE id = :id AND name = ':no' AND kind::text = 'x' AND parent = :id -- :no\nAND z = :z_1",
+			"SELECT * FROM t WHERE id = ? AND name = ':no' AND kind::text = 'x' AND parent = ? -- :no\nAND z = ?",
+			[]string{"id", "id", "z_1"},
+		},
+		{
+			"SELECT ?, '?', `a?`, \"it\\\"s ?\", /* ? */ {{ v? }} ? # ?",
+			"SELECT ?, '?', `a?`, \"it\\\"s ?\", /* ? */ {{ v? }} ? # ?",
+			[]string{"1", "2"},
+		},
+		{"SET @total := 1, @name = 'it''s :no'", "SET @total := 1, @name = 'it''s :no'", []string{}},
+		{"SELECT 'não' = :nome, 1--1", "SELECT 'não' = ?, 1--1", []string{"nome"}},
+		{"SELECT 'unterminated :no", "SELECT 'unterminated :no", []string{}},
+	}
+
+	for _, c := range cases {
+		parsed, err := parseQueryParameters(c.query)
+		if err != nil {
+			t.Fatalf("%q: %v", c.query, err)
+		}
+
+		if parsed.SQL != c.sql || !reflect.DeepEqual(parsed.Names, c.names) {
+			t.Errorf("%q: expected %q %v, got %q %v", c.query, c.sql, c.names, parsed.SQL, parsed.Names)
+		}
+	}
+
+	if _, err := parseQueryParameters("SELECT :a, ?"); err == nil {
+		t.Error("expected mixed parameter styles to be rejected")
+	}
+}
+
+func TestParameterValue(t *testing.T) {
+	cases := []struct {
+		parameter QueryParameter
+		value     string
+		expected  interface{}
+		fails     bool
+	}{
+		{QueryParameter{Type: VariableString}, "O'Brien", "O'Brien", false},
+		{QueryParameter{Type: VariableString}, "", "", false},
+		{QueryParameter{Type: VariableNumber}, "42", int64(42), false},
+		{QueryParameter{Type: VariableNumber}, "1.234,5", "1234.5", false},
+		{QueryParameter{Type: VariableNumber}, "12345678901234567.89", "12345678901234567.89", false},
+		{QueryParameter{Type: VariableNumber}, "18446744073709551615", "18446744073709551615", false},
+		{QueryParameter{Type: VariableNumber}, "1e400", nil, true},
+		{QueryParameter{Type: VariableNumber, Default: "7"}, " ", int64(7), false},
+		{QueryParameter{Type: VariableNumber}, "", nil, false},
+		{QueryParameter{Type: VariableNumber}, "1 OR 1=1", nil, true},
+		{QueryParameter{Type: VariableDate}, "31/12/2024", time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), false},
+		{QueryParameter{Type: VariableBoolean}, "sim", true, false},
+		{QueryParameter{Type: VariableString, AllowedValues: []string{"open", "closed"}}, "closed", "closed", false},
+		{QueryParameter{Type: VariableString, AllowedValues: []string{"open", "closed"}}, "lost", nil, true},
+		{QueryParameter{Type: VariableRaw}, "NOW()", nil, true},
+	}
+
+	for _, c := range cases {
+		value, err := parameterValue(c.parameter, c.value)
+
+		if (err != nil) != c.fails || !c.fails && !reflect.DeepEqual(value, c.expected) {
+			t.Errorf("%s %q: expected %#v (fails %v), got %#v (%v)", c.parameter.Type, c.value, c.expected, c.fails, value, err)
+		}
+	}
+}
+
+func TestQueryParameters(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+
+	query := "SELECT title FROM queries WHERE title = :title OR (id = :id AND :id > 0) ORDER BY id"
+
+	if err := app.InsertQueryInDatabase(Query{Title: "Find query", Query: query}); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := [][]QueryParameter{
+		{{Name: "id", Type: VariableRaw}},
+		{{Name: "id", Type: VariableNumber, Default: "one"}},
+		{{Name: "title", AllowedValues: []string{"a"}, Default: "b"}},
+		{{Name: "bad name"}},
+		{{Name: "id"}, {Name: ":id"}},
+	}
+
+	for _, parameters := range invalid {
+		if err := app.SaveQueryParameters(1, parameters); err == nil {
+			t.Errorf("expected %+v to be rejected", parameters)
+		}
+	}
+
+	err := app.SaveQueryParameters(1, []QueryParameter{
+		{Name: ":id", Type: VariableNumber, Default: "1"},
+		{Name: "removed", Type: VariableDate},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parameters, err := app.GetQueryParameters(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []QueryParameter{
+		{Name: "title", Type: VariableString, AllowedValues: []string{}, Position: 0},
+		{Name: "id", Type: VariableNumber, Default: "1", AllowedValues: []string{}, Position: 1},
+	}
+
+	if !reflect.DeepEqual(parameters, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, parameters)
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	// Values are sent apart from the SQL, so quotes in them stay data
+	prepared, args, err := bindQueryParameters(query, parameters, map[string]string{"title": "x' OR '1'='1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(prepared, "OR '1'") || !reflect.DeepEqual(args, []interface{}{"x' OR '1'='1", int64(1), int64(1)}) {
+		t.Fatalf("unexpected binding %q %#v", prepared, args)
+	}
+
+	rows, err := runPreparedQuery(context.Background(), db, prepared, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || rows[0]["title"] != "Find query" {
+		t.Errorf("expected only the query found by id, got %v", rows)
+	}
+
+	if _, _, err := bindQueryParameters(query, parameters, map[string]string{"id": "abc"}); err == nil || !strings.HasPrefix(err.Error(), ":id:") {
+		t.Errorf("expected the failing parameter to be named, got %v", err)
+	}
+}
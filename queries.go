@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Columns GetQueriesList can sort by
+var querySortColumns = map[string]string{
+	"":           "queries.id",
+	"id":         "queries.id",
+	"title":      "queries.title COLLATE NOCASE",
+	"created_at": "queries.created_at",
+	"updated_at": "queries.updated_at",
+}
+
+const queryColumns = `queries.id, queries.title, queries.query, queries.description, queries.folder_id, queries.created_at, queries.updated_at, queries.deleted_at`
+
+// QueryFilter narrows and orders GetQueriesList. The zero value lists every
+// query in the order it was saved
+type QueryFilter struct {
+	// FolderID limits the list to a folder; 0 lists queries outside any folder
+	FolderID          *int
+	IncludeSubfolders bool
+	// Tags lists queries that have every one of the tags
+	Tags       []string
+	Search     string
+	Sort       string
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+func scanQuery(row rowScanner) (Query, error) {
+	var query Query
+	var description sql.NullString
+
+	err := row.Scan(&query.ID, &query.Title, &query.Query, &description, &query.FolderID, &query.CreatedAt, &query.UpdatedAt, &query.DeletedAt)
+
+	query.Description = description.String
+	query.Tags = []string{}
+
+	return query, err
+}
+
+// queryConditions builds the WHERE clause shared by listing and counting
+func queryConditions(withTrashed bool, filter QueryFilter) (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	args := []interface{}{}
+
+	if !withTrashed {
+		conditions = append(conditions, "queries.deleted_at IS NULL")
+	}
+
+	switch {
+	case filter.FolderID == nil:
+	case *filter.FolderID == 0:
+		conditions = append(conditions, "queries.folder_id IS NULL")
+	case filter.IncludeSubfolders:
+		conditions = append(conditions, `queries.folder_id IN (
+			WITH RECURSIVE subfolders(id) AS (
+				SELECT ?
+				UNION SELECT folders.id FROM folders JOIN subfolders ON folders.parent_id = subfolders.id
+			)
+			SELECT id FROM subfolders
+		)`)
+		args = append(args, *filter.FolderID)
+	default:
+		conditions = append(conditions, "queries.folder_id = ?")
+		args = append(args, *filter.FolderID)
+	}
+
+	for _, tag := range filter.Tags {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM query_tags JOIN tags ON tags.id = query_tags.tag_id
+			WHERE query_tags.query_id = queries.id AND tags.name = ?
+		)`)
+		args = append(args, strings.TrimSpace(tag))
+	}
+
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		conditions = append(conditions, "(queries.title LIKE ? OR queries.description LIKE ?)")
+		args = append(args, "%"+search+"%", "%"+search+"%")
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// listQueries returns the queries matching filter with their tags
+func listQueries(db *sql.DB, withTrashed bool, filter QueryFilter) ([]Query, error) {
+	queries := make([]Query, 0)
+
+	order, ok := querySortColumns[filter.Sort]
+	if !ok {
+		return queries, fmt.Errorf("cannot sort queries by %q", filter.Sort)
+	}
+
+	if filter.Descending {
+		order += " DESC"
+	}
+
+	where, args := queryConditions(withTrashed, filter)
+
+	selectQuery := fmt.Sprintf("SELECT %s FROM queries WHERE %s ORDER BY %s, queries.id", queryColumns, where, order)
+
+	if filter.Limit > 0 {
+		selectQuery += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := db.Query(selectQuery, args...)
+	if err != nil {
+		return queries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		query, err := scanQuery(rows)
+		if err != nil {
+			return queries, err
+		}
+
+		queries = append(queries, query)
+	}
+
+	if err = rows.Err(); err != nil {
+		return queries, err
+	}
+
+	rows.Close()
+
+	return queries, loadQueryTags(db, queries)
+}
+
+// loadQueryTags fills the tags of queries in one round trip
+func loadQueryTags(db *sql.DB, queries []Query) error {
+	if len(queries) == 0 {
+		return nil
+	}
+
+	byID := make(map[int][]int, len(queries))
+	ids := make([]interface{}, 0, len(queries))
+
+	for i, query := range queries {
+		byID[*query.ID] = append(byID[*query.ID], i)
+		ids = append(ids, *query.ID)
+	}
+
+	tagRows, err := db.Query(fmt.Sprintf(`
+		SELECT query_tags.query_id, tags.name FROM query_tags JOIN tags ON tags.id = query_tags.tag_id
+		WHERE query_tags.query_id IN (%s)
+		ORDER BY tags.name COLLATE NOCASE
+	`, placeholders(len(ids))), ids...)
+	if err != nil {
+		return err
+	}
+	defer tagRows.Close()
+
+	for tagRows.Next() {
+		var queryID int
+		var name string
+
+		err = tagRows.Scan(&queryID, &name)
+		if err != nil {
+			return err
+		}
+
+		for _, i := range byID[queryID] {
+			queries[i].Tags = append(queries[i].Tags, name)
+		}
+	}
+
+	return tagRows.Err()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// GetQueriesList returns the saved queries matching filter, ordered and
+// paginated by it. An empty filter lists every query in the order it was saved
+func (a *App) GetQueriesList(withTrashed bool, filter QueryFilter) ([]Query, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return listQueries(db, withTrashed, filter)
+}
+
+// CountQueries returns how many queries match filter, ignoring its
+// pagination, so that the list can show the number of pages
+func (a *App) CountQueries(withTrashed bool, filter QueryFilter) (int, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	where, args := queryConditions(withTrashed, filter)
+
+	var count int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM queries WHERE "+where, args...).Scan(&count)
+
+	return count, err
+}
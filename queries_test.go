@@ -0,0 +1,149 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTemporaryLibrary points the app at a fresh, migrated library for the
+// duration of a test
+func useTemporaryLibrary(t *testing.T) {
+	t.Helper()
+
+	previous := storage
+	t.Cleanup(func() { storage = previous })
+
+	dir := t.TempDir()
+
+	configured, err := newDatabaseStorage(dir, filepath.Join(dir, "library.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage = configured
+
+	if err := migrateDatabaseFile(storage.Path()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func queryTitles(queries []Query) string {
+	titles := make([]string, len(queries))
+	for i, query := range queries {
+		titles[i] = query.Title
+	}
+
+	return strings.Join(titles, ",")
+}
+
+func TestFoldersAndTags(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+
+	reports, err := app.CreateFolder("Reports", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	monthly, err := app.CreateFolder("Monthly", &reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.CreateFolder("reports", nil); err == nil {
+		t.Error("expected a duplicate folder name to be rejected")
+	}
+
+	if err := app.MoveFolder(reports, &monthly); err == nil {
+		t.Error("expected moving a folder into its own subfolder to be rejected")
+	}
+
+	saved := []Query{
+		{Title: "Users", Query: "SELECT 1", Tags: []string{"users", "daily"}},
+		{Title: "Sales", Query: "SELECT 2", FolderID: &reports, Tags: []string{"finance"}},
+		{Title: "Invoices", Query: "SELECT 3", FolderID: &monthly, Tags: []string{"Finance", "daily"}},
+	}
+
+	for _, query := range saved {
+		if err := app.InsertQueryInDatabase(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name     string
+		filter   QueryFilter
+		expected string
+	}{
+		{"everything", QueryFilter{}, "Users,Sales,Invoices"},
+		{"folder", QueryFilter{FolderID: &reports}, "Sales"},
+		{"subfolders", QueryFilter{FolderID: &reports, IncludeSubfolders: true}, "Sales,Invoices"},
+		{"top level", QueryFilter{FolderID: new(int)}, "Users"},
+		{"tags", QueryFilter{Tags: []string{"finance", "DAILY"}}, "Invoices"},
+		{"search", QueryFilter{Search: "sal"}, "Sales"},
+		{"sorted", QueryFilter{Sort: "title", Descending: true}, "Users,Sales,Invoices"},
+		{"paginated", QueryFilter{Sort: "title", Limit: 2, Offset: 1}, "Sales,Users"},
+	}
+
+	for _, c := range cases {
+		queries, err := app.GetQueriesList(false, c.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if titles := queryTitles(queries); titles != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, titles)
+		}
+	}
+
+	if count, err := app.CountQueries(false, QueryFilter{Tags: []string{"daily"}, Limit: 1}); err != nil || count != 2 {
+		t.Errorf("expected 2 daily queries, got %d (%v)", count, err)
+	}
+
+	if _, err := app.GetQueriesList(false, QueryFilter{Sort: "query; DROP TABLE queries"}); err == nil {
+		t.Error("expected an unknown sort column to be rejected")
+	}
+
+	tags, err := app.GetTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tags) != 3 || tags[0].Name != "daily" || tags[0].QueryCount != 2 || tags[1].Name != "finance" || tags[1].QueryCount != 2 {
+		t.Fatalf("unexpected tags %+v", tags)
+	}
+
+	// Renaming onto an existing tag merges them
+	if err := app.RenameTag(tags[2].ID, "Daily"); err != nil {
+		t.Fatal(err)
+	}
+
+	queries, _ := app.GetQueriesList(false, QueryFilter{Tags: []string{"daily"}})
+	if titles := queryTitles(queries); titles != "Users,Invoices" {
+		t.Errorf("expected the merged tag on both queries, got %s", titles)
+	}
+
+	if len(queries[0].Tags) != 1 || queries[0].Tags[0] != "daily" {
+		t.Errorf("expected Users to keep a single tag, got %v", queries[0].Tags)
+	}
+
+	// Deleting a folder moves its contents up instead of losing them
+	if err := app.DeleteFolder(reports); err != nil {
+		t.Fatal(err)
+	}
+
+	folders, err := app.GetFolders()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(folders) != 1 || folders[0].Name != "Monthly" || folders[0].ParentID != nil || folders[0].QueryCount != 1 {
+		t.Errorf("unexpected folders %+v", folders)
+	}
+
+	queries, _ = app.GetQueriesList(false, QueryFilter{FolderID: new(int)})
+	if titles := queryTitles(queries); titles != "Users,Sales" {
+		t.Errorf("expected Sales at the top level, got %s", titles)
+	}
+}
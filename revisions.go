@@ -0,0 +1,396 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Kinds of DiffLine
+const (
+	DiffEqual   = "equal"
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+)
+
+// QueryRevision is one saved version of a query
+type QueryRevision struct {
+	ID          int
+	QueryID     int
+	Title       string
+	Query       string
+	Description string
+	Note        string
+	CreatedAt   *string
+}
+
+// DiffLine is a line of the SQL of two revisions. FromLine and ToLine are
+// 1-based line numbers in each revision, 0 where the line does not appear
+type DiffLine struct {
+	Kind     string
+	Text     string
+	FromLine int
+	ToLine   int
+}
+
+// QueryRevisionDiff compares two revisions of the same query
+type QueryRevisionDiff struct {
+	From               QueryRevision
+	To                 QueryRevision
+	TitleChanged       bool
+	DescriptionChanged bool
+	Added              int
+	Removed            int
+	Lines              []DiffLine
+}
+
+const queryRevisionColumns = `id, query_id, title, query, description, note, created_at`
+
+func scanQueryRevision(row rowScanner) (QueryRevision, error) {
+	var revision QueryRevision
+	var title, query, description sql.NullString
+
+	err := row.Scan(&revision.ID, &revision.QueryID, &title, &query, &description, &revision.Note, &revision.CreatedAt)
+
+	revision.Title = title.String
+	revision.Query = query.String
+	revision.Description = description.String
+
+	return revision, err
+}
+
+// storeQueryRevision records the current contents of a query as a revision
+func storeQueryRevision(tx *sql.Tx, queryID int, note string) error {
+	_, err := tx.Exec(`
+		INSERT INTO query_revisions (query_id, title, query, description, note)
+		SELECT id, title, query, description, ? FROM queries WHERE id = ?
+	`, strings.TrimSpace(note), queryID)
+
+	return err
+}
+
+// updateQuery applies an edit and records it as a revision. An empty title
+// keeps the current one, and an edit that changes nothing is not recorded
+func updateQuery(db *sql.DB, id int, data Query, note string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateQueryInTransaction(tx, id, data, note)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func updateQueryInTransaction(tx *sql.Tx, id int, data Query, note string) error {
+	var title, query, description sql.NullString
+
+	err := tx.QueryRow("SELECT title, query, description FROM queries WHERE id = ?", id).Scan(&title, &query, &description)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("query not found")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	newTitle := strings.TrimSpace(data.Title)
+	if newTitle == "" {
+		newTitle = title.String
+	}
+
+	if newTitle == title.String && data.Query == query.String && data.Description == description.String {
+		return nil
+	}
+
+	// Queries saved before revisions existed get their original contents
+	// recorded first so that the edit can be undone
+	var revisions int
+
+	err = tx.QueryRow("SELECT COUNT(*) FROM query_revisions WHERE query_id = ?", id).Scan(&revisions)
+	if err != nil {
+		return err
+	}
+
+	if revisions == 0 {
+		_, err = tx.Exec(`
+			INSERT INTO query_revisions (query_id, title, query, description, created_at)
+			SELECT id, title, query, description, COALESCE(updated_at, created_at, CURRENT_TIMESTAMP) FROM queries WHERE id = ?
+		`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE queries SET title = ?, query = ?, description = ?, referenced_tables = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, newTitle, data.Query, data.Description, referencedTablesColumn(data.Query), id)
+	if err != nil {
+		return err
+	}
+
+	return storeQueryRevision(tx, id, note)
+}
+
+func loadQueryRevision(db *sql.DB, id int) (QueryRevision, error) {
+	revision, err := scanQueryRevision(db.QueryRow("SELECT "+queryRevisionColumns+" FROM query_revisions WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return revision, fmt.Errorf("revision %d not found", id)
+	}
+
+	return revision, err
+}
+
+// GetQueryRevisions returns the revisions of a query, newest first
+func (a *App) GetQueryRevisions(queryID int) ([]QueryRevision, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	revisions := make([]QueryRevision, 0)
+
+	rows, err := db.Query("SELECT "+queryRevisionColumns+" FROM query_revisions WHERE query_id = ? ORDER BY id DESC", queryID)
+	if err != nil {
+		return revisions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		revision, err := scanQueryRevision(rows)
+		if err != nil {
+			return revisions, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// DiffQueryRevisions compares two revisions of a query line by line
+func (a *App) DiffQueryRevisions(fromID int, toID int) (QueryRevisionDiff, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	from, err := loadQueryRevision(db, fromID)
+	if err != nil {
+		return QueryRevisionDiff{}, err
+	}
+
+	to, err := loadQueryRevision(db, toID)
+	if err != nil {
+		return QueryRevisionDiff{}, err
+	}
+
+	if from.QueryID != to.QueryID {
+		return QueryRevisionDiff{}, fmt.Errorf("revisions %d and %d belong to different queries", fromID, toID)
+	}
+
+	return diffQueryRevisions(from, to), nil
+}
+
+func diffQueryRevisions(from QueryRevision, to QueryRevision) QueryRevisionDiff {
+	diff := QueryRevisionDiff{
+		From:               from,
+		To:                 to,
+		TitleChanged:       from.Title != to.Title,
+		DescriptionChanged: from.Description != to.Description,
+		Lines:              diffLines(splitLines(from.Query), splitLines(to.Query)),
+	}
+
+	for _, line := range diff.Lines {
+		switch line.Kind {
+		case DiffAdded:
+			diff.Added++
+		case DiffRemoved:
+			diff.Removed++
+		}
+	}
+
+	return diff
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+// diffLines is a Myers line diff. It runs in space linear to the two texts,
+// so a long generated script diffs without a table of every line pair
+func diffLines(from []string, to []string) []DiffLine {
+	d := lineDiff{from: from, to: to, lines: make([]DiffLine, 0, max(len(from), len(to)))}
+	d.compare(0, len(from), 0, len(to))
+
+	return d.lines
+}
+
+type lineDiff struct {
+	from  []string
+	to    []string
+	lines []DiffLine
+}
+
+// compare appends the diff of from[aLo:aHi] and to[bLo:bHi]. Common leading
+// and trailing lines are matched first and the rest is split at the middle
+// of a shortest edit path
+func (d *lineDiff) compare(aLo int, aHi int, bLo int, bHi int) {
+	for aLo < aHi && bLo < bHi && d.from[aLo] == d.to[bLo] {
+		d.equal(aLo, bLo)
+		aLo++
+		bLo++
+	}
+
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.from[aHi-1-suffix] == d.to[bHi-1-suffix] {
+		suffix++
+	}
+
+	aHi -= suffix
+	bHi -= suffix
+
+	if x, y, ok := middleSnake(d.from[aLo:aHi], d.to[bLo:bHi]); ok {
+		d.compare(aLo, aLo+x, bLo, bLo+y)
+		d.compare(aLo+x, aHi, bLo+y, bHi)
+	} else {
+		for i := aLo; i < aHi; i++ {
+			d.lines = append(d.lines, DiffLine{Kind: DiffRemoved, Text: d.from[i], FromLine: i + 1})
+		}
+
+		for j := bLo; j < bHi; j++ {
+			d.lines = append(d.lines, DiffLine{Kind: DiffAdded, Text: d.to[j], ToLine: j + 1})
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		d.equal(aHi+k, bHi+k)
+	}
+}
+
+func (d *lineDiff) equal(i int, j int) {
+	d.lines = append(d.lines, DiffLine{Kind: DiffEqual, Text: d.from[i], FromLine: i + 1, ToLine: j + 1})
+}
+
+// maxDiffEdits bounds how far middleSnake searches. Ranges that need more
+// edits than this are shown as replaced, which keeps a diff of two unrelated
+// scripts fast
+const maxDiffEdits = 2000
+
+// middleSnake walks a shortest edit path from both ends at once and returns
+// where the two walks meet. It is false when either side is empty or the
+// walks don't meet within maxDiffEdits, and the whole range is then a
+// replacement
+func middleSnake(a []string, b []string) (int, int, bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+
+	for i := range forward {
+		forward[i] = -1
+		backward[i] = -1
+	}
+
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	delta := n - m
+	// With an odd delta the forward walk is the one that reaches the overlap
+	odd := delta%2 != 0
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+
+	for step := 0; step < min(maxD, maxDiffEdits/2); step++ {
+		for k := -step + fStart; k <= step-fEnd; k += 2 {
+			var x int
+			if k == -step || (k != step && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			forward[offset+k] = x
+
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				if r := offset + delta - k; r >= 0 && r < len(backward) && backward[r] != -1 && x >= n-backward[r] {
+					return x, y, true
+				}
+			}
+		}
+
+		for k := -step + bStart; k <= step-bEnd; k += 2 {
+			var x int
+			if k == -step || (k != step && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+
+			backward[offset+k] = x
+
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				if f := offset + delta - k; f >= 0 && f < len(forward) && forward[f] != -1 && forward[f] >= n-x {
+					fx := forward[f]
+					return fx, fx - (f - offset), true
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// RestoreQueryRevision brings back the contents of an older revision. The
+// restore is itself recorded as a new revision, so it can be undone too
+func (a *App) RestoreQueryRevision(revisionID int) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	revision, err := loadQueryRevision(db, revisionID)
+	if err != nil {
+		return err
+	}
+
+	note := fmt.Sprintf("Restored revision %d", revision.ID)
+	if revision.CreatedAt != nil {
+		note = fmt.Sprintf("Restored revision from %s", *revision.CreatedAt)
+	}
+
+	return updateQuery(db, revision.QueryID, Query{
+		Title:       revision.Title,
+		Query:       revision.Query,
+		Description: revision.Description,
+	}, note)
+}
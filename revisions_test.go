@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	from := splitLines("SELECT id\nFROM users\nWHERE active = 1\nORDER BY id")
+	to := splitLines("SELECT id, name\nFROM users\nWHERE active = 1\nLIMIT 10\nORDER BY id")
+
+	expected := []DiffLine{
+		{DiffRemoved, "SELECT id", 1, 0},
+		{DiffAdded, "SELECT id, name", 0, 1},
+		{DiffEqual, "FROM users", 2, 2},
+		{DiffEqual, "WHERE active = 1", 3, 3},
+		{DiffAdded, "LIMIT 10", 0, 4},
+		{DiffEqual, "ORDER BY id", 4, 5},
+	}
+
+	lines := diffLines(from, to)
+
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, lines)
+	}
+
+	for i := range lines {
+		if lines[i] != expected[i] {
+			t.Errorf("line %d: expected %+v, got %+v", i, expected[i], lines[i])
+		}
+	}
+}
+
+// sidesOf rebuilds both texts from a diff
+func sidesOf(lines []DiffLine) ([]string, []string) {
+	from, to := []string{}, []string{}
+
+	for _, line := range lines {
+		if line.Kind != DiffAdded {
+			from = append(from, line.Text)
+		}
+
+		if line.Kind != DiffRemoved {
+			to = append(to, line.Text)
+		}
+	}
+
+	return from, to
+}
+
+func sameLines(a []string, b []string) bool {
+	return fmt.Sprint(len(a), a) == fmt.Sprint(len(b), b)
+}
+
+func TestDiffLinesIsMinimal(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	words := []string{"SELECT 1", "FROM t", "WHERE x", "", ";"}
+
+	for round := 0; round < 500; round++ {
+		from := make([]string, random.Intn(12))
+		for i := range from {
+			from[i] = words[random.Intn(len(words))]
+		}
+
+		to := make([]string, random.Intn(12))
+		for i := range to {
+			to[i] = words[random.Intn(len(words))]
+		}
+
+		lines := diffLines(from, to)
+
+		if a, b := sidesOf(lines); !sameLines(a, from) || !sameLines(b, to) {
+			t.Fatalf("%q -> %q: diff doesn't rebuild the texts: %+v", from, to, lines)
+		}
+
+		// common[i][j] is the LCS length of from[i:] and to[j:]
+		common := make([][]int, len(from)+1)
+		for i := range common {
+			common[i] = make([]int, len(to)+1)
+		}
+
+		for i := len(from) - 1; i >= 0; i-- {
+			for j := len(to) - 1; j >= 0; j-- {
+				if from[i] == to[j] {
+					common[i][j] = common[i+1][j+1] + 1
+				} else {
+					common[i][j] = max(common[i+1][j], common[i][j+1])
+				}
+			}
+		}
+
+		equal := 0
+		for _, line := range lines {
+			if line.Kind == DiffEqual {
+				equal++
+			}
+		}
+
+		if equal != common[0][0] {
+			t.Fatalf("%q -> %q: expected %d unchanged lines, got %d", from, to, common[0][0], equal)
+		}
+	}
+}
+
+func TestDiffLinesLargeScripts(t *testing.T) {
+	from := make([]string, 20000)
+	to := make([]string, 20000)
+
+	for i := range from {
+		from[i] = fmt.Sprintf("INSERT INTO t VALUES (%d);", i)
+		to[i] = from[i]
+
+		if i%50 == 0 {
+			to[i] = fmt.Sprintf("INSERT INTO t VALUES (%d, 'changed');", i)
+		}
+	}
+
+	diff := diffQueryRevisions(QueryRevision{Query: strings.Join(from, "\n")}, QueryRevision{Query: strings.Join(to, "\n")})
+
+	if diff.Added != 400 || diff.Removed != 400 {
+		t.Errorf("expected 400 changed lines, got %d added and %d removed", diff.Added, diff.Removed)
+	}
+
+	if a, b := sidesOf(diff.Lines); !sameLines(a, from) || !sameLines(b, to) {
+		t.Error("expected the diff to rebuild both scripts")
+	}
+
+	// Nothing in common is a plain replacement
+	for i := range to {
+		to[i] = fmt.Sprintf("DELETE FROM t WHERE id = %d;", i)
+	}
+
+	lines := diffLines(from, to)
+
+	if len(lines) != 40000 || lines[0].Kind != DiffRemoved || lines[39999].Kind != DiffAdded {
+		t.Errorf("expected every line to be replaced, got %d lines", len(lines))
+	}
+}
+
+func TestQueryRevisions(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+
+	if err := app.InsertQueryInDatabase(Query{Title: "Users", Query: "SELECT * FROM users"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.UpdateQueryWithNote(1, Query{Title: "Active users", Query: "SELECT * FROM users WHERE active = 1"}, "only active"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving without changes does not add a revision
+	if err := app.UpdateQuery(1, Query{Query: "SELECT * FROM users WHERE active = 1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.UpdateQuery(99, Query{Query: "SELECT 1"}); err == nil {
+		t.Error("expected updating a missing query to fail")
+	}
+
+	revisions, err := app.GetQueryRevisions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(revisions) != 2 || revisions[0].Note != "only active" || revisions[1].Title != "Users" {
+		t.Fatalf("unexpected revisions %+v", revisions)
+	}
+
+	diff, err := app.DiffQueryRevisions(revisions[1].ID, revisions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !diff.TitleChanged || diff.DescriptionChanged || diff.Added != 1 || diff.Removed != 1 {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+
+	if err := app.RestoreQueryRevision(revisions[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	queries, err := app.GetQueriesList(false, QueryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if queries[0].Title != "Users" || queries[0].Query != "SELECT * FROM users" {
+		t.Errorf("expected the first revision back, got %+v", queries[0])
+	}
+
+	revisions, _ = app.GetQueryRevisions(1)
+	if len(revisions) != 3 || revisions[0].Note == "" {
+		t.Errorf("expected the restore to be recorded as a revision, got %+v", revisions)
+	}
+}
+
+func TestUpdateRecordsOriginalOfLegacyQuery(t *testing.T) {
+	db := openFixtureDatabase(t)
+
+	if err := runMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updateQuery(db, 1, Query{Query: "INSERT INTO people (name) VALUES ({{ name }});"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var original, updatedAt string
+
+	if err := db.QueryRow("SELECT query FROM query_revisions WHERE query_id = 1 ORDER BY id LIMIT 1").Scan(&original); err != nil {
+		t.Fatal(err)
+	}
+
+	if original != "INSERT INTO users (name) VALUES ({{ name }});" {
+		t.Errorf("expected the original text to be kept, got %q", original)
+	}
+
+	if err := db.QueryRow("SELECT updated_at FROM queries WHERE id = 1").Scan(&updatedAt); err != nil || updatedAt == "" {
+		t.Errorf("expected updated_at to be set, got %q (%v)", updatedAt, err)
+	}
+}
@@ -0,0 +1,225 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ForeignKeyConstraint groups the per-column rows of a foreign key
+type ForeignKeyConstraint struct {
+	Name              string   `json:"name"`
+	Columns           []string `json:"columns"`
+	ReferencedTable   string   `json:"referencedTable"`
+	ReferencedColumns []string `json:"referencedColumns"`
+	OnDelete          string   `json:"onDelete"`
+	OnUpdate          string   `json:"onUpdate"`
+}
+
+// ForeignKeyConstraints groups the table's foreign key columns by constraint,
+// keeping the order in which constraints first appear
+func (t *Table) ForeignKeyConstraints() []ForeignKeyConstraint {
+	constraints := []ForeignKeyConstraint{}
+	positions := make(map[string]int)
+
+	for _, fk := range t.ForeignKeys {
+		i, ok := positions[fk.ConstraintName]
+		if !ok {
+			i = len(constraints)
+			positions[fk.ConstraintName] = i
+
+			constraints = append(constraints, ForeignKeyConstraint{
+				Name:            fk.ConstraintName,
+				ReferencedTable: fk.ReferencedTable,
+				OnDelete:        fk.OnDelete,
+				OnUpdate:        fk.OnUpdate,
+			})
+		}
+
+		constraints[i].Columns = append(constraints[i].Columns, fk.ColumnName)
+		constraints[i].ReferencedColumns = append(constraints[i].ReferencedColumns, fk.ReferencedColumn)
+	}
+
+	return constraints
+}
+
+// quoteIdentifier quotes a MySQL identifier
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// quoteString quotes a MySQL string literal
+func quoteString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "'", "''")
+
+	return "'" + value + "'"
+}
+
+var (
+	numericLiteral    = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+	defaultExpression = regexp.MustCompile(`(?i)^(NULL|CURRENT_TIMESTAMP(\(\d*\))?|NOW\(\d*\)|LOCALTIMESTAMP(\(\d*\))?|CURRENT_DATE|TRUE|FALSE)$`)
+)
+
+// columnHasDefault reports whether the column carries a default clause.
+// Snapshots taken before hasDefault existed only know non-empty defaults
+func columnHasDefault(column Column) bool {
+	return column.HasDefault || column.Default != ""
+}
+
+// defaultLiteral renders a column default as it appears in DDL
+func defaultLiteral(column Column) string {
+	value := column.Default
+
+	switch {
+	case strings.Contains(column.Extra, "DEFAULT_GENERATED") && !numericLiteral.MatchString(value):
+		// MySQL 8 expression defaults, e.g. (uuid()) or CURRENT_TIMESTAMP
+		if defaultExpression.MatchString(value) || strings.HasPrefix(value, "(") {
+			return value
+		}
+		return "(" + value + ")"
+	case defaultExpression.MatchString(value):
+		return value
+	case numericLiteral.MatchString(value) && !isStringType(column.Type):
+		return value
+	case strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) > 1:
+		// MariaDB reports string defaults already quoted
+		return value
+	}
+
+	return quoteString(value)
+}
+
+func isStringType(columnType string) bool {
+	base := strings.ToLower(columnType)
+	if i := strings.IndexAny(base, "( "); i >= 0 {
+		base = base[:i]
+	}
+
+	switch base {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set", "binary", "varbinary":
+		return true
+	}
+
+	return false
+}
+
+// columnDefinition renders a column as it appears in CREATE and ALTER TABLE
+func columnDefinition(column Column) string {
+	var sb strings.Builder
+
+	sb.WriteString(quoteIdentifier(column.Name))
+	sb.WriteString(" ")
+	sb.WriteString(column.Type)
+
+	if strings.EqualFold(column.Nullable, "NO") {
+		sb.WriteString(" NOT NULL")
+	} else {
+		sb.WriteString(" NULL")
+	}
+
+	if columnHasDefault(column) {
+		sb.WriteString(" DEFAULT ")
+		sb.WriteString(defaultLiteral(column))
+	}
+
+	extra := strings.ToLower(column.Extra)
+
+	if strings.Contains(extra, "auto_increment") {
+		sb.WriteString(" AUTO_INCREMENT")
+	}
+
+	if i := strings.Index(extra, "on update "); i >= 0 {
+		if fields := strings.Fields(extra[i+len("on update "):]); len(fields) > 0 {
+			sb.WriteString(" ON UPDATE ")
+			sb.WriteString(strings.ToUpper(fields[0]))
+		}
+	}
+
+	if column.Description != "" {
+		sb.WriteString(" COMMENT ")
+		sb.WriteString(quoteString(column.Description))
+	}
+
+	return sb.String()
+}
+
+// indexDefinition renders an index for use inside CREATE TABLE or after ADD
+func indexDefinition(index Index) string {
+	switch {
+	case index.Primary:
+		return fmt.Sprintf("PRIMARY KEY (%s)", quoteIdentifiers(index.Columns))
+	case index.Unique:
+		return fmt.Sprintf("UNIQUE KEY %s (%s)", quoteIdentifier(index.Name), quoteIdentifiers(index.Columns))
+	case strings.EqualFold(index.Type, "FULLTEXT"):
+		return fmt.Sprintf("FULLTEXT KEY %s (%s)", quoteIdentifier(index.Name), quoteIdentifiers(index.Columns))
+	case strings.EqualFold(index.Type, "SPATIAL"):
+		return fmt.Sprintf("SPATIAL KEY %s (%s)", quoteIdentifier(index.Name), quoteIdentifiers(index.Columns))
+	}
+
+	return fmt.Sprintf("KEY %s (%s)", quoteIdentifier(index.Name), quoteIdentifiers(index.Columns))
+}
+
+// foreignKeyDefinition renders a foreign key constraint
+func foreignKeyDefinition(fk ForeignKeyConstraint) string {
+	definition := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		quoteIdentifier(fk.Name), quoteIdentifiers(fk.Columns),
+		quoteIdentifier(fk.ReferencedTable), quoteIdentifiers(fk.ReferencedColumns))
+
+	// RESTRICT and NO ACTION are the defaults and are left implicit
+	if fk.OnDelete != "" && fk.OnDelete != "RESTRICT" && fk.OnDelete != "NO ACTION" {
+		definition += " ON DELETE " + fk.OnDelete
+	}
+
+	if fk.OnUpdate != "" && fk.OnUpdate != "RESTRICT" && fk.OnUpdate != "NO ACTION" {
+		definition += " ON UPDATE " + fk.OnUpdate
+	}
+
+	return definition
+}
+
+// createTableStatement renders CREATE TABLE for a base table with the given
+// foreign keys inlined, so callers that create several tables can add the
+// remaining ones once every referenced table exists
+func createTableStatement(table Table, foreignKeys []ForeignKeyConstraint) string {
+	definitions := make([]string, 0, len(table.Columns)+len(table.Indexes))
+
+	for _, column := range table.Columns {
+		definitions = append(definitions, columnDefinition(column))
+	}
+
+	for _, index := range table.Indexes {
+		if len(index.Columns) == 0 {
+			continue
+		}
+
+		definitions = append(definitions, indexDefinition(index))
+	}
+
+	for _, fk := range foreignKeys {
+		definitions = append(definitions, foreignKeyDefinition(fk))
+	}
+
+	statement := fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", quoteIdentifier(table.Name), strings.Join(definitions, ",\n  "))
+
+	if table.Description != "" {
+		statement += " COMMENT=" + quoteString(table.Description)
+	}
+
+	return statement + ";"
+}
+
+// createViewStatement renders CREATE OR REPLACE VIEW for a view
+func createViewStatement(table Table) string {
+	return fmt.Sprintf("CREATE OR REPLACE VIEW %s AS %s;", quoteIdentifier(table.Name), table.ViewDefinition)
+}
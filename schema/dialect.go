@@ -0,0 +1,398 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ddlGenerator renders the statements GenerateDDL needs in one dialect
+type ddlGenerator interface {
+	createTable(table Table, foreignKeys []ForeignKeyConstraint) []string
+	addForeignKey(table string, fk ForeignKeyConstraint) string
+	createView(table Table) string
+}
+
+// mysqlGenerator reuses the statements the migration diff renders
+type mysqlGenerator struct{}
+
+func (mysqlGenerator) createTable(table Table, foreignKeys []ForeignKeyConstraint) []string {
+	return []string{createTableStatement(table, foreignKeys)}
+}
+
+func (mysqlGenerator) addForeignKey(table string, fk ForeignKeyConstraint) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", quoteIdentifier(table), foreignKeyDefinition(fk))
+}
+
+func (mysqlGenerator) createView(table Table) string {
+	return createViewStatement(table)
+}
+
+// postgresGenerator translates the MySQL column types of a snapshot to
+// PostgreSQL. Secondary indexes and comments become separate statements,
+// since PostgreSQL has no inline KEY or COMMENT clauses. ON UPDATE
+// CURRENT_TIMESTAMP has no column-level equivalent and is left out
+type postgresGenerator struct{}
+
+func (g postgresGenerator) createTable(table Table, foreignKeys []ForeignKeyConstraint) []string {
+	definitions := []string{}
+
+	for _, column := range table.Columns {
+		definitions = append(definitions, g.columnDefinition(column))
+	}
+
+	if primary := primaryIndex(table); primary != nil {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", quoteStandardIdentifiers(primary.Columns)))
+	}
+
+	for _, fk := range foreignKeys {
+		definitions = append(definitions, standardForeignKeyDefinition(fk))
+	}
+
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s (\n  %s\n);", quoteStandardIdentifier(table.Name), strings.Join(definitions, ",\n  ")),
+	}
+
+	statements = append(statements, standardIndexStatements(table, DialectPostgres)...)
+
+	if table.Description != "" {
+		statements = append(statements, fmt.Sprintf("COMMENT ON TABLE %s IS %s;",
+			quoteStandardIdentifier(table.Name), quoteStandardString(table.Description)))
+	}
+
+	for _, column := range table.Columns {
+		if column.Description != "" {
+			statements = append(statements, fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s;",
+				quoteStandardIdentifier(table.Name), quoteStandardIdentifier(column.Name), quoteStandardString(column.Description)))
+		}
+	}
+
+	return statements
+}
+
+func (postgresGenerator) columnDefinition(column Column) string {
+	base, args, unsigned := splitColumnType(column.Type)
+	definition := quoteStandardIdentifier(column.Name) + " " + postgresType(base, args, unsigned)
+
+	if strings.Contains(strings.ToLower(column.Extra), "auto_increment") {
+		definition += " GENERATED BY DEFAULT AS IDENTITY"
+	} else if value, ok := standardDefault(column, DialectPostgres); ok {
+		definition += " DEFAULT " + value
+	}
+
+	if strings.EqualFold(column.Nullable, "NO") {
+		definition += " NOT NULL"
+	}
+
+	if base == "enum" {
+		definition += fmt.Sprintf(" CHECK (%s IN (%s))", quoteStandardIdentifier(column.Name), args)
+	}
+
+	return definition
+}
+
+func (postgresGenerator) addForeignKey(table string, fk ForeignKeyConstraint) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", quoteStandardIdentifier(table), standardForeignKeyDefinition(fk))
+}
+
+func (postgresGenerator) createView(table Table) string {
+	return skippedView(table, DialectPostgres)
+}
+
+func postgresType(base string, args string, unsigned bool) string {
+	withArgs := func(name string) string {
+		if args == "" {
+			return name
+		}
+		return name + "(" + args + ")"
+	}
+
+	switch base {
+	case "tinyint", "smallint":
+		if base == "smallint" && unsigned {
+			return "integer"
+		}
+		return "smallint"
+	case "mediumint":
+		return "integer"
+	case "int", "integer":
+		if unsigned {
+			return "bigint"
+		}
+		return "integer"
+	case "bigint":
+		if unsigned {
+			return "numeric(20)"
+		}
+		return "bigint"
+	case "decimal", "numeric", "dec", "fixed":
+		return withArgs("numeric")
+	case "float":
+		return "real"
+	case "double", "real":
+		return "double precision"
+	case "bool", "boolean":
+		return "boolean"
+	case "bit":
+		return withArgs("bit")
+	case "char":
+		return withArgs("char")
+	case "varchar":
+		return withArgs("varchar")
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "bytea"
+	case "date":
+		return "date"
+	case "time":
+		return withArgs("time")
+	case "datetime", "timestamp":
+		return withArgs("timestamp")
+	case "year":
+		return "smallint"
+	case "json":
+		return "jsonb"
+	}
+
+	// Text types, enum and set, and anything else PostgreSQL has no direct match for
+	return "text"
+}
+
+// sqliteGenerator renders SQLite DDL using type affinities. An auto
+// increment primary key becomes INTEGER PRIMARY KEY AUTOINCREMENT, and
+// foreign keys are always inlined since SQLite cannot add them later
+type sqliteGenerator struct{}
+
+func (g sqliteGenerator) createTable(table Table, foreignKeys []ForeignKeyConstraint) []string {
+	definitions := []string{}
+	primary := primaryIndex(table)
+	rowID := ""
+
+	if primary != nil && len(primary.Columns) == 1 {
+		if column := table.FindColumn(primary.Columns[0]); column != nil && strings.Contains(strings.ToLower(column.Extra), "auto_increment") {
+			rowID = column.Name
+		}
+	}
+
+	for _, column := range table.Columns {
+		if column.Name == rowID {
+			definitions = append(definitions, quoteStandardIdentifier(column.Name)+" INTEGER PRIMARY KEY AUTOINCREMENT")
+			continue
+		}
+
+		definitions = append(definitions, g.columnDefinition(column))
+	}
+
+	if primary != nil && rowID == "" {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", quoteStandardIdentifiers(primary.Columns)))
+	}
+
+	for _, fk := range foreignKeys {
+		definitions = append(definitions, standardForeignKeyDefinition(fk))
+	}
+
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s (\n  %s\n);", quoteStandardIdentifier(table.Name), strings.Join(definitions, ",\n  ")),
+	}
+
+	return append(statements, standardIndexStatements(table, DialectSQLite)...)
+}
+
+func (sqliteGenerator) columnDefinition(column Column) string {
+	base, args, _ := splitColumnType(column.Type)
+	definition := quoteStandardIdentifier(column.Name) + " " + sqliteType(base)
+
+	if strings.EqualFold(column.Nullable, "NO") {
+		definition += " NOT NULL"
+	}
+
+	if value, ok := standardDefault(column, DialectSQLite); ok {
+		definition += " DEFAULT " + value
+	}
+
+	if base == "enum" {
+		definition += fmt.Sprintf(" CHECK (%s IN (%s))", quoteStandardIdentifier(column.Name), args)
+	}
+
+	return definition
+}
+
+func (sqliteGenerator) addForeignKey(table string, fk ForeignKeyConstraint) string {
+	return fmt.Sprintf("-- SQLite cannot add foreign key %s to %s after creation", fk.Name, table)
+}
+
+func (sqliteGenerator) createView(table Table) string {
+	return skippedView(table, DialectSQLite)
+}
+
+func sqliteType(base string) string {
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "bool", "boolean", "bit", "year":
+		return "INTEGER"
+	case "float", "double", "real":
+		return "REAL"
+	case "decimal", "numeric", "dec", "fixed":
+		return "NUMERIC"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "BLOB"
+	}
+
+	return "TEXT"
+}
+
+// splitColumnType breaks a MySQL column type such as "int(10) unsigned" into
+// its lowercase base name, its arguments and whether it is unsigned
+func splitColumnType(columnType string) (base string, args string, unsigned bool) {
+	columnType = strings.TrimSpace(columnType)
+	lower := strings.ToLower(columnType)
+	unsigned = strings.Contains(lower, " unsigned")
+	base = lower
+
+	if i := strings.IndexAny(lower, "( "); i >= 0 {
+		base = lower[:i]
+	}
+
+	open := strings.Index(columnType, "(")
+	end := strings.LastIndex(columnType, ")")
+
+	if open >= 0 && end > open {
+		args = columnType[open+1 : end]
+	}
+
+	return base, args, unsigned
+}
+
+func primaryIndex(table Table) *Index {
+	for i := range table.Indexes {
+		if table.Indexes[i].Primary && len(table.Indexes[i].Columns) > 0 {
+			return &table.Indexes[i]
+		}
+	}
+
+	return nil
+}
+
+// standardIndexStatements renders CREATE INDEX for every secondary index.
+// Index names are global in PostgreSQL and SQLite but per table in MySQL,
+// so they get the table name as a prefix. Full-text and spatial indexes
+// have no portable equivalent and are only noted
+func standardIndexStatements(table Table, dialect Dialect) []string {
+	statements := []string{}
+
+	for _, index := range table.Indexes {
+		if index.Primary || len(index.Columns) == 0 {
+			continue
+		}
+
+		if strings.EqualFold(index.Type, "FULLTEXT") || strings.EqualFold(index.Type, "SPATIAL") {
+			statements = append(statements, fmt.Sprintf("-- %s index %s on %s is not supported by %s",
+				strings.ToUpper(index.Type), index.Name, table.Name, dialect))
+			continue
+		}
+
+		name := index.Name
+		if !strings.HasPrefix(name, table.Name+"_") {
+			name = table.Name + "_" + name
+		}
+
+		keyword := "INDEX"
+		if index.Unique {
+			keyword = "UNIQUE INDEX"
+		}
+
+		statements = append(statements, fmt.Sprintf("CREATE %s %s ON %s (%s);", keyword,
+			quoteStandardIdentifier(name), quoteStandardIdentifier(table.Name), quoteStandardIdentifiers(index.Columns)))
+	}
+
+	return statements
+}
+
+// skippedView notes a view whose MySQL definition cannot be replayed elsewhere
+func skippedView(table Table, dialect Dialect) string {
+	return fmt.Sprintf("-- View %s was not created: its definition is MySQL SQL and must be ported to %s by hand", table.Name, dialect)
+}
+
+func standardForeignKeyDefinition(fk ForeignKeyConstraint) string {
+	definition := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		quoteStandardIdentifier(fk.Name), quoteStandardIdentifiers(fk.Columns),
+		quoteStandardIdentifier(fk.ReferencedTable), quoteStandardIdentifiers(fk.ReferencedColumns))
+
+	if fk.OnDelete != "" && fk.OnDelete != "RESTRICT" && fk.OnDelete != "NO ACTION" {
+		definition += " ON DELETE " + fk.OnDelete
+	}
+
+	if fk.OnUpdate != "" && fk.OnUpdate != "RESTRICT" && fk.OnUpdate != "NO ACTION" {
+		definition += " ON UPDATE " + fk.OnUpdate
+	}
+
+	return definition
+}
+
+var (
+	timestampDefault = regexp.MustCompile(`(?i)^(CURRENT_TIMESTAMP(\(\d*\))?|NOW\(\d*\)|LOCALTIMESTAMP(\(\d*\))?)$`)
+	uuidDefault      = regexp.MustCompile(`(?i)^\(?uuid\(\)\)?$`)
+)
+
+// standardDefault translates a MySQL column default for PostgreSQL or
+// SQLite. Expression defaults without a counterpart are dropped
+func standardDefault(column Column, dialect Dialect) (string, bool) {
+	if !columnHasDefault(column) {
+		return "", false
+	}
+
+	value := column.Default
+	base, _, _ := splitColumnType(column.Type)
+
+	switch {
+	case strings.EqualFold(value, "NULL"):
+		return "NULL", true
+	case timestampDefault.MatchString(value):
+		return "CURRENT_TIMESTAMP", true
+	case strings.EqualFold(value, "CURRENT_DATE") || strings.EqualFold(value, "CURDATE()"):
+		return "CURRENT_DATE", true
+	case uuidDefault.MatchString(value):
+		if dialect == DialectPostgres {
+			return "gen_random_uuid()", true
+		}
+		return "", false
+	case strings.Contains(column.Extra, "DEFAULT_GENERATED") && !numericLiteral.MatchString(value):
+		return "", false
+	case strings.EqualFold(value, "TRUE") || strings.EqualFold(value, "FALSE"):
+		if base == "bool" || base == "boolean" {
+			return strings.ToUpper(value), true
+		}
+		if strings.EqualFold(value, "TRUE") {
+			return "1", true
+		}
+		return "0", true
+	case numericLiteral.MatchString(value) && !isStringType(column.Type):
+		if dialect == DialectPostgres && (base == "bool" || base == "boolean") {
+			return fmt.Sprintf("%t", value != "0"), true
+		}
+		return value, true
+	case strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) > 1:
+		// MariaDB reports string defaults already quoted
+		value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+
+	return quoteStandardString(value), true
+}
+
+// quoteStandardIdentifier quotes an identifier for PostgreSQL and SQLite
+func quoteStandardIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteStandardIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+
+	for i, name := range names {
+		quoted[i] = quoteStandardIdentifier(name)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// quoteStandardString quotes a string literal where backslashes are not escapes
+func quoteStandardString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,390 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Diff describes how one schema snapshot differs from another
+type Diff struct {
+	AddedTables   []Table     `json:"addedTables"`
+	DroppedTables []Table     `json:"droppedTables"`
+	AlteredTables []TableDiff `json:"alteredTables"`
+}
+
+// TableDiff describes the changes made to a table that exists in both snapshots
+type TableDiff struct {
+	Name                  string                 `json:"name"`
+	ViewDefinitionChanged bool                   `json:"viewDefinitionChanged"`
+	AddedColumns          []Column               `json:"addedColumns"`
+	DroppedColumns        []Column               `json:"droppedColumns"`
+	AlteredColumns        []ColumnChange         `json:"alteredColumns"`
+	AddedIndexes          []Index                `json:"addedIndexes"`
+	DroppedIndexes        []Index                `json:"droppedIndexes"`
+	AlteredIndexes        []IndexChange          `json:"alteredIndexes"`
+	AddedForeignKeys      []ForeignKeyConstraint `json:"addedForeignKeys"`
+	DroppedForeignKeys    []ForeignKeyConstraint `json:"droppedForeignKeys"`
+	AlteredForeignKeys    []ForeignKeyChange     `json:"alteredForeignKeys"`
+
+	from Table
+	to   Table
+}
+
+// ColumnChange describes a column whose definition changed
+type ColumnChange struct {
+	Name    string   `json:"name"`
+	From    Column   `json:"from"`
+	To      Column   `json:"to"`
+	Changes []string `json:"changes"`
+}
+
+// IndexChange describes an index whose definition changed
+type IndexChange struct {
+	Name string `json:"name"`
+	From Index  `json:"from"`
+	To   Index  `json:"to"`
+}
+
+// ForeignKeyChange describes a foreign key whose definition changed
+type ForeignKeyChange struct {
+	Name string               `json:"name"`
+	From ForeignKeyConstraint `json:"from"`
+	To   ForeignKeyConstraint `json:"to"`
+}
+
+// IsEmpty reports whether the snapshots are structurally identical
+func (d Diff) IsEmpty() bool {
+	return len(d.AddedTables) == 0 && len(d.DroppedTables) == 0 && len(d.AlteredTables) == 0
+}
+
+func (t TableDiff) isEmpty() bool {
+	return !t.ViewDefinitionChanged &&
+		len(t.AddedColumns) == 0 && len(t.DroppedColumns) == 0 && len(t.AlteredColumns) == 0 &&
+		len(t.AddedIndexes) == 0 && len(t.DroppedIndexes) == 0 && len(t.AlteredIndexes) == 0 &&
+		len(t.AddedForeignKeys) == 0 && len(t.DroppedForeignKeys) == 0 && len(t.AlteredForeignKeys) == 0
+}
+
+// Compare reports the changes needed to turn from into to
+func Compare(from Structure, to Structure) Diff {
+	diff := Diff{
+		AddedTables:   []Table{},
+		DroppedTables: []Table{},
+		AlteredTables: []TableDiff{},
+	}
+
+	for _, toTable := range to.Tables {
+		fromTable := from.FindTable(toTable.Name)
+
+		if fromTable == nil {
+			diff.AddedTables = append(diff.AddedTables, toTable)
+			continue
+		}
+
+		// A table that became a view, or the other way round, is recreated
+		if fromTable.Type != toTable.Type {
+			diff.DroppedTables = append(diff.DroppedTables, *fromTable)
+			diff.AddedTables = append(diff.AddedTables, toTable)
+			continue
+		}
+
+		if tableDiff := compareTables(*fromTable, toTable); !tableDiff.isEmpty() {
+			diff.AlteredTables = append(diff.AlteredTables, tableDiff)
+		}
+	}
+
+	for _, fromTable := range from.Tables {
+		if to.FindTable(fromTable.Name) == nil {
+			diff.DroppedTables = append(diff.DroppedTables, fromTable)
+		}
+	}
+
+	return diff
+}
+
+func compareTables(from Table, to Table) TableDiff {
+	diff := TableDiff{
+		Name:               to.Name,
+		AddedColumns:       []Column{},
+		DroppedColumns:     []Column{},
+		AlteredColumns:     []ColumnChange{},
+		AddedIndexes:       []Index{},
+		DroppedIndexes:     []Index{},
+		AlteredIndexes:     []IndexChange{},
+		AddedForeignKeys:   []ForeignKeyConstraint{},
+		DroppedForeignKeys: []ForeignKeyConstraint{},
+		AlteredForeignKeys: []ForeignKeyChange{},
+		from:               from,
+		to:                 to,
+	}
+
+	if to.IsView() {
+		diff.ViewDefinitionChanged = normalizeSQL(from.ViewDefinition) != normalizeSQL(to.ViewDefinition)
+		return diff
+	}
+
+	for _, column := range to.Columns {
+		previous := from.FindColumn(column.Name)
+
+		if previous == nil {
+			diff.AddedColumns = append(diff.AddedColumns, column)
+			continue
+		}
+
+		if changes := compareColumns(*previous, column); len(changes) > 0 {
+			diff.AlteredColumns = append(diff.AlteredColumns, ColumnChange{
+				Name:    column.Name,
+				From:    *previous,
+				To:      column,
+				Changes: changes,
+			})
+		}
+	}
+
+	for _, column := range from.Columns {
+		if to.FindColumn(column.Name) == nil {
+			diff.DroppedColumns = append(diff.DroppedColumns, column)
+		}
+	}
+
+	fromIndexes := indexesByName(from.Indexes)
+	toIndexes := indexesByName(to.Indexes)
+
+	for _, index := range to.Indexes {
+		previous, ok := fromIndexes[index.Name]
+
+		switch {
+		case !ok:
+			diff.AddedIndexes = append(diff.AddedIndexes, index)
+		case !sameIndex(previous, index):
+			diff.AlteredIndexes = append(diff.AlteredIndexes, IndexChange{Name: index.Name, From: previous, To: index})
+		}
+	}
+
+	for _, index := range from.Indexes {
+		if _, ok := toIndexes[index.Name]; !ok {
+			diff.DroppedIndexes = append(diff.DroppedIndexes, index)
+		}
+	}
+
+	fromKeys := foreignKeysByName(from.ForeignKeyConstraints())
+	toKeys := foreignKeysByName(to.ForeignKeyConstraints())
+
+	for _, fk := range to.ForeignKeyConstraints() {
+		previous, ok := fromKeys[fk.Name]
+
+		switch {
+		case !ok:
+			diff.AddedForeignKeys = append(diff.AddedForeignKeys, fk)
+		case !reflect.DeepEqual(previous, fk):
+			diff.AlteredForeignKeys = append(diff.AlteredForeignKeys, ForeignKeyChange{Name: fk.Name, From: previous, To: fk})
+		}
+	}
+
+	for _, fk := range from.ForeignKeyConstraints() {
+		if _, ok := toKeys[fk.Name]; !ok {
+			diff.DroppedForeignKeys = append(diff.DroppedForeignKeys, fk)
+		}
+	}
+
+	return diff
+}
+
+// compareColumns lists the attributes that differ between two versions of a column
+func compareColumns(from Column, to Column) []string {
+	changes := []string{}
+
+	if !strings.EqualFold(from.Type, to.Type) {
+		changes = append(changes, fmt.Sprintf("type %s -> %s", from.Type, to.Type))
+	}
+
+	if !strings.EqualFold(from.Nullable, to.Nullable) {
+		changes = append(changes, fmt.Sprintf("nullable %s -> %s", from.Nullable, to.Nullable))
+	}
+
+	if columnHasDefault(from) != columnHasDefault(to) || from.Default != to.Default {
+		changes = append(changes, fmt.Sprintf("default %s -> %s", describeDefault(from), describeDefault(to)))
+	}
+
+	if !strings.EqualFold(from.Extra, to.Extra) {
+		changes = append(changes, fmt.Sprintf("extra %q -> %q", from.Extra, to.Extra))
+	}
+
+	if from.Description != to.Description {
+		changes = append(changes, "comment")
+	}
+
+	return changes
+}
+
+func describeDefault(column Column) string {
+	if !columnHasDefault(column) {
+		return "none"
+	}
+
+	return defaultLiteral(column)
+}
+
+func sameIndex(a Index, b Index) bool {
+	return a.Unique == b.Unique && a.Primary == b.Primary &&
+		strings.EqualFold(a.Type, b.Type) && reflect.DeepEqual(a.Columns, b.Columns)
+}
+
+func indexesByName(indexes []Index) map[string]Index {
+	byName := make(map[string]Index, len(indexes))
+
+	for _, index := range indexes {
+		byName[index.Name] = index
+	}
+
+	return byName
+}
+
+func foreignKeysByName(constraints []ForeignKeyConstraint) map[string]ForeignKeyConstraint {
+	byName := make(map[string]ForeignKeyConstraint, len(constraints))
+
+	for _, fk := range constraints {
+		byName[fk.Name] = fk
+	}
+
+	return byName
+}
+
+func normalizeSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// MigrationSQL renders the MySQL DDL that transforms the "from" snapshot into
+// the "to" snapshot. Statements are ordered so that foreign keys are dropped
+// before the objects they depend on and added after them
+func (d Diff) MigrationSQL() string {
+	var statements []string
+
+	alter := func(table string, clause string) {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s %s;", quoteIdentifier(table), clause))
+	}
+
+	// Foreign keys go first so that columns, indexes and tables can change
+	for _, table := range d.AlteredTables {
+		for _, fk := range table.DroppedForeignKeys {
+			alter(table.Name, "DROP FOREIGN KEY "+quoteIdentifier(fk.Name))
+		}
+
+		for _, change := range table.AlteredForeignKeys {
+			alter(table.Name, "DROP FOREIGN KEY "+quoteIdentifier(change.Name))
+		}
+	}
+
+	for _, table := range d.DroppedTables {
+		if table.IsView() {
+			statements = append(statements, fmt.Sprintf("DROP VIEW IF EXISTS %s;", quoteIdentifier(table.Name)))
+			continue
+		}
+
+		for _, fk := range table.ForeignKeyConstraints() {
+			alter(table.Name, "DROP FOREIGN KEY "+quoteIdentifier(fk.Name))
+		}
+	}
+
+	for _, table := range d.AddedTables {
+		if !table.IsView() {
+			statements = append(statements, createTableStatement(table, nil))
+		}
+	}
+
+	for _, table := range d.AlteredTables {
+		if table.ViewDefinitionChanged {
+			continue
+		}
+
+		for _, column := range table.AddedColumns {
+			alter(table.Name, "ADD COLUMN "+columnDefinition(column)+columnPosition(table.to, column.Name))
+		}
+
+		for _, change := range table.AlteredColumns {
+			alter(table.Name, "MODIFY COLUMN "+columnDefinition(change.To))
+		}
+
+		for _, index := range table.DroppedIndexes {
+			alter(table.Name, dropIndexClause(index))
+		}
+
+		for _, change := range table.AlteredIndexes {
+			alter(table.Name, dropIndexClause(change.From)+", ADD "+indexDefinition(change.To))
+		}
+
+		for _, index := range table.AddedIndexes {
+			alter(table.Name, "ADD "+indexDefinition(index))
+		}
+
+		for _, column := range table.DroppedColumns {
+			alter(table.Name, "DROP COLUMN "+quoteIdentifier(column.Name))
+		}
+	}
+
+	for _, table := range d.AddedTables {
+		if table.IsView() {
+			continue
+		}
+
+		for _, fk := range table.ForeignKeyConstraints() {
+			alter(table.Name, "ADD "+foreignKeyDefinition(fk))
+		}
+	}
+
+	for _, table := range d.AlteredTables {
+		for _, fk := range table.AddedForeignKeys {
+			alter(table.Name, "ADD "+foreignKeyDefinition(fk))
+		}
+
+		for _, change := range table.AlteredForeignKeys {
+			alter(table.Name, "ADD "+foreignKeyDefinition(change.To))
+		}
+	}
+
+	for _, table := range d.DroppedTables {
+		if !table.IsView() {
+			statements = append(statements, fmt.Sprintf("DROP TABLE %s;", quoteIdentifier(table.Name)))
+		}
+	}
+
+	// Views last, since they may select from any of the tables above
+	for _, table := range d.AddedTables {
+		if table.IsView() {
+			statements = append(statements, createViewStatement(table))
+		}
+	}
+
+	for _, table := range d.AlteredTables {
+		if table.ViewDefinitionChanged {
+			statements = append(statements, createViewStatement(table.to))
+		}
+	}
+
+	return strings.Join(statements, "\n")
+}
+
+func dropIndexClause(index Index) string {
+	if index.Primary {
+		return "DROP PRIMARY KEY"
+	}
+
+	return "DROP INDEX " + quoteIdentifier(index.Name)
+}
+
+// columnPosition places an added column where it sits in the target snapshot
+func columnPosition(table Table, name string) string {
+	for i, column := range table.Columns {
+		if column.Name != name {
+			continue
+		}
+
+		if i == 0 {
+			return " FIRST"
+		}
+
+		return " AFTER " + quoteIdentifier(table.Columns[i-1].Name)
+	}
+
+	return ""
+}
@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareAndMigrationSQL(t *testing.T) {
+	from := Structure{
+		Tables: []Table{
+			{
+				Name: "customers",
+				Type: TableTypeBase,
+				Columns: []Column{
+					{Name: "id", Type: "int", Nullable: "NO", Extra: "auto_increment", IsPrimary: true},
+					{Name: "name", Type: "varchar(100)", Nullable: "NO"},
+					{Name: "fax", Type: "varchar(20)", Nullable: "YES"},
+				},
+				Indexes: []Index{
+					{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+				},
+			},
+			{
+				Name: "legacy_audit",
+				Type: TableTypeBase,
+				Columns: []Column{
+					{Name: "id", Type: "int", Nullable: "NO"},
+				},
+			},
+		},
+	}
+
+	to := Structure{
+		Tables: []Table{
+			{
+				Name: "customers",
+				Type: TableTypeBase,
+				Columns: []Column{
+					{Name: "id", Type: "int", Nullable: "NO", Extra: "auto_increment", IsPrimary: true},
+					{Name: "name", Type: "varchar(255)", Nullable: "NO"},
+					{Name: "email", Type: "varchar(255)", Nullable: "YES"},
+				},
+				Indexes: []Index{
+					{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+					{Name: "customers_email_unique", Columns: []string{"email"}, Unique: true},
+				},
+			},
+			{
+				Name: "orders",
+				Type: TableTypeBase,
+				Columns: []Column{
+					{Name: "id", Type: "int", Nullable: "NO"},
+					{Name: "customer_id", Type: "int", Nullable: "NO"},
+					{Name: "status", Type: "varchar(20)", Nullable: "NO", Default: "new", HasDefault: true},
+				},
+				Indexes: []Index{
+					{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+				},
+				ForeignKeys: []ForeignKey{
+					{ColumnName: "customer_id", ReferencedTable: "customers", ReferencedColumn: "id", ConstraintName: "orders_customer_fk", OnDelete: "CASCADE"},
+				},
+			},
+		},
+	}
+
+	diff := Compare(from, to)
+
+	if len(diff.AddedTables) != 1 || diff.AddedTables[0].Name != "orders" {
+		t.Fatalf("expected orders to be added, got %+v", diff.AddedTables)
+	}
+
+	if len(diff.DroppedTables) != 1 || diff.DroppedTables[0].Name != "legacy_audit" {
+		t.Fatalf("expected legacy_audit to be dropped, got %+v", diff.DroppedTables)
+	}
+
+	if len(diff.AlteredTables) != 1 {
+		t.Fatalf("expected one altered table, got %d", len(diff.AlteredTables))
+	}
+
+	customers := diff.AlteredTables[0]
+
+	if len(customers.AddedColumns) != 1 || customers.AddedColumns[0].Name != "email" {
+		t.Errorf("expected email to be added, got %+v", customers.AddedColumns)
+	}
+
+	if len(customers.DroppedColumns) != 1 || customers.DroppedColumns[0].Name != "fax" {
+		t.Errorf("expected fax to be dropped, got %+v", customers.DroppedColumns)
+	}
+
+	if len(customers.AlteredColumns) != 1 || customers.AlteredColumns[0].Name != "name" {
+		t.Errorf("expected name to be altered, got %+v", customers.AlteredColumns)
+	}
+
+	if len(customers.AddedIndexes) != 1 {
+		t.Errorf("expected one added index, got %+v", customers.AddedIndexes)
+	}
+
+	migration := diff.MigrationSQL()
+
+	expected := []string{
+		"CREATE TABLE `orders` (",
+		"`status` varchar(20) NOT NULL DEFAULT 'new'",
+		"ALTER TABLE `customers` ADD COLUMN `email` varchar(255) NULL AFTER `name`;",
+		"ALTER TABLE `customers` MODIFY COLUMN `name` varchar(255) NOT NULL;",
+		"ALTER TABLE `customers` ADD UNIQUE KEY `customers_email_unique` (`email`);",
+		"ALTER TABLE `customers` DROP COLUMN `fax`;",
+		"ALTER TABLE `orders` ADD CONSTRAINT `orders_customer_fk` FOREIGN KEY (`customer_id`) REFERENCES `customers` (`id`) ON DELETE CASCADE;",
+		"DROP TABLE `legacy_audit`;",
+	}
+
+	last := -1
+	for _, statement := range expected {
+		position := strings.Index(migration, statement)
+
+		if position < 0 {
+			t.Fatalf("expected migration to contain %q, got:\n%s", statement, migration)
+		}
+
+		if position < last {
+			t.Errorf("expected %q to come later in the migration:\n%s", statement, migration)
+		}
+
+		last = position
+	}
+
+	if !Compare(to, to).IsEmpty() {
+		t.Error("expected comparing a snapshot with itself to be empty")
+	}
+}
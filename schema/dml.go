@@ -0,0 +1,248 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Modes of InsertStatements. Upsert updates rows whose key already exists;
+// merge does the same with a MERGE statement where the dialect has one
+const (
+	InsertPlain  = "insert"
+	InsertIgnore = "insert-ignore"
+	InsertUpsert = "upsert"
+	InsertMerge  = "merge"
+)
+
+// QuoteIdentifier quotes a table or column name for the dialect
+func QuoteIdentifier(dialect Dialect, name string) string {
+	if dialect == DialectMySQL {
+		return quoteIdentifier(name)
+	}
+
+	return quoteStandardIdentifier(name)
+}
+
+// QuoteString quotes a string literal for the dialect
+func QuoteString(dialect Dialect, value string) string {
+	if dialect == DialectMySQL {
+		return quoteString(value)
+	}
+
+	return quoteStandardString(value)
+}
+
+// SplitColumnType splits a type such as "decimal(10,2) unsigned" into its
+// lowercase base type, its arguments and whether it is unsigned
+func SplitColumnType(columnType string) (base string, args string, unsigned bool) {
+	return splitColumnType(columnType)
+}
+
+// EnumValues returns the members of an enum or set column type such as
+// "enum('new','paid')", or nil for any other type. Doubled quotes inside
+// a member stand for one quote
+func EnumValues(columnType string) []string {
+	base, args, _ := splitColumnType(columnType)
+	if base != "enum" && base != "set" {
+		return nil
+	}
+
+	values := []string{}
+	var current strings.Builder
+	quoted := false
+
+	for i := 0; i < len(args); i++ {
+		switch c := args[i]; {
+		case c == '\'' && quoted && i+1 < len(args) && args[i+1] == '\'':
+			current.WriteByte(c)
+			i++
+		case c == '\'':
+			if quoted {
+				values = append(values, current.String())
+				current.Reset()
+			}
+
+			quoted = !quoted
+		case quoted:
+			current.WriteByte(c)
+		}
+	}
+
+	return values
+}
+
+// ConflictColumns returns the key that tells whether a row already exists:
+// the primary key or else the first unique index, as long as all of its
+// columns are among columns. It returns nil when there is no such key
+func (t *Table) ConflictColumns(columns []string) []string {
+	mapped := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		mapped[column] = true
+	}
+
+	covered := func(key []string) bool {
+		for _, column := range key {
+			if !mapped[column] {
+				return false
+			}
+		}
+
+		return len(key) > 0
+	}
+
+	if primary := primaryIndex(*t); primary != nil {
+		if covered(primary.Columns) {
+			return primary.Columns
+		}
+	} else {
+		// Snapshots without index details still flag primary key columns
+		key := []string{}
+
+		for _, column := range t.Columns {
+			if column.IsPrimary {
+				key = append(key, column.Name)
+			}
+		}
+
+		if covered(key) {
+			return key
+		}
+	}
+
+	for _, index := range t.Indexes {
+		if index.Unique && !index.Primary && covered(index.Columns) {
+			return index.Columns
+		}
+	}
+
+	return nil
+}
+
+// InsertStatements renders one statement per row, each on a single line.
+// Every row holds a SQL literal for each of columns, in the same order
+func InsertStatements(table Table, columns []string, rows [][]string, mode string, dialect Dialect) ([]string, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("map at least one column of %s", table.Name)
+	}
+
+	targetTypes := make([]string, len(columns))
+	quoted := make([]string, len(columns))
+
+	for i, name := range columns {
+		column := table.FindColumn(name)
+		if column == nil {
+			return nil, fmt.Errorf("table %s has no column %s", table.Name, name)
+		}
+
+		base, args, unsigned := splitColumnType(column.Type)
+		targetTypes[i] = postgresType(base, args, unsigned)
+		quoted[i] = QuoteIdentifier(dialect, name)
+	}
+
+	var key []string
+	updates := []string{}
+
+	switch mode {
+	case InsertPlain, InsertIgnore:
+	case InsertUpsert, InsertMerge:
+		if mode == InsertMerge && dialect != DialectPostgres {
+			return nil, fmt.Errorf("%s has no MERGE statement, use upsert instead", dialect)
+		}
+
+		key = table.ConflictColumns(columns)
+		if key == nil {
+			return nil, fmt.Errorf("%s needs the primary key or a unique index of %s among the mapped columns", mode, table.Name)
+		}
+
+		inKey := make(map[string]bool, len(key))
+		for _, column := range key {
+			inKey[column] = true
+		}
+
+		for i, column := range columns {
+			if !inKey[column] {
+				updates = append(updates, quoted[i])
+			}
+		}
+
+		if len(updates) == 0 && mode == InsertUpsert {
+			return nil, fmt.Errorf("every mapped column is part of the key, use insert-ignore instead")
+		}
+	default:
+		return nil, fmt.Errorf("unknown insert mode %q", mode)
+	}
+
+	name := QuoteIdentifier(dialect, table.Name)
+	list := strings.Join(quoted, ", ")
+	statements := make([]string, len(rows))
+
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("row %d has %d values for %d columns", i+1, len(row), len(columns))
+		}
+
+		values := strings.Join(row, ", ")
+
+		switch {
+		case mode == InsertPlain:
+			statements[i] = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", name, list, values)
+		case mode == InsertIgnore && dialect == DialectMySQL:
+			statements[i] = fmt.Sprintf("INSERT IGNORE INTO %s (%s) VALUES (%s);", name, list, values)
+		case mode == InsertIgnore:
+			statements[i] = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING;", name, list, values)
+		case mode == InsertUpsert && dialect == DialectMySQL:
+			assignments := make([]string, len(updates))
+			for j, column := range updates {
+				assignments[j] = fmt.Sprintf("%s = VALUES(%s)", column, column)
+			}
+
+			statements[i] = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s;", name, list, values, strings.Join(assignments, ", "))
+		case mode == InsertUpsert:
+			assignments := make([]string, len(updates))
+			for j, column := range updates {
+				assignments[j] = fmt.Sprintf("%s = EXCLUDED.%s", column, column)
+			}
+
+			statements[i] = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s;", name, list, values,
+				quoteStandardIdentifiers(key), strings.Join(assignments, ", "))
+		default:
+			statements[i] = mergeStatement(name, quoted, key, updates, row, targetTypes)
+		}
+	}
+
+	return statements, nil
+}
+
+// mergeStatement renders a PostgreSQL MERGE of one row. The literals are
+// cast to the column types, since a VALUES list alone types them as text
+func mergeStatement(table string, columns []string, key []string, updates []string, row []string, types []string) string {
+	casted := make([]string, len(row))
+	for i, value := range row {
+		casted[i] = fmt.Sprintf("CAST(%s AS %s)", value, types[i])
+	}
+
+	conditions := make([]string, len(key))
+	for i, column := range key {
+		quoted := quoteStandardIdentifier(column)
+		conditions[i] = fmt.Sprintf("target.%s = source.%s", quoted, quoted)
+	}
+
+	sources := make([]string, len(columns))
+	for i, column := range columns {
+		sources[i] = "source." + column
+	}
+
+	statement := fmt.Sprintf("MERGE INTO %s AS target USING (VALUES (%s)) AS source (%s) ON %s",
+		table, strings.Join(casted, ", "), strings.Join(columns, ", "), strings.Join(conditions, " AND "))
+
+	if len(updates) > 0 {
+		assignments := make([]string, len(updates))
+		for i, column := range updates {
+			assignments[i] = fmt.Sprintf("%s = source.%s", column, column)
+		}
+
+		statement += " WHEN MATCHED THEN UPDATE SET " + strings.Join(assignments, ", ")
+	}
+
+	return statement + fmt.Sprintf(" WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s);", strings.Join(columns, ", "), strings.Join(sources, ", "))
+}
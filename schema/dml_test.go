@@ -0,0 +1,111 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func dmlFixture() Table {
+	return Table{
+		Name: "customers",
+		Type: TableTypeBase,
+		Columns: []Column{
+			{Name: "id", Type: "int(10) unsigned", Nullable: "NO", Extra: "auto_increment", IsPrimary: true},
+			{Name: "email", Type: "varchar(120)", Nullable: "NO"},
+			{Name: "name", Type: "varchar(80)", Nullable: "YES"},
+			{Name: "born_on", Type: "date", Nullable: "YES"},
+		},
+		Indexes: []Index{
+			{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+			{Name: "email", Columns: []string{"email"}, Unique: true},
+		},
+	}
+}
+
+func TestEnumValues(t *testing.T) {
+	if values := EnumValues("enum('active','it''s closed','a,b')"); !reflect.DeepEqual(values, []string{"active", "it's closed", "a,b"}) {
+		t.Errorf("unexpected enum values %q", values)
+	}
+
+	if values := EnumValues("varchar(10)"); values != nil {
+		t.Errorf("expected no values for varchar, got %q", values)
+	}
+}
+
+func TestConflictColumns(t *testing.T) {
+	table := dmlFixture()
+
+	if key := table.ConflictColumns([]string{"id", "name"}); !reflect.DeepEqual(key, []string{"id"}) {
+		t.Errorf("expected the primary key, got %v", key)
+	}
+
+	if key := table.ConflictColumns([]string{"email", "name"}); !reflect.DeepEqual(key, []string{"email"}) {
+		t.Errorf("expected the unique email index, got %v", key)
+	}
+
+	if key := table.ConflictColumns([]string{"name"}); key != nil {
+		t.Errorf("expected no key, got %v", key)
+	}
+
+	table.Indexes = nil
+
+	if key := table.ConflictColumns([]string{"id"}); !reflect.DeepEqual(key, []string{"id"}) {
+		t.Errorf("expected primary key columns to be used without indexes, got %v", key)
+	}
+}
+
+func TestInsertStatements(t *testing.T) {
+	table := dmlFixture()
+	columns := []string{"email", "name", "born_on"}
+	rows := [][]string{{"'ana@example.com'", "'Ana'", "'1990-05-01'"}}
+
+	cases := []struct {
+		mode     string
+		dialect  Dialect
+		expected string
+	}{
+		{InsertPlain, DialectMySQL, "INSERT INTO `customers` (`email`, `name`, `born_on`) VALUES ('ana@example.com', 'Ana', '1990-05-01');"},
+		{InsertIgnore, DialectMySQL, "INSERT IGNORE INTO `customers` (`email`, `name`, `born_on`) VALUES ('ana@example.com', 'Ana', '1990-05-01');"},
+		{InsertIgnore, DialectSQLite, `INSERT INTO "customers" ("email", "name", "born_on") VALUES ('ana@example.com', 'Ana', '1990-05-01') ON CONFLICT DO NOTHING;`},
+		{InsertUpsert, DialectMySQL, "INSERT INTO `customers` (`email`, `name`, `born_on`) VALUES ('ana@example.com', 'Ana', '1990-05-01') ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `born_on` = VALUES(`born_on`);"},
+		{InsertUpsert, DialectPostgres, `INSERT INTO "customers" ("email", "name", "born_on") VALUES ('ana@example.com', 'Ana', '1990-05-01') ON CONFLICT ("email") DO UPDATE SET "name" = EXCLUDED."name", "born_on" = EXCLUDED."born_on";`},
+		{InsertMerge, DialectPostgres, `MERGE INTO "customers" AS target USING (VALUES (CAST('ana@example.com' AS varchar(120)), CAST('Ana' AS varchar(80)), CAST('1990-05-01' AS date))) AS source ("email", "name", "born_on") ON target."email" = source."email" WHEN MATCHED THEN UPDATE SET "name" = source."name", "born_on" = source."born_on" WHEN NOT MATCHED THEN INSERT ("email", "name", "born_on") VALUES (source."email", source."name", source."born_on");`},
+	}
+
+	for _, c := range cases {
+		statements, err := InsertStatements(table, columns, rows, c.mode, c.dialect)
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.mode, c.dialect, err)
+		}
+
+		if len(statements) != 1 || statements[0] != c.expected {
+			t.Errorf("%s %s:\nexpected %s\ngot      %v", c.mode, c.dialect, c.expected, statements)
+		}
+	}
+
+	failures := []struct {
+		columns []string
+		mode    string
+		dialect Dialect
+		message string
+	}{
+		{columns, InsertMerge, DialectMySQL, "no MERGE"},
+		{[]string{"name"}, InsertUpsert, DialectMySQL, "needs the primary key"},
+		{[]string{"email"}, InsertUpsert, DialectPostgres, "use insert-ignore"},
+		{[]string{"missing"}, InsertPlain, DialectMySQL, "no column missing"},
+		{columns, "replace", DialectMySQL, "unknown insert mode"},
+	}
+
+	for _, f := range failures {
+		values := make([]string, len(f.columns))
+		for i := range values {
+			values[i] = "NULL"
+		}
+
+		_, err := InsertStatements(table, f.columns, [][]string{values}, f.mode, f.dialect)
+		if err == nil || !strings.Contains(err.Error(), f.message) {
+			t.Errorf("%s %v: expected an error about %q, got %v", f.mode, f.columns, f.message, err)
+		}
+	}
+}
@@ -0,0 +1,542 @@
+package schema
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Diagram formats
+const (
+	DiagramMermaid  = "mermaid"
+	DiagramDOT      = "dot"
+	DiagramPlantUML = "plantuml"
+	DiagramDBML     = "dbml"
+)
+
+// DiagramOptions narrows an exported diagram. Tables keeps only the listed
+// tables; FocusTable keeps the tables within Hops foreign keys of it, in
+// either direction. Both can be combined
+type DiagramOptions struct {
+	Tables     []string `json:"tables"`
+	FocusTable string   `json:"focusTable"`
+	Hops       int      `json:"hops"`
+}
+
+// Filter returns a copy of the structure holding only the tables selected by
+// the options. Foreign keys into tables that were left out are dropped
+func (s *Structure) Filter(options DiagramOptions) (Structure, error) {
+	keep := make(map[string]bool)
+
+	for _, table := range s.Tables {
+		keep[table.Name] = true
+	}
+
+	if len(options.Tables) > 0 {
+		selected := make(map[string]bool)
+
+		for _, name := range options.Tables {
+			if s.FindTable(name) == nil {
+				return Structure{}, fmt.Errorf("table %q is not in the structure", name)
+			}
+
+			selected[name] = true
+		}
+
+		keep = selected
+	}
+
+	if options.FocusTable != "" {
+		if !keep[options.FocusTable] {
+			return Structure{}, fmt.Errorf("table %q is not in the structure", options.FocusTable)
+		}
+
+		keep = s.neighbourhood(options.FocusTable, options.Hops, keep)
+	}
+
+	filtered := Structure{DBType: s.DBType, Routines: s.Routines, Triggers: []Trigger{}}
+
+	for _, table := range s.Tables {
+		if !keep[table.Name] {
+			continue
+		}
+
+		foreignKeys := []ForeignKey{}
+		for _, fk := range table.ForeignKeys {
+			if keep[fk.ReferencedTable] {
+				foreignKeys = append(foreignKeys, fk)
+			}
+		}
+
+		table.ForeignKeys = foreignKeys
+		filtered.Tables = append(filtered.Tables, table)
+	}
+
+	for _, trigger := range s.Triggers {
+		if keep[trigger.Table] {
+			filtered.Triggers = append(filtered.Triggers, trigger)
+		}
+	}
+
+	return filtered, nil
+}
+
+// neighbourhood walks the foreign key graph outwards from focus, following
+// references in both directions, and returns the allowed tables reached
+// within hops steps
+func (s *Structure) neighbourhood(focus string, hops int, allowed map[string]bool) map[string]bool {
+	neighbours := make(map[string][]string)
+
+	for _, table := range s.Tables {
+		for _, fk := range table.ForeignKeys {
+			neighbours[table.Name] = append(neighbours[table.Name], fk.ReferencedTable)
+			neighbours[fk.ReferencedTable] = append(neighbours[fk.ReferencedTable], table.Name)
+		}
+	}
+
+	reached := map[string]bool{focus: true}
+	frontier := []string{focus}
+
+	for step := 0; step < hops && len(frontier) > 0; step++ {
+		next := []string{}
+
+		for _, name := range frontier {
+			for _, neighbour := range neighbours[name] {
+				if reached[neighbour] || !allowed[neighbour] {
+					continue
+				}
+
+				reached[neighbour] = true
+				next = append(next, neighbour)
+			}
+		}
+
+		frontier = next
+	}
+
+	return reached
+}
+
+// ExportDiagram renders the structure as Mermaid erDiagram, Graphviz DOT,
+// PlantUML or DBML text, after applying the options
+func ExportDiagram(structure Structure, format string, options DiagramOptions) (string, error) {
+	filtered, err := structure.Filter(options)
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(format) {
+	case DiagramMermaid:
+		return exportMermaid(filtered), nil
+	case DiagramDOT, "graphviz":
+		return exportDOT(filtered), nil
+	case DiagramPlantUML:
+		return exportPlantUML(filtered), nil
+	case DiagramDBML:
+		return exportDBML(filtered), nil
+	}
+
+	return "", fmt.Errorf("unsupported diagram format %q", format)
+}
+
+// columnKeys lists the key markers for a column: PK, FK and UK
+func columnKeys(table Table, column Column) []string {
+	keys := []string{}
+
+	if column.IsPrimary {
+		keys = append(keys, "PK")
+	}
+
+	for _, fk := range table.ForeignKeys {
+		if fk.ColumnName == column.Name {
+			keys = append(keys, "FK")
+			break
+		}
+	}
+
+	if column.IsUnique && !column.IsPrimary {
+		keys = append(keys, "UK")
+	}
+
+	return keys
+}
+
+// foreignKeyOptional reports whether a row may exist without its parent,
+// i.e. any column of the foreign key is nullable
+func foreignKeyOptional(table Table, fk ForeignKeyConstraint) bool {
+	for _, name := range fk.Columns {
+		if column := table.FindColumn(name); column != nil && !strings.EqualFold(column.Nullable, "NO") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// foreignKeyUnique reports whether at most one row can point at each parent
+func foreignKeyUnique(table Table, fk ForeignKeyConstraint) bool {
+	for _, index := range table.Indexes {
+		if index.Unique && len(index.Columns) == len(fk.Columns) && strings.Join(index.Columns, ",") == strings.Join(fk.Columns, ",") {
+			return true
+		}
+	}
+
+	return false
+}
+
+var diagramName = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// diagramIdentifier turns a table name into a bare identifier the diagram
+// languages accept
+func diagramIdentifier(name string) string {
+	return diagramName.ReplaceAllString(name, "_")
+}
+
+func exportMermaid(structure Structure) string {
+	var sb strings.Builder
+
+	sb.WriteString("erDiagram\n")
+
+	for _, table := range structure.Tables {
+		fmt.Fprintf(&sb, "    %s {\n", diagramIdentifier(table.Name))
+
+		for _, column := range table.Columns {
+			base, _, _ := splitColumnType(column.Type)
+			fmt.Fprintf(&sb, "        %s %s", diagramIdentifier(base), diagramIdentifier(column.Name))
+
+			if keys := columnKeys(table, column); len(keys) > 0 {
+				sb.WriteString(" " + strings.Join(keys, ", "))
+			}
+
+			if column.Description != "" {
+				fmt.Fprintf(&sb, " %q", strings.ReplaceAll(column.Description, `"`, "'"))
+			}
+
+			sb.WriteString("\n")
+		}
+
+		sb.WriteString("    }\n")
+	}
+
+	for _, table := range structure.Tables {
+		for _, fk := range table.ForeignKeyConstraints() {
+			parent := "||"
+			if foreignKeyOptional(table, fk) {
+				parent = "|o"
+			}
+
+			child := "o{"
+			if foreignKeyUnique(table, fk) {
+				child = "o|"
+			}
+
+			fmt.Fprintf(&sb, "    %s %s--%s %s : %q\n", diagramIdentifier(fk.ReferencedTable), parent, child,
+				diagramIdentifier(table.Name), strings.Join(fk.Columns, ", "))
+		}
+	}
+
+	return sb.String()
+}
+
+func exportDOT(structure Structure) string {
+	var sb strings.Builder
+
+	sb.WriteString("digraph schema {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=plaintext, fontname=\"Helvetica\"];\n")
+	sb.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n\n")
+
+	for _, table := range structure.Tables {
+		header, style := "#e5e7eb", ""
+		if table.IsView() {
+			header, style = "#ccfbf1", ` style="dashed"`
+		}
+
+		fmt.Fprintf(&sb, "  %q [label=<<table border=\"1\" cellborder=\"0\" cellspacing=\"0\" cellpadding=\"4\"%s>\n", table.Name, style)
+		fmt.Fprintf(&sb, "    <tr><td bgcolor=\"%s\"><b>%s</b></td></tr>\n", header, html.EscapeString(table.Name))
+
+		for i, column := range table.Columns {
+			label := html.EscapeString(column.Name + " : " + column.Type)
+
+			if keys := columnKeys(table, column); len(keys) > 0 {
+				label += " <i>" + strings.Join(keys, ", ") + "</i>"
+			}
+
+			fmt.Fprintf(&sb, "    <tr><td port=\"c%d\" align=\"left\">%s</td></tr>\n", i, label)
+		}
+
+		sb.WriteString("  </table>>];\n")
+	}
+
+	for _, table := range structure.Tables {
+		for _, fk := range table.ForeignKeyConstraints() {
+			from := fmt.Sprintf("%q", table.Name)
+			to := fmt.Sprintf("%q", fk.ReferencedTable)
+
+			// Anchor single-column keys on the columns themselves
+			if len(fk.Columns) == 1 {
+				from += dotPort(table, fk.Columns[0])
+				if referenced := structure.FindTable(fk.ReferencedTable); referenced != nil {
+					to += dotPort(*referenced, fk.ReferencedColumns[0])
+				}
+			}
+
+			fmt.Fprintf(&sb, "  %s -> %s [label=%q];\n", from, to, fk.Name)
+		}
+	}
+
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+func dotPort(table Table, column string) string {
+	for i := range table.Columns {
+		if table.Columns[i].Name == column {
+			return fmt.Sprintf(":c%d", i)
+		}
+	}
+
+	return ""
+}
+
+func exportPlantUML(structure Structure) string {
+	var sb strings.Builder
+
+	sb.WriteString("@startuml\n")
+	sb.WriteString("hide circle\n")
+	sb.WriteString("skinparam linetype ortho\n\n")
+
+	for _, table := range structure.Tables {
+		stereotype := ""
+		if table.IsView() {
+			stereotype = " <<view>>"
+		}
+
+		fmt.Fprintf(&sb, "entity %q as %s%s {\n", table.Name, diagramIdentifier(table.Name), stereotype)
+
+		writeColumn := func(column Column) {
+			marker := "  "
+			if strings.EqualFold(column.Nullable, "NO") {
+				marker = "  * "
+			}
+
+			fmt.Fprintf(&sb, "%s%s : %s", marker, column.Name, column.Type)
+
+			for _, key := range columnKeys(table, column) {
+				fmt.Fprintf(&sb, " <<%s>>", key)
+			}
+
+			sb.WriteString("\n")
+		}
+
+		// Primary key columns sit above the separator, as PlantUML ER diagrams expect
+		hasPrimary := false
+		for _, column := range table.Columns {
+			if column.IsPrimary {
+				writeColumn(column)
+				hasPrimary = true
+			}
+		}
+
+		if hasPrimary {
+			sb.WriteString("  --\n")
+		}
+
+		for _, column := range table.Columns {
+			if !column.IsPrimary {
+				writeColumn(column)
+			}
+		}
+
+		sb.WriteString("}\n\n")
+	}
+
+	for _, table := range structure.Tables {
+		for _, fk := range table.ForeignKeyConstraints() {
+			child := "}o"
+			if foreignKeyUnique(table, fk) {
+				child = "|o"
+			}
+
+			parent := "||"
+			if foreignKeyOptional(table, fk) {
+				parent = "o|"
+			}
+
+			fmt.Fprintf(&sb, "%s %s--%s %s : %s\n", diagramIdentifier(table.Name), child, parent,
+				diagramIdentifier(fk.ReferencedTable), fk.Name)
+		}
+	}
+
+	sb.WriteString("@enduml\n")
+
+	return sb.String()
+}
+
+var dbmlBareType = regexp.MustCompile(`^[A-Za-z0-9_]+(\([0-9, ]*\))?$`)
+
+func exportDBML(structure Structure) string {
+	var sb strings.Builder
+
+	for _, table := range structure.Tables {
+		if table.IsView() {
+			// DBML has no notion of views
+			fmt.Fprintf(&sb, "// View %s\n\n", table.Name)
+			continue
+		}
+
+		fmt.Fprintf(&sb, "Table %s {\n", dbmlName(table.Name))
+
+		primary := primaryIndex(table)
+
+		for _, column := range table.Columns {
+			columnType := column.Type
+			if !dbmlBareType.MatchString(columnType) {
+				columnType = `"` + strings.ReplaceAll(columnType, `"`, `\"`) + `"`
+			}
+
+			settings := []string{}
+
+			if primary != nil && len(primary.Columns) == 1 && column.IsPrimary {
+				settings = append(settings, "pk")
+			}
+
+			if strings.Contains(strings.ToLower(column.Extra), "auto_increment") {
+				settings = append(settings, "increment")
+			}
+
+			if strings.EqualFold(column.Nullable, "NO") && !column.IsPrimary {
+				settings = append(settings, "not null")
+			}
+
+			if column.IsUnique && !column.IsPrimary {
+				settings = append(settings, "unique")
+			}
+
+			if columnHasDefault(column) {
+				settings = append(settings, "default: "+dbmlDefault(column))
+			}
+
+			if column.Description != "" {
+				settings = append(settings, "note: "+dbmlString(column.Description))
+			}
+
+			fmt.Fprintf(&sb, "  %s %s", dbmlName(column.Name), columnType)
+
+			if len(settings) > 0 {
+				sb.WriteString(" [" + strings.Join(settings, ", ") + "]")
+			}
+
+			sb.WriteString("\n")
+		}
+
+		indexes := []string{}
+
+		for _, index := range table.Indexes {
+			if len(index.Columns) == 0 || (index.Primary && len(index.Columns) == 1) || (index.Unique && !index.Primary && len(index.Columns) == 1) {
+				continue
+			}
+
+			settings := []string{}
+			switch {
+			case index.Primary:
+				settings = append(settings, "pk")
+			case index.Unique:
+				settings = append(settings, "unique", "name: "+dbmlString(index.Name))
+			default:
+				settings = append(settings, "name: "+dbmlString(index.Name))
+			}
+
+			indexes = append(indexes, fmt.Sprintf("    %s [%s]", dbmlColumns(index.Columns), strings.Join(settings, ", ")))
+		}
+
+		if len(indexes) > 0 {
+			sb.WriteString("\n  indexes {\n" + strings.Join(indexes, "\n") + "\n  }\n")
+		}
+
+		if table.Description != "" {
+			fmt.Fprintf(&sb, "\n  Note: %s\n", dbmlString(table.Description))
+		}
+
+		sb.WriteString("}\n\n")
+	}
+
+	for _, table := range structure.Tables {
+		for _, fk := range table.ForeignKeyConstraints() {
+			relation := ">"
+			if foreignKeyUnique(table, fk) {
+				relation = "-"
+			}
+
+			fmt.Fprintf(&sb, "Ref %s: %s.%s %s %s.%s", dbmlName(fk.Name), dbmlName(table.Name), dbmlColumns(fk.Columns),
+				relation, dbmlName(fk.ReferencedTable), dbmlColumns(fk.ReferencedColumns))
+
+			settings := []string{}
+			if fk.OnDelete != "" && fk.OnDelete != "RESTRICT" && fk.OnDelete != "NO ACTION" {
+				settings = append(settings, "delete: "+strings.ToLower(fk.OnDelete))
+			}
+
+			if fk.OnUpdate != "" && fk.OnUpdate != "RESTRICT" && fk.OnUpdate != "NO ACTION" {
+				settings = append(settings, "update: "+strings.ToLower(fk.OnUpdate))
+			}
+
+			if len(settings) > 0 {
+				sb.WriteString(" [" + strings.Join(settings, ", ") + "]")
+			}
+
+			sb.WriteString("\n")
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+func dbmlName(name string) string {
+	if diagramName.MatchString(name) {
+		return `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+	}
+
+	return name
+}
+
+func dbmlColumns(names []string) string {
+	if len(names) == 1 {
+		return dbmlName(names[0])
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = dbmlName(name)
+	}
+
+	return "(" + strings.Join(quoted, ", ") + ")"
+}
+
+func dbmlString(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// dbmlDefault renders a default as a DBML number, string or `expression`
+func dbmlDefault(column Column) string {
+	value := column.Default
+
+	switch {
+	case strings.EqualFold(value, "NULL"):
+		return "null"
+	case numericLiteral.MatchString(value) && !isStringType(column.Type):
+		return value
+	case strings.Contains(column.Extra, "DEFAULT_GENERATED") || defaultExpression.MatchString(value):
+		return "`" + value + "`"
+	}
+
+	if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) > 1 {
+		// MariaDB reports string defaults already quoted
+		value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+
+	return dbmlString(value)
+}
@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterAroundFocusTable(t *testing.T) {
+	structure := generateFixture()
+	structure.Tables[2].ForeignKeys = nil
+
+	filtered, err := structure.Filter(DiagramOptions{FocusTable: "order_items", Hops: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(filtered.Tables) != 2 || filtered.FindTable("orders") == nil {
+		t.Fatalf("expected order_items and orders within one hop, got %+v", filtered.Tables)
+	}
+
+	if len(filtered.FindTable("orders").ForeignKeys) != 0 {
+		t.Error("expected the foreign key to the filtered out customers table to be dropped")
+	}
+
+	filtered, err = structure.Filter(DiagramOptions{FocusTable: "order_items", Hops: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(filtered.Tables) != 3 || filtered.FindTable("customers") == nil {
+		t.Fatalf("expected customers within two hops, got %d tables", len(filtered.Tables))
+	}
+
+	filtered, err = structure.Filter(DiagramOptions{Tables: []string{"orders", "order_items", "categories"}, FocusTable: "categories", Hops: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(filtered.Tables) != 1 {
+		t.Errorf("expected categories to have no neighbours, got %d tables", len(filtered.Tables))
+	}
+
+	if _, err := structure.Filter(DiagramOptions{FocusTable: "missing"}); err == nil {
+		t.Error("expected an unknown focus table to be rejected")
+	}
+}
+
+func TestExportDiagram(t *testing.T) {
+	structure := generateFixture()
+
+	cases := map[string][]string{
+		DiagramMermaid: {
+			"erDiagram",
+			"    customers {",
+			`        varchar email UK "Login e-mail"`,
+			`    orders ||--o{ order_items : "order_id"`,
+			`    orders |o--o{ customers : "last_order_id"`,
+		},
+		DiagramDOT: {
+			"digraph schema {",
+			`<tr><td port="c1" align="left">order_id : int(10) unsigned <i>FK</i></td></tr>`,
+			`"order_items":c1 -> "orders":c0 [label="order_items_order_fk"];`,
+		},
+		DiagramPlantUML: {
+			"@startuml",
+			`entity "orders" as orders {`,
+			"  * id : int(10) unsigned <<PK>>\n  --\n",
+			"order_items }o--|| orders : order_items_order_fk",
+			"@enduml",
+		},
+		DiagramDBML: {
+			"Table orders {",
+			`  id "int(10) unsigned" [pk, increment]`,
+			"  status \"enum('new','paid')\" [not null, default: 'new']",
+			"  created_at datetime [not null, default: `CURRENT_TIMESTAMP`]",
+			"Ref order_items_order_fk: order_items.order_id > orders.id [delete: cascade]",
+		},
+	}
+
+	for format, expected := range cases {
+		diagram, err := ExportDiagram(structure, format, DiagramOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		for _, fragment := range expected {
+			if !strings.Contains(diagram, fragment) {
+				t.Errorf("%s: expected diagram to contain %q, got:\n%s", format, fragment, diagram)
+			}
+		}
+	}
+
+	if _, err := ExportDiagram(structure, "svg", DiagramOptions{}); err == nil {
+		t.Error("expected an unsupported format to be rejected")
+	}
+}
@@ -0,0 +1,174 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect is a SQL flavour DDL can be generated for
+type Dialect string
+
+// Supported dialects
+const (
+	DialectMySQL    Dialect = "mysql"
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+// ParseDialect resolves a dialect name as the frontend sends it
+func ParseDialect(name string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "mysql", "mariadb":
+		return DialectMySQL, nil
+	case "postgres", "postgresql":
+		return DialectPostgres, nil
+	case "sqlite", "sqlite3":
+		return DialectSQLite, nil
+	}
+
+	return "", fmt.Errorf("unsupported dialect %q", name)
+}
+
+// DependencyOrder returns the base tables of the structure ordered so that
+// every table comes after the tables its foreign keys reference. Self
+// references are ignored. When tables reference each other in a cycle, the
+// table most others are waiting on goes first and its foreign keys into the
+// cycle have to be added once the rest exists
+func (s *Structure) DependencyOrder() []Table {
+	tables := make(map[string]Table)
+	dependents := make(map[string][]string)
+	pending := make(map[string]int)
+	names := []string{}
+
+	for _, table := range s.Tables {
+		if table.IsView() {
+			continue
+		}
+
+		tables[table.Name] = table
+		names = append(names, table.Name)
+	}
+
+	for _, name := range names {
+		seen := make(map[string]bool)
+
+		for _, fk := range tables[name].ForeignKeys {
+			referenced := fk.ReferencedTable
+
+			if referenced == name || seen[referenced] {
+				continue
+			}
+
+			// References to tables outside the snapshot cannot be satisfied here
+			if _, ok := tables[referenced]; !ok {
+				continue
+			}
+
+			seen[referenced] = true
+			pending[name]++
+			dependents[referenced] = append(dependents[referenced], name)
+		}
+	}
+
+	ordered := make([]Table, 0, len(names))
+	done := make(map[string]bool, len(names))
+
+	for len(ordered) < len(names) {
+		next := ""
+
+		// Tables whose references all exist go first, in snapshot order
+		for _, name := range names {
+			if !done[name] && pending[name] == 0 {
+				next = name
+				break
+			}
+		}
+
+		if next == "" {
+			next = cycleBreaker(names, done, dependents)
+		}
+
+		ordered = append(ordered, tables[next])
+		done[next] = true
+
+		for _, dependent := range dependents[next] {
+			pending[dependent]--
+		}
+	}
+
+	return ordered
+}
+
+// cycleBreaker picks the remaining table the most other remaining tables
+// depend on, so as few foreign keys as possible have to be deferred
+func cycleBreaker(names []string, done map[string]bool, dependents map[string][]string) string {
+	best, bestCount := "", -1
+
+	for _, name := range names {
+		if done[name] {
+			continue
+		}
+
+		count := 0
+		for _, dependent := range dependents[name] {
+			if !done[dependent] {
+				count++
+			}
+		}
+
+		if count > bestCount {
+			best, bestCount = name, count
+		}
+	}
+
+	return best
+}
+
+// GenerateDDL renders the statements that create an empty copy of the
+// structure in the given dialect. Tables are created in dependency order and
+// foreign keys that close a reference cycle are added once every table
+// exists, except on SQLite where references are only resolved at runtime
+func GenerateDDL(structure Structure, dialect Dialect) (string, error) {
+	var generator ddlGenerator
+
+	switch dialect {
+	case DialectMySQL:
+		generator = mysqlGenerator{}
+	case DialectPostgres:
+		generator = postgresGenerator{}
+	case DialectSQLite:
+		generator = sqliteGenerator{}
+	default:
+		return "", fmt.Errorf("unsupported dialect %q", dialect)
+	}
+
+	var statements, alters []string
+	created := make(map[string]bool)
+
+	for _, table := range structure.DependencyOrder() {
+		inline := []ForeignKeyConstraint{}
+
+		for _, fk := range table.ForeignKeyConstraints() {
+			if dialect == DialectSQLite || fk.ReferencedTable == table.Name || created[fk.ReferencedTable] || structure.FindTable(fk.ReferencedTable) == nil {
+				inline = append(inline, fk)
+				continue
+			}
+
+			alters = append(alters, generator.addForeignKey(table.Name, fk))
+		}
+
+		statements = append(statements, generator.createTable(table, inline)...)
+		created[table.Name] = true
+	}
+
+	statements = append(statements, alters...)
+
+	// Views last, since they may select from any of the tables above
+	for _, table := range structure.Tables {
+		if table.IsView() {
+			statements = append(statements, generator.createView(table))
+		}
+	}
+
+	return strings.Join(statements, "\n\n"), nil
+}
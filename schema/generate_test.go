@@ -0,0 +1,186 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func generateFixture() Structure {
+	return Structure{
+		DBType: "mysql",
+		Tables: []Table{
+			{
+				Name: "order_items",
+				Type: TableTypeBase,
+				Columns: []Column{
+					{Name: "id", Type: "int(10) unsigned", Nullable: "NO", Extra: "auto_increment", IsPrimary: true},
+					{Name: "order_id", Type: "int(10) unsigned", Nullable: "NO"},
+					{Name: "quantity", Type: "smallint", Nullable: "NO", Default: "1", HasDefault: true},
+				},
+				Indexes: []Index{
+					{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+					{Name: "order_id", Columns: []string{"order_id"}},
+				},
+				ForeignKeys: []ForeignKey{
+					{ColumnName: "order_id", ReferencedTable: "orders", ReferencedColumn: "id", ConstraintName: "order_items_order_fk", OnDelete: "CASCADE"},
+				},
+			},
+			{
+				Name: "orders",
+				Type: TableTypeBase,
+				Columns: []Column{
+					{Name: "id", Type: "int(10) unsigned", Nullable: "NO", Extra: "auto_increment", IsPrimary: true},
+					{Name: "customer_id", Type: "int(10) unsigned", Nullable: "NO"},
+					{Name: "status", Type: "enum('new','paid')", Nullable: "NO", Default: "new", HasDefault: true},
+					{Name: "created_at", Type: "datetime", Nullable: "NO", Default: "CURRENT_TIMESTAMP", HasDefault: true, Extra: "DEFAULT_GENERATED"},
+				},
+				Indexes: []Index{
+					{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+				},
+				ForeignKeys: []ForeignKey{
+					{ColumnName: "customer_id", ReferencedTable: "customers", ReferencedColumn: "id", ConstraintName: "orders_customer_fk"},
+				},
+			},
+			{
+				Name: "customers",
+				Type: TableTypeBase,
+				Columns: []Column{
+					{Name: "id", Type: "int(10) unsigned", Nullable: "NO", Extra: "auto_increment", IsPrimary: true},
+					{Name: "email", Type: "varchar(255)", Nullable: "NO", IsUnique: true, Description: "Login e-mail"},
+					{Name: "last_order_id", Type: "int(10) unsigned", Nullable: "YES"},
+				},
+				Indexes: []Index{
+					{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+					{Name: "email", Columns: []string{"email"}, Unique: true},
+				},
+				ForeignKeys: []ForeignKey{
+					// Closes a cycle with orders
+					{ColumnName: "last_order_id", ReferencedTable: "orders", ReferencedColumn: "id", ConstraintName: "customers_last_order_fk", OnDelete: "SET NULL"},
+				},
+			},
+			{
+				Name: "categories",
+				Type: TableTypeBase,
+				Columns: []Column{
+					{Name: "id", Type: "int", Nullable: "NO", IsPrimary: true},
+					{Name: "parent_id", Type: "int", Nullable: "YES"},
+				},
+				Indexes: []Index{
+					{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+				},
+				ForeignKeys: []ForeignKey{
+					{ColumnName: "parent_id", ReferencedTable: "categories", ReferencedColumn: "id", ConstraintName: "categories_parent_fk"},
+				},
+			},
+		},
+	}
+}
+
+func TestDependencyOrder(t *testing.T) {
+	tableNames := func(tables []Table) string {
+		names := []string{}
+		for _, table := range tables {
+			names = append(names, table.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	structure := generateFixture()
+
+	if got := tableNames(structure.DependencyOrder()); got != "categories,orders,order_items,customers" {
+		t.Errorf("expected the cycle to be broken at orders, got %s", got)
+	}
+
+	structure.Tables[2].ForeignKeys = nil
+
+	if got := tableNames(structure.DependencyOrder()); got != "customers,orders,order_items,categories" {
+		t.Errorf("tables are not in dependency order: %s", got)
+	}
+}
+
+func TestGenerateDDL(t *testing.T) {
+	structure := generateFixture()
+
+	mysql, err := GenerateDDL(structure, DialectMySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectInOrder(t, mysql, []string{
+		"CREATE TABLE `categories` (",
+		"CONSTRAINT `categories_parent_fk` FOREIGN KEY (`parent_id`) REFERENCES `categories` (`id`)",
+		"CREATE TABLE `orders` (",
+		"CREATE TABLE `order_items` (",
+		"CONSTRAINT `order_items_order_fk` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE CASCADE",
+		"CREATE TABLE `customers` (",
+		"CONSTRAINT `customers_last_order_fk` FOREIGN KEY (`last_order_id`) REFERENCES `orders` (`id`) ON DELETE SET NULL",
+		"ALTER TABLE `orders` ADD CONSTRAINT `orders_customer_fk` FOREIGN KEY (`customer_id`) REFERENCES `customers` (`id`);",
+	})
+
+	postgres, err := GenerateDDL(structure, DialectPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectInOrder(t, postgres, []string{
+		`"id" bigint GENERATED BY DEFAULT AS IDENTITY NOT NULL`,
+		`"status" text DEFAULT 'new' NOT NULL CHECK ("status" IN ('new','paid'))`,
+		`"created_at" timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL`,
+		`CREATE INDEX "order_items_order_id" ON "order_items" ("order_id");`,
+		`CREATE UNIQUE INDEX "customers_email" ON "customers" ("email");`,
+		`COMMENT ON COLUMN "customers"."email" IS 'Login e-mail';`,
+		`ALTER TABLE "orders" ADD CONSTRAINT "orders_customer_fk"`,
+	})
+
+	sqlite, err := GenerateDDL(structure, DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectInOrder(t, sqlite, []string{
+		`"id" INTEGER PRIMARY KEY AUTOINCREMENT`,
+		`CONSTRAINT "orders_customer_fk" FOREIGN KEY ("customer_id") REFERENCES "customers" ("id")`,
+	})
+
+	if strings.Contains(sqlite, "ALTER TABLE") {
+		t.Errorf("expected SQLite foreign keys to be inlined:\n%s", sqlite)
+	}
+
+	if _, err := ParseDialect("oracle"); err == nil {
+		t.Error("expected an unsupported dialect to be rejected")
+	}
+}
+
+func expectInOrder(t *testing.T, ddl string, expected []string) {
+	t.Helper()
+
+	last := -1
+	for _, statement := range expected {
+		position := strings.Index(ddl, statement)
+
+		if position < 0 {
+			t.Fatalf("expected DDL to contain %q, got:\n%s", statement, ddl)
+		}
+
+		if position < last {
+			t.Errorf("expected %q to come later in the DDL:\n%s", statement, ddl)
+		}
+
+		last = position
+	}
+}
+
+func TestColumnDefinitionExtras(t *testing.T) {
+	cases := map[string]string{
+		"auto_increment": "`id` int NOT NULL AUTO_INCREMENT",
+		"DEFAULT_GENERATED on update CURRENT_TIMESTAMP(3)": "`id` int NOT NULL ON UPDATE CURRENT_TIMESTAMP(3)",
+		"on update ":    "`id` int NOT NULL",
+		"on update    ": "`id` int NOT NULL",
+	}
+
+	for extra, expected := range cases {
+		if got := columnDefinition(Column{Name: "id", Type: "int", Nullable: "NO", Extra: extra}); got != expected {
+			t.Errorf("%q: expected %q, got %q", extra, expected, got)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Progress reports how far a schema scan has come
+type Progress struct {
+	Stage      string `json:"stage"`
+	Step       int    `json:"step"`
+	TotalSteps int    `json:"totalSteps"`
+	Tables     int    `json:"tables"`
+}
+
+// ProgressFunc receives progress updates during a scan. It may be nil
+type ProgressFunc func(Progress)
+
+// Scan stages, in the order they are reported
+const (
+	StageTables      = "tables"
+	StageColumns     = "columns"
+	StageIndexes     = "indexes"
+	StageForeignKeys = "foreignKeys"
+	StageViews       = "views"
+	StageRoutines    = "routines"
+	StageTriggers    = "triggers"
+	StageDone        = "done"
+)
+
+const mysqlScanSteps = 7
+
+// ScanMySQL reads the structure of the given MySQL database. Each kind of
+// object is fetched for the whole schema with a single information_schema
+// query and assembled in memory, so the number of round trips does not grow
+// with the number of tables
+func ScanMySQL(ctx context.Context, db *sql.DB, database string, progress ProgressFunc) (Structure, error) {
+	structure := Structure{
+		DBType:   "mysql",
+		Tables:   []Table{},
+		Routines: []Routine{},
+		Triggers: []Trigger{},
+	}
+
+	report := func(stage string, step int) {
+		if progress != nil {
+			progress(Progress{Stage: stage, Step: step, TotalSteps: mysqlScanSteps, Tables: len(structure.Tables)})
+		}
+	}
+
+	report(StageTables, 0)
+
+	err := scanTables(ctx, db, database, &structure)
+	if err != nil {
+		return structure, err
+	}
+
+	// Index the tables by name to attach the schema-wide result sets to them
+	positions := make(map[string]int, len(structure.Tables))
+	for i, table := range structure.Tables {
+		positions[table.Name] = i
+	}
+
+	lookup := func(name string) *Table {
+		if i, ok := positions[name]; ok {
+			return &structure.Tables[i]
+		}
+		return nil
+	}
+
+	report(StageColumns, 1)
+
+	err = scanColumns(ctx, db, database, lookup)
+	if err != nil {
+		return structure, err
+	}
+
+	report(StageIndexes, 2)
+
+	err = scanIndexes(ctx, db, database, lookup)
+	if err != nil {
+		return structure, err
+	}
+
+	report(StageForeignKeys, 3)
+
+	err = scanForeignKeys(ctx, db, database, lookup)
+	if err != nil {
+		return structure, err
+	}
+
+	report(StageViews, 4)
+
+	err = scanViews(ctx, db, database, lookup)
+	if err != nil {
+		return structure, err
+	}
+
+	report(StageRoutines, 5)
+
+	structure.Routines, err = scanRoutines(ctx, db, database)
+	if err != nil {
+		return structure, err
+	}
+
+	report(StageTriggers, 6)
+
+	structure.Triggers, err = scanTriggers(ctx, db, database)
+	if err != nil {
+		return structure, err
+	}
+
+	for i := range structure.Tables {
+		structure.Tables[i].applyIndexFlags()
+	}
+
+	report(StageDone, mysqlScanSteps)
+
+	return structure, nil
+}
+
+// scanTables reads every table with its comment and row estimate. TABLE_ROWS
+// is an estimate for InnoDB, which is all the assistant needs
+func scanTables(ctx context.Context, db *sql.DB, database string, structure *Structure) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT TABLE_NAME, TABLE_TYPE, TABLE_COMMENT, TABLE_ROWS
+		FROM INFORMATION_SCHEMA.TABLES
+		WHERE TABLE_SCHEMA = ?
+		ORDER BY TABLE_NAME
+	`, database)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, tableType string
+		var comment sql.NullString
+		var estimate sql.NullInt64
+
+		if err := rows.Scan(&name, &tableType, &comment, &estimate); err != nil {
+			return err
+		}
+
+		table := Table{
+			Name:          name,
+			Type:          TableTypeBase,
+			Description:   comment.String,
+			EstimatedRows: int(estimate.Int64),
+			Columns:       []Column{},
+			ForeignKeys:   []ForeignKey{},
+			Indexes:       []Index{},
+		}
+
+		if tableType == "VIEW" {
+			// MySQL fills the comment of views with "VIEW" and has no row count
+			table.Type = TableTypeView
+			table.Description = ""
+			table.EstimatedRows = 0
+		}
+
+		structure.Tables = append(structure.Tables, table)
+	}
+
+	return rows.Err()
+}
+
+func scanColumns(ctx context.Context, db *sql.DB, database string, lookup func(string) *Table) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			TABLE_NAME,
+			COLUMN_NAME,
+			COLUMN_TYPE,
+			IS_NULLABLE,
+			COLUMN_KEY,
+			COLUMN_DEFAULT,
+			EXTRA,
+			COLUMN_COMMENT
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = ?
+		ORDER BY TABLE_NAME, ORDINAL_POSITION
+	`, database)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName string
+		var field, colType, null, key, defaultVal, extra, comment sql.NullString
+
+		if err := rows.Scan(&tableName, &field, &colType, &null, &key, &defaultVal, &extra, &comment); err != nil {
+			return err
+		}
+
+		table := lookup(tableName)
+		if table == nil {
+			continue
+		}
+
+		table.Columns = append(table.Columns, Column{
+			Name:        field.String,
+			Type:        colType.String,
+			Nullable:    null.String,
+			Key:         key.String,
+			Default:     defaultVal.String,
+			HasDefault:  defaultVal.Valid,
+			Extra:       extra.String,
+			IsPrimary:   key.String == "PRI",
+			Description: comment.String,
+		})
+	}
+
+	return rows.Err()
+}
+
+func scanIndexes(ctx context.Context, db *sql.DB, database string, lookup func(string) *Table) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME, INDEX_TYPE
+		FROM INFORMATION_SCHEMA.STATISTICS
+		WHERE TABLE_SCHEMA = ?
+		ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX
+	`, database)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName, name, indexType string
+		var nonUnique int
+		var column sql.NullString
+
+		if err := rows.Scan(&tableName, &name, &nonUnique, &column, &indexType); err != nil {
+			return err
+		}
+
+		table := lookup(tableName)
+		if table == nil {
+			continue
+		}
+
+		// Rows arrive grouped by index, so a new index starts whenever the
+		// name differs from the last one seen for the table
+		last := len(table.Indexes) - 1
+		if last < 0 || table.Indexes[last].Name != name {
+			table.Indexes = append(table.Indexes, Index{
+				Name:    name,
+				Columns: []string{},
+				Unique:  nonUnique == 0,
+				Primary: name == "PRIMARY",
+				Type:    indexType,
+			})
+			last++
+		}
+
+		// Functional indexes have no column name
+		if column.Valid {
+			table.Indexes[last].Columns = append(table.Indexes[last].Columns, column.String)
+		}
+	}
+
+	return rows.Err()
+}
+
+func scanForeignKeys(ctx context.Context, db *sql.DB, database string, lookup func(string) *Table) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			kcu.TABLE_NAME,
+			kcu.COLUMN_NAME,
+			kcu.REFERENCED_TABLE_NAME,
+			kcu.REFERENCED_COLUMN_NAME,
+			kcu.CONSTRAINT_NAME,
+			rc.DELETE_RULE,
+			rc.UPDATE_RULE
+		FROM
+			INFORMATION_SCHEMA.KEY_COLUMN_USAGE kcu
+			LEFT JOIN INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS rc
+				ON rc.CONSTRAINT_SCHEMA = kcu.CONSTRAINT_SCHEMA
+				AND rc.TABLE_NAME = kcu.TABLE_NAME
+				AND rc.CONSTRAINT_NAME = kcu.CONSTRAINT_NAME
+		WHERE
+			kcu.TABLE_SCHEMA = ?
+			AND kcu.REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY kcu.TABLE_NAME, kcu.CONSTRAINT_NAME, kcu.ORDINAL_POSITION
+	`, database)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName string
+		var fk ForeignKey
+		var onDelete, onUpdate sql.NullString
+
+		if err := rows.Scan(&tableName, &fk.ColumnName, &fk.ReferencedTable, &fk.ReferencedColumn, &fk.ConstraintName, &onDelete, &onUpdate); err != nil {
+			return err
+		}
+
+		table := lookup(tableName)
+		if table == nil {
+			continue
+		}
+
+		fk.OnDelete = onDelete.String
+		fk.OnUpdate = onUpdate.String
+		fk.CascadeDelete = fk.OnDelete == "CASCADE"
+		fk.CascadeUpdate = fk.OnUpdate == "CASCADE"
+
+		table.ForeignKeys = append(table.ForeignKeys, fk)
+	}
+
+	return rows.Err()
+}
+
+func scanViews(ctx context.Context, db *sql.DB, database string, lookup func(string) *Table) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT TABLE_NAME, VIEW_DEFINITION
+		FROM INFORMATION_SCHEMA.VIEWS
+		WHERE TABLE_SCHEMA = ?
+	`, database)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var definition sql.NullString
+
+		if err := rows.Scan(&name, &definition); err != nil {
+			return err
+		}
+
+		if table := lookup(name); table != nil {
+			table.ViewDefinition = definition.String
+		}
+	}
+
+	return rows.Err()
+}
+
+func scanRoutines(ctx context.Context, db *sql.DB, database string) ([]Routine, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT ROUTINE_NAME, ROUTINE_TYPE, DTD_IDENTIFIER, ROUTINE_DEFINITION, ROUTINE_COMMENT
+		FROM INFORMATION_SCHEMA.ROUTINES
+		WHERE ROUTINE_SCHEMA = ?
+		ORDER BY ROUTINE_NAME
+	`, database)
+	if err != nil {
+		return nil, err
+	}
+
+	routines := []Routine{}
+	positions := make(map[string]int)
+
+	for rows.Next() {
+		var routine Routine
+		var returns, definition, comment sql.NullString
+
+		if err := rows.Scan(&routine.Name, &routine.Type, &returns, &definition, &comment); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		routine.Returns = returns.String
+		routine.Definition = definition.String
+		routine.Description = comment.String
+		routine.Parameters = []RoutineParameter{}
+
+		positions[routine.Type+"."+routine.Name] = len(routines)
+		routines = append(routines, routine)
+	}
+
+	err = rows.Err()
+	rows.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Position 0 holds a function's return type, which ROUTINES already has
+	rows, err = db.QueryContext(ctx, `
+		SELECT SPECIFIC_NAME, ROUTINE_TYPE, PARAMETER_MODE, PARAMETER_NAME, DTD_IDENTIFIER
+		FROM INFORMATION_SCHEMA.PARAMETERS
+		WHERE SPECIFIC_SCHEMA = ? AND ORDINAL_POSITION > 0
+		ORDER BY SPECIFIC_NAME, ORDINAL_POSITION
+	`, database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var routineName, routineType string
+		var mode, name, dataType sql.NullString
+
+		if err := rows.Scan(&routineName, &routineType, &mode, &name, &dataType); err != nil {
+			return nil, err
+		}
+
+		if i, ok := positions[routineType+"."+routineName]; ok {
+			routines[i].Parameters = append(routines[i].Parameters, RoutineParameter{
+				Name: name.String,
+				Mode: mode.String,
+				Type: dataType.String,
+			})
+		}
+	}
+
+	return routines, rows.Err()
+}
+
+func scanTriggers(ctx context.Context, db *sql.DB, database string) ([]Trigger, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_STATEMENT
+		FROM INFORMATION_SCHEMA.TRIGGERS
+		WHERE TRIGGER_SCHEMA = ?
+		ORDER BY EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER
+	`, database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	triggers := []Trigger{}
+
+	for rows.Next() {
+		var trigger Trigger
+
+		if err := rows.Scan(&trigger.Name, &trigger.Table, &trigger.Timing, &trigger.Event, &trigger.Statement); err != nil {
+			return nil, err
+		}
+
+		triggers = append(triggers, trigger)
+	}
+
+	return triggers, rows.Err()
+}
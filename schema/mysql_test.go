@@ -0,0 +1,297 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeResult is what the fake information_schema returns for one query
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+// fakeSchema answers each scan query with the result registered for the
+// information_schema table it reads from
+type fakeSchema map[string]fakeResult
+
+func (s fakeSchema) Connect(ctx context.Context) (driver.Conn, error) {
+	return fakeSchemaConn{s}, nil
+}
+
+func (s fakeSchema) Driver() driver.Driver {
+	return nil
+}
+
+type fakeSchemaConn struct {
+	schema fakeSchema
+}
+
+func (c fakeSchemaConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake schema only runs queries directly")
+}
+
+func (c fakeSchemaConn) Close() error {
+	return nil
+}
+
+func (c fakeSchemaConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake schema has no transactions")
+}
+
+func (c fakeSchemaConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	for source, result := range c.schema {
+		if strings.Contains(query, "INFORMATION_SCHEMA."+source+"\n") || strings.Contains(query, "INFORMATION_SCHEMA."+source+" ") {
+			if result.err != nil {
+				return nil, result.err
+			}
+
+			return &fakeRows{columns: result.columns, rows: result.rows}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected query %s", query)
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
+
+func fakeSchemaFixture() fakeSchema {
+	return fakeSchema{
+		"TABLES": {
+			columns: []string{"TABLE_NAME", "TABLE_TYPE", "TABLE_COMMENT", "TABLE_ROWS"},
+			rows: [][]driver.Value{
+				{"active_customers", "VIEW", "VIEW", nil},
+				{"customers", "BASE TABLE", "People who buy", int64(120)},
+				{"orders", "BASE TABLE", "", int64(3400)},
+			},
+		},
+		"COLUMNS": {
+			columns: []string{"TABLE_NAME", "COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_KEY", "COLUMN_DEFAULT", "EXTRA", "COLUMN_COMMENT"},
+			rows: [][]driver.Value{
+				{"active_customers", "id", "int(11)", "NO", "", "0", "", ""},
+				{"customers", "id", "int(11)", "NO", "PRI", nil, "auto_increment", ""},
+				{"customers", "email", "varchar(255)", "NO", "UNI", nil, "", "Login e-mail"},
+				{"dropped_meanwhile", "id", "int(11)", "NO", "PRI", nil, "", ""},
+				{"orders", "id", "int(11)", "NO", "PRI", nil, "auto_increment", ""},
+				{"orders", "customer_id", "int(11)", "NO", "MUL", nil, "", ""},
+				{"orders", "status", "varchar(20)", "NO", "", "new", "", ""},
+			},
+		},
+		"STATISTICS": {
+			columns: []string{"TABLE_NAME", "INDEX_NAME", "NON_UNIQUE", "COLUMN_NAME", "INDEX_TYPE"},
+			rows: [][]driver.Value{
+				{"customers", "PRIMARY", int64(0), "id", "BTREE"},
+				{"customers", "email", int64(0), "email", "BTREE"},
+				{"orders", "orders_customer_status", int64(1), "customer_id", "BTREE"},
+				{"orders", "orders_customer_status", int64(1), "status", "BTREE"},
+				{"orders", "orders_lower_status", int64(1), nil, "BTREE"},
+				{"orders", "PRIMARY", int64(0), "id", "BTREE"},
+			},
+		},
+		"KEY_COLUMN_USAGE": {
+			columns: []string{"TABLE_NAME", "COLUMN_NAME", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME", "CONSTRAINT_NAME", "DELETE_RULE", "UPDATE_RULE"},
+			rows: [][]driver.Value{
+				{"orders", "customer_id", "customers", "id", "orders_customer_fk", "CASCADE", "RESTRICT"},
+			},
+		},
+		"VIEWS": {
+			columns: []string{"TABLE_NAME", "VIEW_DEFINITION"},
+			rows: [][]driver.Value{
+				{"active_customers", "select `id` from `customers`"},
+				{"dropped_view", "select 1"},
+			},
+		},
+		"ROUTINES": {
+			columns: []string{"ROUTINE_NAME", "ROUTINE_TYPE", "DTD_IDENTIFIER", "ROUTINE_DEFINITION", "ROUTINE_COMMENT"},
+			rows: [][]driver.Value{
+				{"order_total", "FUNCTION", "decimal(10,2)", "RETURN 0", "Sums an order"},
+				{"order_total", "PROCEDURE", nil, "BEGIN END", ""},
+				{"touch", "PROCEDURE", nil, "BEGIN END", ""},
+			},
+		},
+		"PARAMETERS": {
+			columns: []string{"SPECIFIC_NAME", "ROUTINE_TYPE", "PARAMETER_MODE", "PARAMETER_NAME", "DTD_IDENTIFIER"},
+			rows: [][]driver.Value{
+				{"order_total", "FUNCTION", nil, "order_id", "int"},
+				{"order_total", "PROCEDURE", "IN", "order_id", "int"},
+				{"order_total", "PROCEDURE", "OUT", "total", "decimal(10,2)"},
+				{"removed", "PROCEDURE", "IN", "id", "int"},
+			},
+		},
+		"TRIGGERS": {
+			columns: []string{"TRIGGER_NAME", "EVENT_OBJECT_TABLE", "ACTION_TIMING", "EVENT_MANIPULATION", "ACTION_STATEMENT"},
+			rows: [][]driver.Value{
+				{"orders_before_insert", "orders", "BEFORE", "INSERT", "SET NEW.status = 'new'"},
+			},
+		},
+	}
+}
+
+func TestScanMySQL(t *testing.T) {
+	db := sql.OpenDB(fakeSchemaFixture())
+	defer db.Close()
+
+	var events []Progress
+
+	structure, err := ScanMySQL(context.Background(), db, "shop", func(p Progress) {
+		events = append(events, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Structure{
+		DBType: "mysql",
+		Tables: []Table{
+			{
+				Name:           "active_customers",
+				Type:           TableTypeView,
+				Columns:        []Column{{Name: "id", Type: "int(11)", Nullable: "NO", Default: "0", HasDefault: true}},
+				ForeignKeys:    []ForeignKey{},
+				Indexes:        []Index{},
+				ViewDefinition: "select `id` from `customers`",
+			},
+			{
+				Name:          "customers",
+				Type:          TableTypeBase,
+				Description:   "People who buy",
+				EstimatedRows: 120,
+				Columns: []Column{
+					{Name: "id", Type: "int(11)", Nullable: "NO", Key: "PRI", Extra: "auto_increment", IsPrimary: true, IsUnique: true, HasIndex: true},
+					{Name: "email", Type: "varchar(255)", Nullable: "NO", Key: "UNI", IsUnique: true, HasIndex: true, Description: "Login e-mail"},
+				},
+				ForeignKeys: []ForeignKey{},
+				Indexes: []Index{
+					{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true, Type: "BTREE"},
+					{Name: "email", Columns: []string{"email"}, Unique: true, Type: "BTREE"},
+				},
+			},
+			{
+				Name:          "orders",
+				Type:          TableTypeBase,
+				EstimatedRows: 3400,
+				Columns: []Column{
+					{Name: "id", Type: "int(11)", Nullable: "NO", Key: "PRI", Extra: "auto_increment", IsPrimary: true, IsUnique: true, HasIndex: true},
+					{Name: "customer_id", Type: "int(11)", Nullable: "NO", Key: "MUL", HasIndex: true},
+					{Name: "status", Type: "varchar(20)", Nullable: "NO", Default: "new", HasDefault: true},
+				},
+				ForeignKeys: []ForeignKey{
+					{ColumnName: "customer_id", ReferencedTable: "customers", ReferencedColumn: "id", ConstraintName: "orders_customer_fk", OnDelete: "CASCADE", OnUpdate: "RESTRICT", CascadeDelete: true},
+				},
+				Indexes: []Index{
+					{Name: "orders_customer_status", Columns: []string{"customer_id", "status"}, Type: "BTREE"},
+					{Name: "orders_lower_status", Columns: []string{}, Type: "BTREE"},
+					{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true, Type: "BTREE"},
+				},
+			},
+		},
+		Routines: []Routine{
+			{Name: "order_total", Type: "FUNCTION", Returns: "decimal(10,2)", Definition: "RETURN 0", Description: "Sums an order", Parameters: []RoutineParameter{
+				{Name: "order_id", Type: "int"},
+			}},
+			{Name: "order_total", Type: "PROCEDURE", Definition: "BEGIN END", Parameters: []RoutineParameter{
+				{Name: "order_id", Mode: "IN", Type: "int"},
+				{Name: "total", Mode: "OUT", Type: "decimal(10,2)"},
+			}},
+			{Name: "touch", Type: "PROCEDURE", Definition: "BEGIN END", Parameters: []RoutineParameter{}},
+		},
+		Triggers: []Trigger{
+			{Name: "orders_before_insert", Table: "orders", Timing: "BEFORE", Event: "INSERT", Statement: "SET NEW.status = 'new'"},
+		},
+	}
+
+	if !reflect.DeepEqual(structure, expected) {
+		t.Errorf("unexpected structure:\n%+v\nexpected:\n%+v", structure, expected)
+	}
+
+	stages := []string{StageTables, StageColumns, StageIndexes, StageForeignKeys, StageViews, StageRoutines, StageTriggers, StageDone}
+
+	if len(events) != len(stages) {
+		t.Fatalf("expected %d progress events, got %+v", len(stages), events)
+	}
+
+	for i, event := range events {
+		tables := 3
+		if i == 0 {
+			tables = 0
+		}
+
+		step := i
+		if event.Stage == StageDone {
+			step = mysqlScanSteps
+		}
+
+		if event != (Progress{Stage: stages[i], Step: step, TotalSteps: mysqlScanSteps, Tables: tables}) {
+			t.Errorf("unexpected progress event %d: %+v", i, event)
+		}
+	}
+}
+
+func TestScanMySQLStopsAtFailingStage(t *testing.T) {
+	cases := []struct {
+		source string
+		stage  string
+	}{
+		{"TABLES", StageTables},
+		{"COLUMNS", StageColumns},
+		{"STATISTICS", StageIndexes},
+		{"KEY_COLUMN_USAGE", StageForeignKeys},
+		{"VIEWS", StageViews},
+		{"ROUTINES", StageRoutines},
+		{"PARAMETERS", StageRoutines},
+		{"TRIGGERS", StageTriggers},
+	}
+
+	for _, c := range cases {
+		fixture := fakeSchemaFixture()
+		fixture[c.source] = fakeResult{err: fmt.Errorf("no access to %s", c.source)}
+
+		db := sql.OpenDB(fixture)
+
+		var last Progress
+
+		_, err := ScanMySQL(context.Background(), db, "shop", func(p Progress) {
+			last = p
+		})
+
+		db.Close()
+
+		if err == nil || !strings.Contains(err.Error(), c.source) {
+			t.Errorf("%s: expected the query error, got %v", c.source, err)
+		}
+
+		if last.Stage != c.stage {
+			t.Errorf("%s: expected the scan to stop at %s, got %s", c.source, c.stage, last.Stage)
+		}
+	}
+}
@@ -0,0 +1,1347 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ParseDDL reads a MySQL DDL script, such as the output of
+// `mysqldump --no-data`, into the same structure ScanMySQL produces. CREATE
+// TABLE, VIEW, INDEX, TRIGGER, PROCEDURE and FUNCTION statements are read,
+// ALTER TABLE ... ADD and DROP TABLE/VIEW are applied, and anything else is
+// skipped. Row estimates are unknown and left at zero
+func ParseDDL(script string) (Structure, error) {
+	state := newDDLImport()
+
+	for _, statement := range splitStatements(script) {
+		err := state.apply(statement)
+
+		if err != nil {
+			return Structure{}, fmt.Errorf("%s: %w", abbreviate(statement), err)
+		}
+	}
+
+	structure := state.structure()
+
+	if len(structure.Tables) == 0 {
+		return Structure{}, fmt.Errorf("no CREATE TABLE or CREATE VIEW statements found")
+	}
+
+	return structure, nil
+}
+
+func abbreviate(statement string) string {
+	statement = strings.Join(strings.Fields(statement), " ")
+
+	if len(statement) > 60 {
+		return statement[:60] + "..."
+	}
+
+	return statement
+}
+
+// splitStatements breaks a script into statements, dropping comments and
+// unwrapping the /*!40101 ... */ version comments mysqldump wraps DDL in.
+// DELIMITER lines, used around trigger and routine bodies, are honoured
+func splitStatements(script string) []string {
+	statements := []string{}
+	delimiter := ";"
+	conditional := 0
+	blank := true
+
+	var sb strings.Builder
+
+	flush := func() {
+		if !blank {
+			statements = append(statements, strings.TrimSpace(sb.String()))
+		}
+		sb.Reset()
+		blank = true
+	}
+
+	for i := 0; i < len(script); {
+		if (i == 0 || script[i-1] == '\n') && blank {
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+
+			fields := strings.Fields(script[i : i+end])
+			if len(fields) == 2 && strings.EqualFold(fields[0], "DELIMITER") {
+				delimiter = fields[1]
+				i += end
+				continue
+			}
+		}
+
+		c := script[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(script, i)
+			sb.WriteString(script[i:end])
+			blank = false
+			i = end
+		case strings.HasPrefix(script[i:], "/*!"):
+			i += 3
+			for i < len(script) && script[i] >= '0' && script[i] <= '9' {
+				i++
+			}
+			conditional++
+		case strings.HasPrefix(script[i:], "*/") && conditional > 0:
+			i += 2
+			conditional--
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 4
+			}
+			sb.WriteByte(' ')
+		case c == '#' || (strings.HasPrefix(script[i:], "--") && (i+2 == len(script) || script[i+2] == ' ' || script[i+2] == '\t' || script[i+2] == '\n' || script[i+2] == '\r')):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+			}
+		case strings.HasPrefix(script[i:], delimiter):
+			flush()
+			i += len(delimiter)
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				blank = false
+			}
+			sb.WriteByte(c)
+			i++
+		}
+	}
+
+	flush()
+
+	return statements
+}
+
+// quotedEnd returns the offset just past the quoted run starting at start
+func quotedEnd(text string, start int) int {
+	quote := text[start]
+
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && quote != '`':
+			i++
+		case text[i] == quote:
+			if i+1 < len(text) && text[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+
+	return len(text)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenIdentifier
+	tokenString
+	tokenSymbol
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	quote byte
+	start int
+	end   int
+}
+
+// is reports whether the token is the given keyword or symbol
+func (t token) is(word string) bool {
+	return (t.kind == tokenWord || t.kind == tokenSymbol) && strings.EqualFold(t.text, word)
+}
+
+func tokenize(sql string) []token {
+	tokens := []token{}
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '`' || c == '\'' || c == '"':
+			end := quotedEnd(sql, i)
+			kind := tokenString
+			if c == '`' {
+				kind = tokenIdentifier
+			}
+
+			tokens = append(tokens, token{kind: kind, text: unquote(sql[i:end]), quote: c, start: i, end: end})
+			i = end
+		case isWordByte(c):
+			end := i
+			for end < len(sql) && (isWordByte(sql[end]) || (sql[end] == '.' && end > i && isDigit(sql[i]))) {
+				end++
+			}
+
+			tokens = append(tokens, token{kind: tokenWord, text: sql[i:end], start: i, end: end})
+			i = end
+		default:
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(c), start: i, end: i + 1})
+			i++
+		}
+	}
+
+	return tokens
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// unquote strips the quotes from a quoted identifier or string literal and
+// resolves doubled quotes and backslash escapes
+func unquote(quoted string) string {
+	quote := quoted[0]
+	body := quoted[1:]
+	if len(body) > 0 && body[len(body)-1] == quote {
+		body = body[:len(body)-1]
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+
+		switch {
+		case c == quote && i+1 < len(body) && body[i+1] == quote:
+			sb.WriteByte(c)
+			i++
+		case c == '\\' && quote != '`' && i+1 < len(body):
+			i++
+			switch body[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case '0':
+				sb.WriteByte(0)
+			default:
+				sb.WriteByte(body[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
+
+// ddlParser walks the tokens of one statement, or of one item of a list
+type ddlParser struct {
+	sql    string
+	tokens []token
+	pos    int
+}
+
+func newDDLParser(sql string) *ddlParser {
+	return &ddlParser{sql: sql, tokens: tokenize(sql)}
+}
+
+func (p *ddlParser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{kind: tokenEOF, start: len(p.sql), end: len(p.sql)}
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *ddlParser) next() token {
+	t := p.peek()
+
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *ddlParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// accept consumes the keywords if they appear in order, and nothing otherwise
+func (p *ddlParser) accept(words ...string) bool {
+	for i, word := range words {
+		if p.pos+i >= len(p.tokens) || !p.tokens[p.pos+i].is(word) {
+			return false
+		}
+	}
+
+	p.pos += len(words)
+
+	return true
+}
+
+func (p *ddlParser) expect(words ...string) error {
+	if !p.accept(words...) {
+		return fmt.Errorf("expected %s near %q", strings.Join(words, " "), p.peek().text)
+	}
+
+	return nil
+}
+
+// name reads an identifier, possibly qualified as schema.name, and returns
+// the unqualified part
+func (p *ddlParser) name() (string, error) {
+	t := p.next()
+
+	if t.kind != tokenWord && t.kind != tokenIdentifier && !(t.kind == tokenString && t.quote == '"') {
+		return "", fmt.Errorf("expected a name near %q", t.text)
+	}
+
+	if p.peek().is(".") {
+		p.next()
+		return p.name()
+	}
+
+	return t.text, nil
+}
+
+// list consumes a parenthesised, comma separated list and returns a parser
+// for each item
+func (p *ddlParser) list() ([]*ddlParser, error) {
+	if !p.peek().is("(") {
+		return nil, fmt.Errorf("expected ( near %q", p.peek().text)
+	}
+
+	p.next()
+
+	items := []*ddlParser{}
+	depth, begin := 0, p.pos
+
+	for ; p.pos < len(p.tokens); p.pos++ {
+		t := p.tokens[p.pos]
+
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")") && depth > 0:
+			depth--
+		case (t.is(",") || t.is(")")) && depth == 0:
+			if p.pos > begin {
+				items = append(items, &ddlParser{sql: p.sql, tokens: p.tokens[begin:p.pos]})
+			}
+
+			begin = p.pos + 1
+
+			if t.is(")") {
+				p.pos++
+				return items, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("unbalanced parentheses")
+}
+
+// parenthesised consumes a parenthesised group and returns the text inside it
+func (p *ddlParser) parenthesised() (string, error) {
+	if !p.peek().is("(") {
+		return "", fmt.Errorf("expected ( near %q", p.peek().text)
+	}
+
+	open := p.next()
+	depth := 1
+
+	for !p.done() {
+		t := p.next()
+
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(p.sql[open.end:t.start]), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("unbalanced parentheses")
+}
+
+// rest returns the statement text from the current token on
+func (p *ddlParser) rest() string {
+	if p.done() {
+		return ""
+	}
+
+	return strings.TrimSpace(p.sql[p.peek().start:p.tokens[len(p.tokens)-1].end])
+}
+
+// names reads a parenthesised column list, ignoring prefix lengths and sort order
+func (p *ddlParser) names() ([]string, error) {
+	items, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+
+	for _, item := range items {
+		if item.peek().is("(") {
+			// Functional key part
+			expression, err := item.parenthesised()
+			if err != nil {
+				return nil, err
+			}
+
+			names = append(names, "("+expression+")")
+			continue
+		}
+
+		name, err := item.name()
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// ddlImport accumulates the objects created by a script
+type ddlImport struct {
+	order    []string
+	tables   map[string]*importedTable
+	standIns map[string][]Column
+	routines []Routine
+	triggers []Trigger
+}
+
+type importedTable struct {
+	table       Table
+	constraints []ForeignKeyConstraint
+	unnamedKeys int
+}
+
+func newDDLImport() *ddlImport {
+	return &ddlImport{
+		tables:   make(map[string]*importedTable),
+		standIns: make(map[string][]Column),
+	}
+}
+
+func (d *ddlImport) put(table Table) *importedTable {
+	if _, ok := d.tables[table.Name]; !ok {
+		d.order = append(d.order, table.Name)
+	}
+
+	imported := &importedTable{table: table}
+	d.tables[table.Name] = imported
+
+	return imported
+}
+
+func (d *ddlImport) drop(name string) {
+	imported, ok := d.tables[name]
+	if !ok {
+		return
+	}
+
+	// mysqldump creates a stand-in for each view before the real definition,
+	// whose columns are the only place the view's columns appear
+	d.standIns[name] = imported.table.Columns
+	delete(d.tables, name)
+
+	for i, ordered := range d.order {
+		if ordered == name {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (d *ddlImport) apply(statement string) error {
+	p := newDDLParser(statement)
+
+	switch {
+	case p.accept("ALTER", "TABLE"):
+		return d.alterTable(p)
+	case p.accept("DROP"):
+		return d.dropObjects(p)
+	case !p.accept("CREATE"):
+		return nil
+	}
+
+	p.accept("OR", "REPLACE")
+	p.accept("TEMPORARY")
+
+	for p.skipCreateOption() {
+	}
+
+	switch {
+	case p.accept("TABLE"):
+		return d.createTable(p)
+	case p.accept("VIEW"):
+		return d.createView(p)
+	case p.accept("TRIGGER"):
+		return d.createTrigger(p)
+	case p.accept("PROCEDURE"):
+		return d.createRoutine(p, "PROCEDURE")
+	case p.accept("FUNCTION"):
+		return d.createRoutine(p, "FUNCTION")
+	case p.peek().is("INDEX") || p.peek().is("UNIQUE") || p.peek().is("FULLTEXT") || p.peek().is("SPATIAL"):
+		return d.createIndex(p)
+	}
+
+	return nil
+}
+
+// skipCreateOption consumes one ALGORITHM, DEFINER or SQL SECURITY clause
+// of a CREATE VIEW, TRIGGER or routine statement
+func (p *ddlParser) skipCreateOption() bool {
+	switch {
+	case p.accept("ALGORITHM"):
+		p.accept("=")
+		p.next()
+	case p.accept("DEFINER"):
+		p.accept("=")
+		p.next()
+		if p.accept("@") {
+			p.next()
+		} else if p.peek().is("(") {
+			p.parenthesised()
+		}
+	case p.accept("SQL", "SECURITY"):
+		p.next()
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (d *ddlImport) createTable(p *ddlParser) error {
+	p.accept("IF", "NOT", "EXISTS")
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	if p.accept("LIKE") {
+		source, err := p.name()
+		if err != nil {
+			return err
+		}
+
+		original, ok := d.tables[source]
+		if !ok {
+			return fmt.Errorf("table %s copies unknown table %s", name, source)
+		}
+
+		copied := original.table
+		copied.Name = name
+		d.put(copied).unnamedKeys = original.unnamedKeys
+
+		return nil
+	}
+
+	items, err := p.list()
+	if err != nil {
+		return err
+	}
+
+	imported := d.put(Table{Name: name, Type: TableTypeBase})
+
+	for _, item := range items {
+		if err := imported.addDefinition(item); err != nil {
+			return err
+		}
+	}
+
+	// Table options
+	for !p.done() {
+		if p.accept("COMMENT") {
+			p.accept("=")
+			imported.table.Description = p.next().text
+			continue
+		}
+
+		p.next()
+	}
+
+	return nil
+}
+
+// addDefinition adds a column, key or constraint from a CREATE TABLE body or
+// an ALTER TABLE ... ADD clause
+func (t *importedTable) addDefinition(p *ddlParser) error {
+	constraintName := ""
+
+	if p.accept("CONSTRAINT") {
+		if !p.peek().is("PRIMARY") && !p.peek().is("UNIQUE") && !p.peek().is("FOREIGN") && !p.peek().is("CHECK") {
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			constraintName = name
+		}
+	}
+
+	switch {
+	case p.accept("PRIMARY", "KEY"):
+		return t.addIndex(p, Index{Name: "PRIMARY", Unique: true, Primary: true}, false)
+	case p.accept("UNIQUE"):
+		if !p.accept("KEY") {
+			p.accept("INDEX")
+		}
+		return t.addIndex(p, Index{Name: constraintName, Unique: true}, true)
+	case p.accept("FULLTEXT") || p.accept("SPATIAL"):
+		indexType := strings.ToUpper(p.tokens[p.pos-1].text)
+		if !p.accept("KEY") {
+			p.accept("INDEX")
+		}
+		return t.addIndex(p, Index{Type: indexType}, true)
+	case p.accept("KEY") || p.accept("INDEX"):
+		return t.addIndex(p, Index{}, true)
+	case p.accept("FOREIGN", "KEY"):
+		if !p.peek().is("(") {
+			// MySQL uses the index name only when no constraint name is given
+			name, err := p.name()
+			if err != nil {
+				return err
+			}
+			if constraintName == "" {
+				constraintName = name
+			}
+		}
+
+		columns, err := p.names()
+		if err != nil {
+			return err
+		}
+
+		return t.addReference(p, constraintName, columns)
+	case p.accept("CHECK"):
+		return nil
+	}
+
+	return t.addColumn(p)
+}
+
+// addIndex reads the optional name and the key parts of an index
+func (t *importedTable) addIndex(p *ddlParser, index Index, named bool) error {
+	if named && !p.peek().is("(") && !p.peek().is("USING") {
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		index.Name = name
+	}
+
+	if p.accept("USING") {
+		index.Type = strings.ToUpper(p.next().text)
+	}
+
+	columns, err := p.names()
+	if err != nil {
+		return err
+	}
+
+	index.Columns = columns
+
+	if p.accept("USING") {
+		index.Type = strings.ToUpper(p.next().text)
+	}
+
+	if index.Type == "" {
+		index.Type = "BTREE"
+	}
+
+	if index.Name == "" {
+		index.Name = t.uniqueIndexName(columns[0])
+	}
+
+	t.table.Indexes = append(t.table.Indexes, index)
+
+	return nil
+}
+
+// uniqueIndexName names an unnamed index after its first column, the way MySQL does
+func (t *importedTable) uniqueIndexName(base string) string {
+	taken := func(name string) bool {
+		for _, index := range t.table.Indexes {
+			if strings.EqualFold(index.Name, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	name := base
+	for i := 2; taken(name); i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	return name
+}
+
+// addReference reads REFERENCES table (columns) and the referential actions
+func (t *importedTable) addReference(p *ddlParser, name string, columns []string) error {
+	if err := p.expect("REFERENCES"); err != nil {
+		return err
+	}
+
+	referenced, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	referencedColumns, err := p.names()
+	if err != nil {
+		return err
+	}
+
+	if len(referencedColumns) != len(columns) {
+		return fmt.Errorf("foreign key on %s has %d columns but references %d", t.table.Name, len(columns), len(referencedColumns))
+	}
+
+	if name == "" {
+		t.unnamedKeys++
+		name = fmt.Sprintf("%s_ibfk_%d", t.table.Name, t.unnamedKeys)
+	}
+
+	fk := ForeignKeyConstraint{
+		Name:              name,
+		Columns:           columns,
+		ReferencedTable:   referenced,
+		ReferencedColumns: referencedColumns,
+		OnDelete:          "RESTRICT",
+		OnUpdate:          "RESTRICT",
+	}
+
+	for !p.done() {
+		switch {
+		case p.accept("ON", "DELETE"):
+			fk.OnDelete = referentialAction(p)
+		case p.accept("ON", "UPDATE"):
+			fk.OnUpdate = referentialAction(p)
+		default:
+			p.next()
+		}
+	}
+
+	t.constraints = append(t.constraints, fk)
+
+	return nil
+}
+
+func referentialAction(p *ddlParser) string {
+	switch {
+	case p.accept("SET", "NULL"):
+		return "SET NULL"
+	case p.accept("SET", "DEFAULT"):
+		return "SET DEFAULT"
+	case p.accept("NO", "ACTION"):
+		return "NO ACTION"
+	}
+
+	return strings.ToUpper(p.next().text)
+}
+
+var expressionDefault = regexp.MustCompile(`(?i)^(CURRENT_TIMESTAMP|NOW|LOCALTIME|LOCALTIMESTAMP|CURRENT_DATE|CURDATE|CURRENT_TIME|CURTIME|UTC_TIMESTAMP)$`)
+
+// addColumn reads a column definition with its inline attributes
+func (t *importedTable) addColumn(p *ddlParser) error {
+	p.accept("COLUMN")
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	typeName := p.next()
+	if typeName.kind != tokenWord {
+		return fmt.Errorf("expected a type for column %s near %q", name, typeName.text)
+	}
+
+	column := Column{Name: name, Type: strings.ToLower(typeName.text), Nullable: "YES"}
+
+	if p.peek().is("(") {
+		args, err := p.parenthesised()
+		if err != nil {
+			return err
+		}
+		column.Type += "(" + args + ")"
+	}
+
+	for p.accept("UNSIGNED") || p.accept("ZEROFILL") || p.accept("SIGNED") {
+		if modifier := strings.ToLower(p.tokens[p.pos-1].text); modifier != "signed" {
+			column.Type += " " + modifier
+		}
+	}
+
+	extras := []string{}
+	primary, unique := false, false
+
+	for !p.done() {
+		switch {
+		case p.accept("NOT", "NULL"):
+			column.Nullable = "NO"
+		case p.accept("NULL"):
+			column.Nullable = "YES"
+		case p.accept("DEFAULT"):
+			generated, err := parseDefault(p, &column)
+			if err != nil {
+				return err
+			}
+			if generated {
+				extras = append(extras, "DEFAULT_GENERATED")
+			}
+		case p.accept("AUTO_INCREMENT"):
+			extras = append(extras, "auto_increment")
+		case p.accept("ON", "UPDATE"):
+			value := strings.ToUpper(p.next().text)
+			if p.peek().is("(") {
+				args, _ := p.parenthesised()
+				value += "(" + args + ")"
+			}
+			extras = append(extras, "on update "+value)
+		case p.accept("COMMENT"):
+			column.Description = p.next().text
+		case p.accept("PRIMARY", "KEY") || p.accept("KEY"):
+			primary = true
+		case p.accept("UNIQUE"):
+			p.accept("KEY")
+			unique = true
+		case p.accept("CHARACTER", "SET") || p.accept("CHARSET") || p.accept("COLLATE"):
+			p.next()
+		case p.accept("GENERATED", "ALWAYS"):
+			// AS (expression) follows
+		case p.accept("AS"):
+			if _, err := p.parenthesised(); err != nil {
+				return err
+			}
+			kind := "VIRTUAL GENERATED"
+			if p.accept("STORED") || p.accept("PERSISTENT") {
+				kind = "STORED GENERATED"
+			} else {
+				p.accept("VIRTUAL")
+			}
+			extras = append(extras, kind)
+		case p.accept("REFERENCES"):
+			p.pos--
+			if err := t.addReference(p, "", []string{name}); err != nil {
+				return err
+			}
+		case p.accept("CHECK"):
+			if _, err := p.parenthesised(); err != nil {
+				return err
+			}
+		default:
+			// VISIBLE, INVISIBLE, COLUMN_FORMAT, SRID and other attributes
+			// that do not show up in the structure
+			p.next()
+		}
+	}
+
+	column.Extra = strings.Join(extras, " ")
+	t.table.Columns = append(t.table.Columns, column)
+
+	if primary {
+		t.table.Indexes = append(t.table.Indexes, Index{Name: "PRIMARY", Columns: []string{name}, Unique: true, Primary: true, Type: "BTREE"})
+	}
+
+	if unique {
+		t.table.Indexes = append(t.table.Indexes, Index{Name: t.uniqueIndexName(name), Columns: []string{name}, Unique: true, Type: "BTREE"})
+	}
+
+	return nil
+}
+
+// parseDefault reads a DEFAULT clause into the column the way
+// information_schema reports it, and reports whether it is an expression
+func parseDefault(p *ddlParser, column *Column) (bool, error) {
+	t := p.next()
+
+	switch {
+	case t.is("("):
+		p.pos--
+		expression, err := p.parenthesised()
+		if err != nil {
+			return false, err
+		}
+		column.Default, column.HasDefault = expression, true
+		return true, nil
+	case t.kind == tokenString:
+		column.Default, column.HasDefault = t.text, true
+	case t.is("NULL"):
+		column.Default, column.HasDefault = "", false
+	case t.is("TRUE"):
+		column.Default, column.HasDefault = "1", true
+	case t.is("FALSE"):
+		column.Default, column.HasDefault = "0", true
+	case t.is("-") || t.is("+"):
+		number := p.next()
+		column.Default, column.HasDefault = strings.TrimPrefix(t.text, "+")+number.text, true
+	case t.kind == tokenWord && (strings.EqualFold(t.text, "b") || strings.EqualFold(t.text, "x")) && p.peek().kind == tokenString && p.peek().start == t.end:
+		literal := p.next()
+		column.Default, column.HasDefault = strings.ToLower(t.text)+"'"+literal.text+"'", true
+	case t.kind == tokenWord && strings.HasPrefix(t.text, "_") && p.peek().kind == tokenString:
+		// Character set introducer, e.g. _utf8mb4'text'
+		column.Default, column.HasDefault = p.next().text, true
+	case t.kind == tokenWord && expressionDefault.MatchString(t.text):
+		value := strings.ToUpper(t.text)
+		if p.peek().is("(") {
+			args, err := p.parenthesised()
+			if err != nil {
+				return false, err
+			}
+			value += "(" + args + ")"
+		}
+		column.Default, column.HasDefault = value, true
+		return true, nil
+	case t.kind == tokenWord:
+		column.Default, column.HasDefault = t.text, true
+	default:
+		return false, fmt.Errorf("unexpected default %q for column %s", t.text, column.Name)
+	}
+
+	return false, nil
+}
+
+func (d *ddlImport) alterTable(p *ddlParser) error {
+	p.accept("IGNORE")
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	imported, ok := d.tables[name]
+	if !ok {
+		return nil
+	}
+
+	// Split the specifications on top level commas
+	specifications := []*ddlParser{}
+	depth, begin := 0, p.pos
+
+	for i := p.pos; i <= len(p.tokens); i++ {
+		if i == len(p.tokens) || (p.tokens[i].is(",") && depth == 0) {
+			specifications = append(specifications, &ddlParser{sql: p.sql, tokens: p.tokens[begin:i]})
+			begin = i + 1
+			continue
+		}
+
+		switch {
+		case p.tokens[i].is("("):
+			depth++
+		case p.tokens[i].is(")"):
+			depth--
+		}
+	}
+
+	for _, specification := range specifications {
+		if !specification.accept("ADD") {
+			continue
+		}
+
+		// ADD COLUMN may place the column with FIRST or AFTER, which only
+		// affects the column order and is ignored here
+		if err := imported.addDefinition(specification); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *ddlImport) dropObjects(p *ddlParser) error {
+	p.accept("TEMPORARY")
+
+	if !p.accept("TABLE") && !p.accept("VIEW") {
+		return nil
+	}
+
+	p.accept("IF", "EXISTS")
+
+	for !p.done() {
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+
+		d.drop(name)
+
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (d *ddlImport) createIndex(p *ddlParser) error {
+	index := Index{}
+
+	switch {
+	case p.accept("UNIQUE"):
+		index.Unique = true
+	case p.accept("FULLTEXT"):
+		index.Type = "FULLTEXT"
+	case p.accept("SPATIAL"):
+		index.Type = "SPATIAL"
+	}
+
+	if err := p.expect("INDEX"); err != nil {
+		return err
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	if p.accept("USING") {
+		index.Type = strings.ToUpper(p.next().text)
+	}
+
+	if err := p.expect("ON"); err != nil {
+		return err
+	}
+
+	table, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	imported, ok := d.tables[table]
+	if !ok {
+		return nil
+	}
+
+	index.Name = name
+	rest := &ddlParser{sql: p.sql, tokens: p.tokens[p.pos:]}
+
+	return imported.addIndex(rest, index, false)
+}
+
+var checkOption = regexp.MustCompile(`(?is)\s+WITH\s+(CASCADED\s+|LOCAL\s+)?CHECK\s+OPTION\s*$`)
+
+func (d *ddlImport) createView(p *ddlParser) error {
+	p.accept("IF", "NOT", "EXISTS")
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	var columnNames []string
+
+	if p.peek().is("(") {
+		columnNames, err = p.names()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := p.expect("AS"); err != nil {
+		return err
+	}
+
+	definition := checkOption.ReplaceAllString(p.rest(), "")
+
+	var columns []Column
+
+	switch {
+	case len(columnNames) > 0:
+		for _, column := range columnNames {
+			columns = append(columns, Column{Name: column, Nullable: "YES"})
+		}
+	case d.tables[name] != nil:
+		columns = d.tables[name].table.Columns
+	case d.standIns[name] != nil:
+		columns = d.standIns[name]
+	default:
+		for _, column := range selectColumns(definition) {
+			columns = append(columns, Column{Name: column, Nullable: "YES"})
+		}
+	}
+
+	d.put(Table{Name: name, Type: TableTypeView, ViewDefinition: definition, Columns: columns})
+
+	return nil
+}
+
+// selectColumns lists the output column names of a SELECT statement, using
+// aliases where present
+func selectColumns(query string) []string {
+	p := newDDLParser(query)
+
+	if !p.accept("SELECT") {
+		return nil
+	}
+
+	for p.accept("DISTINCT") || p.accept("ALL") || p.accept("SQL_NO_CACHE") || p.accept("STRAIGHT_JOIN") {
+	}
+
+	columns := []string{}
+	depth, begin := 0, p.pos
+
+	for i := p.pos; i <= len(p.tokens); i++ {
+		end := i == len(p.tokens) || (depth == 0 && p.tokens[i].is("FROM"))
+
+		if end || (depth == 0 && p.tokens[i].is(",")) {
+			if item := p.tokens[begin:i]; len(item) > 0 {
+				last := item[len(item)-1]
+
+				if last.kind == tokenWord || last.kind == tokenIdentifier || last.kind == tokenString {
+					columns = append(columns, last.text)
+				}
+			}
+
+			if end {
+				break
+			}
+
+			begin = i + 1
+			continue
+		}
+
+		switch {
+		case p.tokens[i].is("("):
+			depth++
+		case p.tokens[i].is(")"):
+			depth--
+		}
+	}
+
+	return columns
+}
+
+func (d *ddlImport) createTrigger(p *ddlParser) error {
+	p.accept("IF", "NOT", "EXISTS")
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	timing := strings.ToUpper(p.next().text)
+	event := strings.ToUpper(p.next().text)
+
+	if err := p.expect("ON"); err != nil {
+		return err
+	}
+
+	table, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	if err := p.expect("FOR", "EACH", "ROW"); err != nil {
+		return err
+	}
+
+	if p.accept("FOLLOWS") || p.accept("PRECEDES") {
+		p.next()
+	}
+
+	d.triggers = append(d.triggers, Trigger{
+		Name:      name,
+		Table:     table,
+		Timing:    timing,
+		Event:     event,
+		Statement: p.rest(),
+	})
+
+	return nil
+}
+
+func (d *ddlImport) createRoutine(p *ddlParser, routineType string) error {
+	p.accept("IF", "NOT", "EXISTS")
+
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+
+	items, err := p.list()
+	if err != nil {
+		return err
+	}
+
+	routine := Routine{Name: name, Type: routineType, Parameters: []RoutineParameter{}}
+
+	for _, item := range items {
+		parameter := RoutineParameter{}
+
+		if routineType == "PROCEDURE" {
+			parameter.Mode = "IN"
+		}
+
+		if item.accept("IN") || item.accept("OUT") || item.accept("INOUT") {
+			parameter.Mode = strings.ToUpper(item.tokens[item.pos-1].text)
+		}
+
+		parameter.Name, err = item.name()
+		if err != nil {
+			return err
+		}
+
+		parameter.Type = strings.ToLower(item.rest())
+		routine.Parameters = append(routine.Parameters, parameter)
+	}
+
+	if p.accept("RETURNS") {
+		start := p.peek()
+		p.next()
+
+		if p.peek().is("(") {
+			p.parenthesised()
+		}
+
+		for p.accept("UNSIGNED") || p.accept("ZEROFILL") {
+		}
+
+		if p.accept("CHARSET") || p.accept("CHARACTER", "SET") || p.accept("COLLATE") {
+			p.next()
+		}
+
+		routine.Returns = strings.ToLower(strings.TrimSpace(p.sql[start.start:p.tokens[p.pos-1].end]))
+	}
+
+	for {
+		switch {
+		case p.accept("COMMENT"):
+			routine.Description = p.next().text
+		case p.accept("LANGUAGE", "SQL"), p.accept("DETERMINISTIC"), p.accept("NOT", "DETERMINISTIC"),
+			p.accept("CONTAINS", "SQL"), p.accept("NO", "SQL"), p.accept("READS", "SQL", "DATA"),
+			p.accept("MODIFIES", "SQL", "DATA"):
+		case p.accept("SQL", "SECURITY"):
+			p.next()
+		default:
+			routine.Definition = p.rest()
+			d.routines = append(d.routines, routine)
+			return nil
+		}
+	}
+}
+
+// structure assembles the imported objects, deriving the key flags and
+// foreign key rows the scanner reads from information_schema
+func (d *ddlImport) structure() Structure {
+	structure := Structure{
+		DBType:   "mysql",
+		Tables:   []Table{},
+		Routines: d.routines,
+		Triggers: d.triggers,
+	}
+
+	if structure.Routines == nil {
+		structure.Routines = []Routine{}
+	}
+
+	if structure.Triggers == nil {
+		structure.Triggers = []Trigger{}
+	}
+
+	for _, name := range d.order {
+		imported := d.tables[name]
+		table := imported.table
+
+		if table.Columns == nil {
+			table.Columns = []Column{}
+		}
+
+		table.Indexes = append([]Index{}, table.Indexes...)
+		table.ForeignKeys = []ForeignKey{}
+
+		for _, fk := range imported.constraints {
+			// InnoDB creates an index for a foreign key that no index covers
+			if !indexCovers(table.Indexes, fk.Columns) {
+				table.Indexes = append(table.Indexes, Index{Name: fk.Name, Columns: fk.Columns, Type: "BTREE"})
+			}
+
+			for i, column := range fk.Columns {
+				table.ForeignKeys = append(table.ForeignKeys, ForeignKey{
+					ColumnName:       column,
+					ReferencedTable:  fk.ReferencedTable,
+					ReferencedColumn: fk.ReferencedColumns[i],
+					ConstraintName:   fk.Name,
+					OnDelete:         fk.OnDelete,
+					OnUpdate:         fk.OnUpdate,
+					CascadeDelete:    fk.OnDelete == "CASCADE",
+					CascadeUpdate:    fk.OnUpdate == "CASCADE",
+				})
+			}
+		}
+
+		for _, index := range table.Indexes {
+			for i, name := range index.Columns {
+				column := table.FindColumn(name)
+				if column == nil {
+					continue
+				}
+
+				switch {
+				case index.Primary:
+					column.IsPrimary = true
+					column.Key = "PRI"
+					column.Nullable = "NO"
+				case i > 0 || column.Key != "":
+				case index.Unique && len(index.Columns) == 1:
+					column.Key = "UNI"
+				default:
+					column.Key = "MUL"
+				}
+			}
+		}
+
+		table.applyIndexFlags()
+		structure.Tables = append(structure.Tables, table)
+	}
+
+	return structure
+}
+
+// indexCovers reports whether an index starts with the given columns
+func indexCovers(indexes []Index, columns []string) bool {
+	for _, index := range indexes {
+		if len(index.Columns) < len(columns) {
+			continue
+		}
+
+		covered := true
+		for i, column := range columns {
+			if !strings.EqualFold(index.Columns[i], column) {
+				covered = false
+				break
+			}
+		}
+
+		if covered {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,165 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+const mysqldumpFixture = `-- MySQL dump 10.13  Distrib 8.0.36, for Linux (x86_64)
+/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+/*!50503 SET NAMES utf8mb4 */;
+
+--
+-- Table structure for table ` + "`customers`" + `
+--
+
+DROP TABLE IF EXISTS ` + "`customers`" + `;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+CREATE TABLE ` + "`customers`" + ` (
+  ` + "`id`" + ` int unsigned NOT NULL AUTO_INCREMENT,
+  ` + "`email`" + ` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT 'Login e-mail; unique',
+  ` + "`status`" + ` enum('active','it''s closed') NOT NULL DEFAULT 'active',
+  ` + "`balance`" + ` decimal(10,2) NOT NULL DEFAULT '0.00',
+  ` + "`created_at`" + ` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  ` + "`updated_at`" + ` datetime(3) DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP(3),
+  ` + "`token`" + ` char(36) NOT NULL DEFAULT (uuid()),
+  PRIMARY KEY (` + "`id`" + `),
+  UNIQUE KEY ` + "`customers_email_unique`" + ` (` + "`email`" + `),
+  FULLTEXT KEY ` + "`customers_email_search`" + ` (` + "`email`" + `)
+) ENGINE=InnoDB AUTO_INCREMENT=42 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='People who order';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+CREATE TABLE ` + "`orders`" + ` (
+  ` + "`id`" + ` bigint NOT NULL AUTO_INCREMENT,
+  ` + "`customer_id`" + ` int unsigned NOT NULL,
+  ` + "`total`" + ` decimal(10,2) DEFAULT '-1.50',
+  PRIMARY KEY (` + "`id`" + `),
+  CONSTRAINT ` + "`orders_customer_fk`" + ` FOREIGN KEY (` + "`customer_id`" + `) REFERENCES ` + "`customers`" + ` (` + "`id`" + `) ON DELETE CASCADE ON UPDATE NO ACTION
+) ENGINE=InnoDB;
+
+--
+-- Temporary view structure for view ` + "`active_customers`" + `
+--
+
+DROP TABLE IF EXISTS ` + "`active_customers`" + `;
+/*!50001 DROP VIEW IF EXISTS ` + "`active_customers`" + `*/;
+/*!50001 CREATE VIEW ` + "`active_customers`" + ` AS SELECT
+ 1 AS ` + "`id`" + `,
+ 1 AS ` + "`email`" + `*/;
+
+DELIMITER ;;
+/*!50003 CREATE*/ /*!50017 DEFINER=` + "`root`@`localhost`" + `*/ /*!50003 TRIGGER ` + "`orders_before_insert`" + ` BEFORE INSERT ON ` + "`orders`" + ` FOR EACH ROW BEGIN
+  SET NEW.total = IFNULL(NEW.total, 0);
+END */;;
+DELIMITER ;
+
+DELIMITER ;;
+CREATE DEFINER=` + "`root`@`%`" + ` FUNCTION ` + "`order_count`" + `(customer int) RETURNS int
+    READS SQL DATA
+    COMMENT 'Orders per customer'
+BEGIN
+  RETURN (SELECT COUNT(*) FROM orders WHERE customer_id = customer);
+END ;;
+DELIMITER ;
+
+/*!50001 DROP VIEW IF EXISTS ` + "`active_customers`" + `*/;
+/*!50001 CREATE ALGORITHM=UNDEFINED */
+/*!50013 DEFINER=` + "`root`@`localhost`" + ` SQL SECURITY DEFINER */
+/*!50001 VIEW ` + "`active_customers`" + ` AS select ` + "`c`.`id` AS `id`,`c`.`email` AS `email`" + ` from ` + "`customers` `c`" + ` where (` + "`c`.`status`" + ` = 'active') */;
+
+CREATE INDEX orders_total_index ON orders (total DESC);
+ALTER TABLE orders ADD COLUMN note text, ADD CONSTRAINT orders_self_fk FOREIGN KEY (id) REFERENCES orders (id);
+`
+
+func TestParseDDL(t *testing.T) {
+	structure, err := ParseDDL(mysqldumpFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(structure.Tables) != 3 {
+		t.Fatalf("expected customers, orders and active_customers, got %d tables", len(structure.Tables))
+	}
+
+	customers := structure.FindTable("customers")
+	if customers == nil || customers.Description != "People who order" {
+		t.Fatalf("expected customers with its comment, got %+v", customers)
+	}
+
+	expectColumn := func(table *Table, expected Column) {
+		t.Helper()
+
+		column := table.FindColumn(expected.Name)
+		if column == nil {
+			t.Fatalf("expected column %s in %s", expected.Name, table.Name)
+		}
+
+		if *column != expected {
+			t.Errorf("column %s:\n got  %+v\n want %+v", expected.Name, *column, expected)
+		}
+	}
+
+	expectColumn(customers, Column{Name: "id", Type: "int unsigned", Nullable: "NO", Key: "PRI", Extra: "auto_increment", IsPrimary: true, IsUnique: true, HasIndex: true})
+	expectColumn(customers, Column{Name: "email", Type: "varchar(255)", Nullable: "NO", Key: "UNI", IsUnique: true, HasIndex: true, Description: "Login e-mail; unique"})
+	expectColumn(customers, Column{Name: "status", Type: "enum('active','it''s closed')", Nullable: "NO", Default: "active", HasDefault: true})
+	expectColumn(customers, Column{Name: "balance", Type: "decimal(10,2)", Nullable: "NO", Default: "0.00", HasDefault: true})
+	expectColumn(customers, Column{Name: "created_at", Type: "timestamp", Nullable: "YES", Default: "CURRENT_TIMESTAMP", HasDefault: true, Extra: "DEFAULT_GENERATED"})
+	expectColumn(customers, Column{Name: "updated_at", Type: "datetime(3)", Nullable: "YES", Extra: "on update CURRENT_TIMESTAMP(3)"})
+	expectColumn(customers, Column{Name: "token", Type: "char(36)", Nullable: "NO", Default: "uuid()", HasDefault: true, Extra: "DEFAULT_GENERATED"})
+
+	if len(customers.Indexes) != 3 || customers.Indexes[2].Type != "FULLTEXT" {
+		t.Errorf("expected primary, unique and fulltext indexes, got %+v", customers.Indexes)
+	}
+
+	orders := structure.FindTable("orders")
+	expectColumn(orders, Column{Name: "total", Type: "decimal(10,2)", Nullable: "YES", Key: "MUL", HasIndex: true, Default: "-1.50", HasDefault: true})
+	expectColumn(orders, Column{Name: "note", Type: "text", Nullable: "YES"})
+
+	constraints := orders.ForeignKeyConstraints()
+	if len(constraints) != 2 || constraints[0].Name != "orders_customer_fk" || constraints[0].OnDelete != "CASCADE" || constraints[0].OnUpdate != "NO ACTION" {
+		t.Fatalf("unexpected foreign keys: %+v", constraints)
+	}
+
+	if !orders.ForeignKeys[0].CascadeDelete {
+		t.Error("expected the cascade flag to be derived from ON DELETE")
+	}
+
+	// InnoDB adds an index for customer_id since no other index covers it
+	if column := orders.FindColumn("customer_id"); column.Key != "MUL" || !column.HasIndex {
+		t.Errorf("expected customer_id to get the foreign key index, got %+v", column)
+	}
+
+	view := structure.FindTable("active_customers")
+	if view == nil || !view.IsView() {
+		t.Fatalf("expected active_customers to be a view, got %+v", view)
+	}
+
+	if !strings.HasPrefix(view.ViewDefinition, "select `c`.`id` AS `id`") || !strings.HasSuffix(view.ViewDefinition, "= 'active')") {
+		t.Errorf("unexpected view definition %q", view.ViewDefinition)
+	}
+
+	if len(view.Columns) != 2 || view.Columns[1].Name != "email" {
+		t.Errorf("expected the view columns from the stand-in view, got %+v", view.Columns)
+	}
+
+	if len(structure.Triggers) != 1 || structure.Triggers[0].Table != "orders" || structure.Triggers[0].Timing != "BEFORE" ||
+		!strings.Contains(structure.Triggers[0].Statement, "SET NEW.total = IFNULL(NEW.total, 0);") {
+		t.Errorf("unexpected triggers %+v", structure.Triggers)
+	}
+
+	if len(structure.Routines) != 1 {
+		t.Fatalf("expected one routine, got %+v", structure.Routines)
+	}
+
+	if signature := structure.Routines[0].Signature(); signature != "FUNCTION order_count(customer int) RETURNS int" {
+		t.Errorf("unexpected routine signature %q", signature)
+	}
+
+	if structure.Routines[0].Description != "Orders per customer" || !strings.HasPrefix(structure.Routines[0].Definition, "BEGIN") {
+		t.Errorf("unexpected routine %+v", structure.Routines[0])
+	}
+
+	if _, err := ParseDDL("INSERT INTO t VALUES (1);"); err == nil {
+		t.Error("expected a script without tables to be rejected")
+	}
+}
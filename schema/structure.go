@@ -0,0 +1,158 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Structure is a snapshot of a database schema, stored as JSON in the
+// database_structure table and consumed by the SQL assistant and the diagram
+type Structure struct {
+	DBType   string    `json:"dbType"`
+	Tables   []Table   `json:"tables"`
+	Routines []Routine `json:"routines"`
+	Triggers []Trigger `json:"triggers"`
+}
+
+// Table types
+const (
+	TableTypeBase = "table"
+	TableTypeView = "view"
+)
+
+// Table represents a table or view and everything attached to it
+type Table struct {
+	Name           string       `json:"name"`
+	Type           string       `json:"type"`
+	ViewDefinition string       `json:"viewDefinition"`
+	Description    string       `json:"description"`
+	EstimatedRows  int          `json:"estimatedRows"`
+	Columns        []Column     `json:"columns"`
+	ForeignKeys    []ForeignKey `json:"foreignKeys"`
+	Indexes        []Index      `json:"indexes"`
+}
+
+// Column represents a table column
+type Column struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Nullable    string `json:"nullable"`
+	Key         string `json:"key"`
+	Default     string `json:"default"`
+	HasDefault  bool   `json:"hasDefault"`
+	Extra       string `json:"extra"`
+	IsPrimary   bool   `json:"isPrimary"`
+	IsUnique    bool   `json:"isUnique"`
+	HasIndex    bool   `json:"hasIndex"`
+	Description string `json:"description"`
+}
+
+// ForeignKey represents one column of a foreign key constraint
+type ForeignKey struct {
+	ColumnName       string `json:"columnName"`
+	ReferencedTable  string `json:"referencedTable"`
+	ReferencedColumn string `json:"referencedColumn"`
+	ConstraintName   string `json:"constraintName"`
+	OnDelete         string `json:"onDelete"`
+	OnUpdate         string `json:"onUpdate"`
+	CascadeDelete    bool   `json:"cascadeDelete"`
+	CascadeUpdate    bool   `json:"cascadeUpdate"`
+}
+
+// Index represents an index with its columns in key order
+type Index struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+	Type    string   `json:"type"`
+}
+
+// Routine represents a stored procedure or function
+type Routine struct {
+	Name        string             `json:"name"`
+	Type        string             `json:"type"`
+	Returns     string             `json:"returns"`
+	Parameters  []RoutineParameter `json:"parameters"`
+	Definition  string             `json:"definition"`
+	Description string             `json:"description"`
+}
+
+// RoutineParameter represents one parameter of a routine
+type RoutineParameter struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+}
+
+// Trigger represents a table trigger
+type Trigger struct {
+	Name      string `json:"name"`
+	Table     string `json:"table"`
+	Timing    string `json:"timing"`
+	Event     string `json:"event"`
+	Statement string `json:"statement"`
+}
+
+// IsView reports whether the table is a view
+func (t *Table) IsView() bool {
+	return t.Type == TableTypeView
+}
+
+// Signature renders the routine's call signature, e.g.
+// "FUNCTION order_total(customer_id int) RETURNS decimal(10,2)"
+func (r Routine) Signature() string {
+	parameters := make([]string, len(r.Parameters))
+
+	for i, parameter := range r.Parameters {
+		parameters[i] = strings.TrimSpace(parameter.Mode + " " + parameter.Name + " " + parameter.Type)
+	}
+
+	signature := fmt.Sprintf("%s %s(%s)", r.Type, r.Name, strings.Join(parameters, ", "))
+
+	if r.Returns != "" {
+		signature += " RETURNS " + r.Returns
+	}
+
+	return signature
+}
+
+// FindTable returns the table with the given name, or nil
+func (s *Structure) FindTable(name string) *Table {
+	for i := range s.Tables {
+		if s.Tables[i].Name == name {
+			return &s.Tables[i]
+		}
+	}
+
+	return nil
+}
+
+// FindColumn returns the column with the given name, or nil
+func (t *Table) FindColumn(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+
+	return nil
+}
+
+// applyIndexFlags marks columns that lead an index, and columns that are
+// unique on their own, from the table's index list
+func (t *Table) applyIndexFlags() {
+	for _, index := range t.Indexes {
+		if len(index.Columns) == 0 {
+			continue
+		}
+
+		if column := t.FindColumn(index.Columns[0]); column != nil {
+			column.HasIndex = true
+
+			if index.Unique && len(index.Columns) == 1 {
+				column.IsUnique = true
+			}
+		}
+	}
+}
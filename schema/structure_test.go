@@ -0,0 +1,40 @@
+package schema
+
+import "testing"
+
+func TestApplyIndexFlags(t *testing.T) {
+	table := Table{
+		Name: "users",
+		Columns: []Column{
+			{Name: "id", IsPrimary: true},
+			{Name: "email"},
+			{Name: "tenant_id"},
+			{Name: "created_at"},
+			{Name: "nickname"},
+		},
+		Indexes: []Index{
+			{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+			{Name: "users_email_unique", Columns: []string{"email"}, Unique: true},
+			{Name: "users_tenant_created", Columns: []string{"tenant_id", "created_at"}, Unique: true},
+		},
+	}
+
+	table.applyIndexFlags()
+
+	expect := map[string][2]bool{
+		"id":         {true, true},
+		"email":      {true, true},
+		"tenant_id":  {true, false},
+		"created_at": {false, false},
+		"nickname":   {false, false},
+	}
+
+	for name, flags := range expect {
+		column := table.FindColumn(name)
+
+		if column.HasIndex != flags[0] || column.IsUnique != flags[1] {
+			t.Errorf("%s: expected hasIndex=%t isUnique=%t, got hasIndex=%t isUnique=%t",
+				name, flags[0], flags[1], column.HasIndex, column.IsUnique)
+		}
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const searchResultLimit = 50
+
+// QuerySearchResult is a saved query matching SearchQueries. TitleHighlight
+// and Snippet are HTML-escaped with the matches wrapped in <mark> tags
+type QuerySearchResult struct {
+	Query          Query
+	Score          float64
+	TitleHighlight string
+	Snippet        string
+	MatchedTables  []string
+}
+
+var referencedTablePattern = regexp.MustCompile("(?i)\\b(from|join|into|update(?:\\s+(?:low_priority|ignore))*|table(?:\\s+if\\s+(?:not\\s+)?exists)?)\\s+((?:[`\"\\[]?[\\w$]+[`\"\\]]?\\.)?[`\"\\[]?[\\w$]+[`\"\\]]?)")
+
+var selectKeyword = regexp.MustCompile(`(?i)\bselect\b`)
+
+// referencedTables lists the tables a query reads or writes, in the order
+// they first appear, lower-cased and without quotes
+func referencedTables(query string) []string {
+	tables := []string{}
+	seen := make(map[string]bool)
+
+	for _, match := range referencedTablePattern.FindAllStringSubmatchIndex(query, -1) {
+		keyword := strings.ToLower(query[match[2]:match[3]])
+
+		// UPDATE only names a table when it starts a statement, not in
+		// ON DUPLICATE KEY UPDATE or FOR UPDATE
+		if strings.HasPrefix(keyword, "update") && !startsStatement(query[:match[0]]) {
+			continue
+		}
+
+		// FROM inside a call such as EXTRACT(YEAR FROM created_at) names a
+		// column, unlike the FROM of a subquery
+		if keyword == "from" && insideFunctionCall(query[:match[0]]) {
+			continue
+		}
+
+		table := strings.ToLower(strings.NewReplacer("`", "", "\"", "", "[", "", "]", "").Replace(query[match[4]:match[5]]))
+
+		if seen[table] || table == "dual" || table == "select" {
+			continue
+		}
+
+		seen[table] = true
+		tables = append(tables, table)
+	}
+
+	return tables
+}
+
+// startsStatement reports whether a keyword after before is the first of a
+// statement, allowing for comments between statements
+func startsStatement(before string) bool {
+	lines := strings.Split(strings.TrimSpace(before), "\n")
+	last := strings.TrimSpace(lines[len(lines)-1])
+
+	return last == "" || strings.HasSuffix(last, ";") || strings.HasPrefix(last, "--") || strings.HasSuffix(last, "*/")
+}
+
+// insideFunctionCall reports whether the innermost parenthesis still open
+// at the end of before belongs to a call rather than a subquery
+func insideFunctionCall(before string) bool {
+	depth := 0
+
+	for i := len(before) - 1; i >= 0; i-- {
+		switch before[i] {
+		case ')':
+			depth++
+		case '(':
+			if depth == 0 {
+				return !selectKeyword.MatchString(before[i:])
+			}
+			depth--
+		}
+	}
+
+	return false
+}
+
+func referencedTablesColumn(query string) string {
+	return strings.Join(referencedTables(query), " ")
+}
+
+// backfillReferencedTables fills queries.referenced_tables for queries saved
+// before the column existed
+func backfillReferencedTables(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, COALESCE(query, '') FROM queries WHERE referenced_tables = ''")
+	if err != nil {
+		return err
+	}
+
+	tables := make(map[int]string)
+
+	for rows.Next() {
+		var id int
+		var query string
+
+		err = rows.Scan(&id, &query)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		tables[id] = referencedTablesColumn(query)
+	}
+
+	rows.Close()
+
+	for id, column := range tables {
+		if column == "" {
+			continue
+		}
+
+		_, err = tx.Exec("UPDATE queries SET referenced_tables = ? WHERE id = ?", column, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fts5Available reports whether the SQLite library was built with FTS5,
+// which mattn/go-sqlite3 only includes with the sqlite_fts5 build tag
+func fts5Available(db *sql.DB) (bool, error) {
+	var enabled bool
+
+	err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+
+	return enabled, err
+}
+
+// ensureQuerySearchIndex keeps the FTS5 index over the queries in step with
+// the build. With FTS5 the index and its triggers are created and filled when
+// missing. Without it the triggers are dropped, because every write to
+// queries would fail on them; the index is rebuilt once FTS5 is back
+func ensureQuerySearchIndex(db *sql.DB) error {
+	available, err := fts5Available(db)
+	if err != nil {
+		return err
+	}
+
+	if !available {
+		_, err = db.Exec(`
+			DROP TRIGGER IF EXISTS queries_fts_insert;
+			DROP TRIGGER IF EXISTS queries_fts_delete;
+			DROP TRIGGER IF EXISTS queries_fts_update;
+		`)
+
+		return err
+	}
+
+	var triggers int
+
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'queries_fts_%'").Scan(&triggers)
+	if err != nil || triggers == 3 {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS queries_fts USING fts5 (
+			title, description, query, referenced_tables,
+			content = 'queries', content_rowid = 'id'
+		);
+
+		CREATE TRIGGER IF NOT EXISTS queries_fts_insert AFTER INSERT ON queries BEGIN
+			INSERT INTO queries_fts (rowid, title, description, query, referenced_tables)
+			VALUES (new.id, new.title, new.description, new.query, new.referenced_tables);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS queries_fts_delete AFTER DELETE ON queries BEGIN
+			INSERT INTO queries_fts (queries_fts, rowid, title, description, query, referenced_tables)
+			VALUES ('delete', old.id, old.title, old.description, old.query, old.referenced_tables);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS queries_fts_update AFTER UPDATE OF title, description, query, referenced_tables ON queries BEGIN
+			INSERT INTO queries_fts (queries_fts, rowid, title, description, query, referenced_tables)
+			VALUES ('delete', old.id, old.title, old.description, old.query, old.referenced_tables);
+			INSERT INTO queries_fts (rowid, title, description, query, referenced_tables)
+			VALUES (new.id, new.title, new.description, new.query, new.referenced_tables);
+		END;
+
+		INSERT INTO queries_fts (queries_fts) VALUES ('rebuild');
+	`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// searchTerms splits what the user typed into words, dropping the
+// punctuation that would otherwise be read as FTS5 syntax
+func searchTerms(term string) []string {
+	return strings.FieldsFunc(term, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// SearchQueries finds active saved queries containing every word of term as
+// a prefix, in the title, description, SQL or the tables the SQL references.
+// Title and table matches rank above matches in the SQL body
+func (a *App) SearchQueries(term string) ([]QuerySearchResult, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return searchQueries(db, term)
+}
+
+func searchQueries(db *sql.DB, term string) ([]QuerySearchResult, error) {
+	results := make([]QuerySearchResult, 0)
+
+	terms := searchTerms(term)
+	if len(terms) == 0 {
+		return results, nil
+	}
+
+	var indexed int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'queries_fts_insert'").Scan(&indexed)
+	if err != nil {
+		return results, err
+	}
+
+	if indexed > 0 {
+		results, err = searchQueryIndex(db, terms)
+	} else {
+		results, err = scanQueriesForTerms(db, terms)
+	}
+
+	if err != nil {
+		return results, err
+	}
+
+	// Tags are loaded as for the query list
+	queries := make([]Query, len(results))
+	for i := range results {
+		queries[i] = results[i].Query
+	}
+
+	err = loadQueryTags(db, queries)
+	if err != nil {
+		return results, err
+	}
+
+	matcher := termMatcher(terms)
+
+	for i := range results {
+		results[i].Query.Tags = queries[i].Tags
+		query := &results[i].Query
+
+		results[i].TitleHighlight = highlightMatches(query.Title, matcher)
+		results[i].Snippet = matchSnippet(query.Query, matcher)
+
+		if results[i].Snippet == "" {
+			results[i].Snippet = matchSnippet(query.Description, matcher)
+		}
+
+		results[i].MatchedTables = []string{}
+
+		for _, table := range referencedTables(query.Query) {
+			if matcher.MatchString(table) {
+				results[i].MatchedTables = append(results[i].MatchedTables, table)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// searchQueryIndex ranks matches with bm25, weighting the title and the
+// referenced tables above the description and the SQL
+func searchQueryIndex(db *sql.DB, terms []string) ([]QuerySearchResult, error) {
+	results := make([]QuerySearchResult, 0)
+
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + term + `"*`
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT %s, -bm25(queries_fts, 10.0, 4.0, 1.0, 8.0) AS score
+		FROM queries_fts JOIN queries ON queries.id = queries_fts.rowid
+		WHERE queries_fts MATCH ? AND queries.deleted_at IS NULL
+		ORDER BY score DESC
+		LIMIT ?
+	`, queryColumns), strings.Join(phrases, " "), searchResultLimit)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result QuerySearchResult
+		var description sql.NullString
+
+		err = rows.Scan(&result.Query.ID, &result.Query.Title, &result.Query.Query, &description, &result.Query.FolderID,
+			&result.Query.CreatedAt, &result.Query.UpdatedAt, &result.Query.DeletedAt, &result.Score)
+		if err != nil {
+			return results, err
+		}
+
+		result.Query.Description = description.String
+		result.Query.Tags = []string{}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// scanQueriesForTerms is the search used when the app was built without
+// FTS5. It filters with LIKE and ranks with the same column weights
+func scanQueriesForTerms(db *sql.DB, terms []string) ([]QuerySearchResult, error) {
+	results := make([]QuerySearchResult, 0)
+
+	conditions := []string{"queries.deleted_at IS NULL"}
+	args := []interface{}{}
+
+	for _, term := range terms {
+		conditions = append(conditions, "(COALESCE(queries.title, '') || ' ' || COALESCE(queries.description, '') || ' ' || COALESCE(queries.query, '') || ' ' || queries.referenced_tables) LIKE ?")
+		args = append(args, "%"+term+"%")
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, queries.referenced_tables FROM queries WHERE %s", queryColumns, strings.Join(conditions, " AND ")), args...)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	matcher := termMatcher(terms)
+
+	for rows.Next() {
+		var result QuerySearchResult
+		var description sql.NullString
+		var tables string
+
+		err = rows.Scan(&result.Query.ID, &result.Query.Title, &result.Query.Query, &description, &result.Query.FolderID,
+			&result.Query.CreatedAt, &result.Query.UpdatedAt, &result.Query.DeletedAt, &tables)
+		if err != nil {
+			return results, err
+		}
+
+		result.Query.Description = description.String
+		result.Query.Tags = []string{}
+
+		// LIKE also matches inside words; keep only word-prefix matches
+		// like the index does
+		for _, weighted := range []struct {
+			text   string
+			weight float64
+		}{{result.Query.Title, 10}, {tables, 8}, {result.Query.Description, 4}, {result.Query.Query, 1}} {
+			result.Score += weighted.weight * float64(len(matcher.FindAllStringIndex(weighted.text, -1)))
+		}
+
+		if !matchesEveryTerm(terms, result.Query.Title, tables, result.Query.Description, result.Query.Query) {
+			continue
+		}
+
+		results = append(results, result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return results, err
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+
+	if len(results) > searchResultLimit {
+		results = results[:searchResultLimit]
+	}
+
+	return results, nil
+}
+
+func matchesEveryTerm(terms []string, texts ...string) bool {
+	for _, term := range terms {
+		matcher := termMatcher([]string{term})
+		found := false
+
+		for _, text := range texts {
+			if matcher.MatchString(text) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// termMatcher matches the words of a search at the start of a word
+func termMatcher(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+
+	return regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(` + strings.Join(quoted, "|") + `)`)
+}
+
+// highlightMatches escapes text for HTML and wraps each match in <mark>
+func highlightMatches(text string, matcher *regexp.Regexp) string {
+	var sb strings.Builder
+
+	last := 0
+
+	for _, match := range matcher.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+
+		sb.WriteString(html.EscapeString(text[last:start]))
+		sb.WriteString("<mark>")
+		sb.WriteString(html.EscapeString(text[start:end]))
+		sb.WriteString("</mark>")
+
+		last = end
+	}
+
+	sb.WriteString(html.EscapeString(text[last:]))
+
+	return sb.String()
+}
+
+// matchSnippet returns a single line of text around its first match,
+// highlighted, or an empty string when nothing matches
+func matchSnippet(text string, matcher *regexp.Regexp) string {
+	match := matcher.FindStringSubmatchIndex(text)
+	if match == nil {
+		return ""
+	}
+
+	const before, after = 40, 80
+
+	start, end := match[2], match[3]
+
+	// Widen to whole words, at most before bytes ahead and after bytes past
+	// the match
+	from := 0
+	if start > before {
+		from = start - before
+
+		if space := strings.IndexAny(text[from:start], " \t\r\n"); space >= 0 {
+			from += space + 1
+		}
+
+		for from < start && !utf8.RuneStart(text[from]) {
+			from++
+		}
+	}
+
+	to := len(text)
+	if end+after < len(text) {
+		to = end + after
+
+		if space := strings.LastIndexAny(text[end:to], " \t\r\n"); space > 0 {
+			to = end + space
+		}
+
+		for to > end && !utf8.RuneStart(text[to]) {
+			to--
+		}
+	}
+
+	snippet := strings.Join(strings.Fields(text[from:to]), " ")
+
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+
+	if to < len(text) {
+		snippet += "…"
+	}
+
+	return highlightMatches(snippet, matcher)
+}
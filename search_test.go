@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReferencedTables(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM users u JOIN `shop`.`orders` o ON o.user_id = u.id":                              "users,shop.orders",
+		"INSERT INTO audit (id) SELECT id FROM Users WHERE id IN (SELECT 1)":                            "audit,users",
+		"UPDATE products SET price = 1; DELETE FROM \"stock\"":                                          "products,stock",
+		"CREATE TABLE IF NOT EXISTS archive (id INT)":                                                   "archive",
+		"SELECT NOW() FROM DUAL":                                                                        "",
+		"INSERT INTO stock (sku, qty) VALUES ('a', 1) ON DUPLICATE KEY UPDATE qty = qty + 1":            "stock",
+		"SELECT EXTRACT(YEAR FROM created_at), TRIM(LEADING '0' FROM code) FROM orders FOR UPDATE":      "orders",
+		"SELECT * FROM users WHERE id IN (SELECT user_id FROM orders WHERE YEAR(created_at) = 2024)":    "users,orders",
+		"-- fix prices\nUPDATE LOW_PRIORITY products SET price = 2;\nUPDATE IGNORE `stock` SET qty = 0": "products,stock",
+	}
+
+	for query, expected := range cases {
+		if tables := strings.Join(referencedTables(query), ","); tables != expected {
+			t.Errorf("%s: expected %q, got %q", query, expected, tables)
+		}
+	}
+}
+
+func TestSearchQueries(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+
+	saved := []Query{
+		{Title: "Active customers", Query: "SELECT * FROM customers WHERE active = 1", Description: "Used by the <weekly> report", Tags: []string{"reports", "crm"}},
+		{Title: "Order totals", Query: "SELECT customer_id, SUM(total) FROM orders JOIN customers ON customers.id = orders.customer_id GROUP BY customer_id"},
+		{Title: "Cleanup", Query: "DELETE FROM sessions WHERE expires_at < NOW()", Description: "Removes expired customer sessions"},
+		{Title: "Customer deleted", Query: "SELECT 1"},
+	}
+
+	for _, query := range saved {
+		if err := app.InsertQueryInDatabase(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := app.DeleteQuery(4); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := app.SearchQueries("custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 active matches, got %d", len(results))
+	}
+
+	if results[0].Query.Title != "Active customers" {
+		t.Errorf("expected the title match to rank first, got %q", results[0].Query.Title)
+	}
+
+	if strings.Join(results[0].Query.Tags, ",") != "crm,reports" {
+		t.Errorf("expected the tags of the query, got %v", results[0].Query.Tags)
+	}
+
+	if results[0].TitleHighlight != "Active <mark>custom</mark>ers" {
+		t.Errorf("unexpected title highlight %q", results[0].TitleHighlight)
+	}
+
+	if len(results[0].MatchedTables) != 1 || results[0].MatchedTables[0] != "customers" {
+		t.Errorf("expected the customers table to match, got %v", results[0].MatchedTables)
+	}
+
+	for _, result := range results {
+		if result.Query.Title == "Cleanup" && result.Snippet != "Removes expired <mark>custom</mark>er sessions" {
+			t.Errorf("expected the description snippet, got %q", result.Snippet)
+		}
+	}
+
+	// Every word has to match, and punctuation is not FTS syntax
+	results, err = app.SearchQueries(`orders "customers`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].Query.Title != "Order totals" {
+		t.Errorf("expected only the order totals, got %d results", len(results))
+	}
+
+	// Edits are picked up by the index
+	if err := app.UpdateQuery(3, Query{Query: "DELETE FROM tokens"}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err = app.SearchQueries("tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].Query.Title != "Cleanup" {
+		t.Errorf("expected the updated query to be found, got %d results", len(results))
+	}
+}
+
+func TestMatchSnippet(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 10) + "<b>needle</b> " + strings.Repeat("dolor sit ", 20)
+
+	snippet := matchSnippet(text, termMatcher([]string{"needle"}))
+
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Errorf("expected a trimmed snippet, got %q", snippet)
+	}
+
+	if !strings.Contains(snippet, "&lt;b&gt;<mark>needle</mark>&lt;/b&gt;") {
+		t.Errorf("expected an escaped highlight, got %q", snippet)
+	}
+
+	if len(snippet) > 200 {
+		t.Errorf("expected a short snippet, got %d bytes", len(snippet))
+	}
+}
+
+func TestSearchIndexFollowsBuild(t *testing.T) {
+	db := openFixtureDatabase(t)
+
+	if err := runMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	available, err := fts5Available(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var triggers int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'queries_fts_%'").Scan(&triggers)
+
+	if available != (triggers == 3) {
+		t.Errorf("expected the index triggers to follow FTS5 availability (%v), found %d", available, triggers)
+	}
+
+	var tables string
+	if err := db.QueryRow("SELECT referenced_tables FROM queries WHERE id = 1").Scan(&tables); err != nil || tables != "users" {
+		t.Errorf("expected the fixture query to be backfilled, got %q (%v)", tables, err)
+	}
+
+	results, err := searchQueries(db, "users")
+	if err != nil || len(results) != 1 {
+		t.Errorf("expected the fixture query to be found by table, got %d results (%v)", len(results), err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// Keys of the settings table, which holds preferences stored with the library
+const (
+	settingTrashRetentionDays     = "trash_retention_days"
+	settingSharedLibraryDirectory = "shared_library_directory"
+)
+
+// getSetting returns the stored value of key, or fallback when it is unset
+func getSetting(db *sql.DB, key string, fallback string) (string, error) {
+	var value string
+
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return fallback, nil
+	}
+
+	return value, err
+}
+
+func getIntSetting(db *sql.DB, key string, fallback int) (int, error) {
+	value, err := getSetting(db, key, strconv.Itoa(fallback))
+	if err != nil {
+		return fallback, err
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback, nil
+	}
+
+	return number, nil
+}
+
+func setSetting(db *sql.DB, key string, value string) error {
+	_, err := db.Exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`, key, value)
+
+	return err
+}
@@ -0,0 +1,1120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Reasons of a SharedLibraryConflict
+const (
+	ConflictBothEdited         = "both-edited"
+	ConflictDeletedInLibrary   = "deleted-in-library"
+	ConflictDeletedInDirectory = "deleted-in-directory"
+	ConflictSameTitle          = "same-title"
+	ConflictUnreadable         = "unreadable"
+)
+
+// Sides a SharedLibraryConflict can be resolved to
+const (
+	KeepLibrary   = "library"
+	KeepDirectory = "directory"
+)
+
+// sharedLibrarySyncedEvent is emitted when a background sync changed
+// something or left conflicts
+const sharedLibrarySyncedEvent = "shared-library:synced"
+
+const sharedLibraryPollInterval = 3 * time.Second
+
+// sharedLibraryLock keeps syncs started by the watcher and by the user from
+// running at the same time
+var sharedLibraryLock sync.Mutex
+
+// SharedLibraryConflict is a query that changed on both sides since the last
+// sync. Library and File hold both versions as .sql file contents, empty on
+// the side that deleted it. Neither side is touched until it is resolved
+type SharedLibraryConflict struct {
+	Path    string
+	QueryID *int
+	Title   string
+	Reason  string
+	Message string
+	Library string
+	File    string
+}
+
+// SharedLibrarySyncResult counts what a sync did in each direction. Loaded
+// queries were created or updated from files, Written files from queries
+type SharedLibrarySyncResult struct {
+	Directory string
+	Loaded    int
+	Written   int
+	Trashed   int
+	Removed   int
+	Conflicts []SharedLibraryConflict
+}
+
+func (r SharedLibrarySyncResult) changed() bool {
+	return r.Loaded+r.Written+r.Trashed+r.Removed > 0 || len(r.Conflicts) > 0
+}
+
+// SharedLibraryStatus describes the shared directory and, when it is inside
+// a git working copy, its branch and uncommitted changes
+type SharedLibraryStatus struct {
+	Directory string
+	Git       bool
+	Branch    string
+	Changes   []string
+}
+
+type sharedFile struct {
+	content string
+	hash    string
+}
+
+// sharedQuery is a saved query as it would be written to its file. hash
+// also covers the folder, which is not part of the file contents
+type sharedQuery struct {
+	id      int
+	entry   BundleQuery
+	content string
+	hash    string
+	trashed bool
+}
+
+// sharedMapping links a file to a query with the hashes both had when they
+// were last in sync
+type sharedMapping struct {
+	path      string
+	queryID   int
+	fileHash  string
+	queryHash string
+}
+
+func contentHash(parts ...string) string {
+	sum := sha256.New()
+
+	for _, part := range parts {
+		sum.Write([]byte(part))
+		sum.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func loadSharedFiles(dir string) (map[string]sharedFile, error) {
+	files := make(map[string]sharedFile)
+
+	paths, err := listSQLFiles(dir)
+	if err != nil {
+		return files, err
+	}
+
+	for _, relative := range paths {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(relative)))
+		if err != nil {
+			return files, err
+		}
+
+		files[relative] = sharedFile{content: string(content), hash: contentHash(string(content))}
+	}
+
+	return files, nil
+}
+
+// loadSharedQueries renders every query, including trashed ones, as its file
+func loadSharedQueries(db *sql.DB) (map[int]sharedQuery, error) {
+	queries := make(map[int]sharedQuery)
+
+	list, err := listQueries(db, true, QueryFilter{})
+	if err != nil {
+		return queries, err
+	}
+
+	paths, err := folderPaths(db)
+	if err != nil {
+		return queries, err
+	}
+
+	for _, query := range list {
+		entry, err := bundleEntry(db, query, paths)
+		if err != nil {
+			return queries, err
+		}
+
+		content, err := formatSQLFile(entry)
+		if err != nil {
+			return queries, err
+		}
+
+		queries[*query.ID] = sharedQuery{
+			id:      *query.ID,
+			entry:   entry,
+			content: content,
+			hash:    contentHash(entry.Folder, content),
+			trashed: query.DeletedAt != nil,
+		}
+	}
+
+	return queries, nil
+}
+
+func loadSharedMappings(db *sql.DB) ([]sharedMapping, error) {
+	mappings := []sharedMapping{}
+
+	rows, err := db.Query("SELECT path, query_id, file_hash, query_hash FROM shared_library_files ORDER BY path")
+	if err != nil {
+		return mappings, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mapping sharedMapping
+
+		err = rows.Scan(&mapping.path, &mapping.queryID, &mapping.fileHash, &mapping.queryHash)
+		if err != nil {
+			return mappings, err
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, rows.Err()
+}
+
+// rememberSharedFile records that the file at relative and a query are in
+// sync. A query is linked to one file at most
+func rememberSharedFile(db sqliteExecutor, relative string, queryID int, fileHash string, queryHash string) error {
+	_, err := db.Exec("DELETE FROM shared_library_files WHERE path = ? OR query_id = ?", relative, queryID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO shared_library_files (path, query_id, file_hash, query_hash) VALUES (?, ?, ?, ?)",
+		relative, queryID, fileHash, queryHash)
+
+	return err
+}
+
+func forgetSharedFile(db sqliteExecutor, relative string) error {
+	_, err := db.Exec("DELETE FROM shared_library_files WHERE path = ?", relative)
+
+	return err
+}
+
+// writeSharedFile writes contents to the file at relative inside dir
+func writeSharedFile(dir string, relative string, content string) error {
+	target := filepath.Join(dir, filepath.FromSlash(relative))
+
+	err := os.MkdirAll(filepath.Dir(target), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(target, []byte(content), 0o644)
+}
+
+// removeSharedFile deletes the file at relative and the directories it
+// leaves empty, up to dir
+func removeSharedFile(dir string, relative string) error {
+	err := os.Remove(filepath.Join(dir, filepath.FromSlash(relative)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for folder := path.Dir(relative); folder != "."; folder = path.Dir(folder) {
+		if os.Remove(filepath.Join(dir, filepath.FromSlash(folder))) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// librarySync holds the state of one run of syncSharedLibrary
+type librarySync struct {
+	dir     string
+	tx      *sql.Tx
+	files   map[string]sharedFile
+	queries map[int]sharedQuery
+	folders map[int]string
+	linked  map[int]bool
+	taken   map[string]bool
+	refresh map[string]int
+	result  *SharedLibrarySyncResult
+}
+
+// syncSharedLibrary brings the library and the .sql files under dir up to
+// date with each other. Each file is linked to a query, and whichever side
+// changed since the last sync is copied to the other. Queries changed on
+// both sides are reported as conflicts and left alone
+func syncSharedLibrary(db *sql.DB, dir string) (SharedLibrarySyncResult, error) {
+	result := SharedLibrarySyncResult{Directory: dir, Conflicts: []SharedLibraryConflict{}}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return result, fmt.Errorf("the shared library directory is not available: %w", err)
+	}
+
+	if !info.IsDir() {
+		return result, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	s := librarySync{
+		dir:     dir,
+		linked:  make(map[int]bool),
+		taken:   make(map[string]bool),
+		refresh: make(map[string]int),
+		result:  &result,
+	}
+
+	s.files, err = loadSharedFiles(dir)
+	if err != nil {
+		return result, err
+	}
+
+	s.queries, err = loadSharedQueries(db)
+	if err != nil {
+		return result, err
+	}
+
+	s.folders, err = folderPaths(db)
+	if err != nil {
+		return result, err
+	}
+
+	mappings, err := loadSharedMappings(db)
+	if err != nil {
+		return result, err
+	}
+
+	s.tx, err = db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer s.tx.Rollback()
+
+	mapped := make(map[string]bool)
+
+	for relative := range s.files {
+		s.taken[strings.ToLower(relative)] = true
+	}
+
+	for _, mapping := range mappings {
+		mapped[mapping.path] = true
+		s.linked[mapping.queryID] = true
+		s.taken[strings.ToLower(mapping.path)] = true
+	}
+
+	unmapped := []string{}
+
+	for _, relative := range sortedKeys(s.files) {
+		if !mapped[relative] {
+			unmapped = append(unmapped, relative)
+		}
+	}
+
+	// A file moved or renamed outside the app keeps its query: a linked file
+	// that is gone is matched to a new file with the same contents, which is
+	// then loaded so the query follows it to its new folder
+	for i := range mappings {
+		mapping := &mappings[i]
+
+		if _, ok := s.files[mapping.path]; ok {
+			continue
+		}
+
+		for j, relative := range unmapped {
+			if s.files[relative].hash != mapping.fileHash {
+				continue
+			}
+
+			_, err = s.tx.Exec("UPDATE shared_library_files SET path = ?, file_hash = '' WHERE path = ?", relative, mapping.path)
+			if err != nil {
+				return result, err
+			}
+
+			mapping.path, mapping.fileHash = relative, ""
+			unmapped = append(unmapped[:j], unmapped[j+1:]...)
+
+			break
+		}
+	}
+
+	for _, mapping := range mappings {
+		err = s.syncMapping(mapping)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for _, relative := range unmapped {
+		err = s.loadNewFile(relative)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	ids := make([]int, 0, len(s.queries))
+	for id := range s.queries {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		query := s.queries[id]
+
+		if query.trashed || s.linked[id] {
+			continue
+		}
+
+		err = s.writeQuery("", query)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	err = s.tx.Commit()
+	if err != nil {
+		return result, err
+	}
+
+	// Loaded queries are hashed as they were saved, since tags and folders
+	// come back normalised
+	if len(s.refresh) > 0 {
+		queries, err := loadSharedQueries(db)
+		if err != nil {
+			return result, err
+		}
+
+		for relative, id := range s.refresh {
+			_, err = db.Exec("UPDATE shared_library_files SET query_hash = ? WHERE path = ?", queries[id].hash, relative)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (s *librarySync) syncMapping(mapping sharedMapping) error {
+	file, exists := s.files[mapping.path]
+	query, present := s.queries[mapping.queryID]
+	alive := present && !query.trashed
+
+	fileChanged := !exists || file.hash != mapping.fileHash
+	queryChanged := !alive || query.hash != mapping.queryHash
+
+	switch {
+	case !fileChanged && !queryChanged:
+		return nil
+	case !exists && !alive:
+		return forgetSharedFile(s.tx, mapping.path)
+	case !exists:
+		if queryChanged {
+			s.conflict(mapping.path, &query, ConflictDeletedInDirectory, "", "")
+			return nil
+		}
+
+		_, err := s.tx.Exec("UPDATE queries SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", query.id)
+		if err != nil {
+			return err
+		}
+
+		s.result.Trashed++
+
+		return forgetSharedFile(s.tx, mapping.path)
+	case !alive:
+		if fileChanged {
+			if present {
+				s.conflict(mapping.path, &query, ConflictDeletedInLibrary, file.content, "")
+			} else {
+				s.conflict(mapping.path, nil, ConflictDeletedInLibrary, file.content, "")
+			}
+
+			return nil
+		}
+
+		err := removeSharedFile(s.dir, mapping.path)
+		if err != nil {
+			return err
+		}
+
+		s.result.Removed++
+
+		return forgetSharedFile(s.tx, mapping.path)
+	case !queryChanged:
+		return s.loadFile(mapping.path, file, &query)
+	case !fileChanged:
+		return s.writeQuery(mapping.path, query)
+	case file.content == query.content && folderOfFile(mapping.path) == sqlFolderPath(query.entry.Folder):
+		// Both sides made the same edit
+		return rememberSharedFile(s.tx, mapping.path, query.id, file.hash, query.hash)
+	}
+
+	s.conflict(mapping.path, &query, ConflictBothEdited, file.content, "")
+
+	return nil
+}
+
+// loadNewFile saves a file that is not linked to a query yet. A query with
+// the same title that is not linked either was saved on both sides before
+// they were first synced, so it is linked instead of duplicated
+func (s *librarySync) loadNewFile(relative string) error {
+	file := s.files[relative]
+
+	entry, err := readSQLFile(relative, file.content)
+	if err != nil {
+		s.conflict(relative, nil, ConflictUnreadable, file.content, err.Error())
+		return nil
+	}
+
+	for _, id := range sortedKeys(s.queries) {
+		query := s.queries[id]
+
+		if query.trashed || s.linked[id] || !strings.EqualFold(query.entry.Title, entry.Title) {
+			continue
+		}
+
+		s.linked[id] = true
+
+		if query.content != file.content {
+			s.conflict(relative, &query, ConflictSameTitle, file.content, "")
+			return nil
+		}
+
+		return rememberSharedFile(s.tx, relative, id, file.hash, query.hash)
+	}
+
+	return s.loadFile(relative, file, nil)
+}
+
+// loadFile copies a file into its query, or into a new query when query is
+// nil. Files that cannot be parsed, such as ones left with git merge
+// markers, are reported instead
+func (s *librarySync) loadFile(relative string, file sharedFile, query *sharedQuery) error {
+	entry, err := readSQLFile(relative, file.content)
+	if err != nil {
+		s.conflict(relative, query, ConflictUnreadable, file.content, err.Error())
+		return nil
+	}
+
+	var id int
+
+	if query == nil {
+		entry.Folder = s.folderOf(entry.Folder, "")
+
+		result, err := s.tx.Exec("INSERT INTO queries (title, query, description, referenced_tables) VALUES (?, ?, ?, ?)",
+			entry.Title, entry.Query, entry.Description, referencedTablesColumn(entry.Query))
+		if err != nil {
+			return err
+		}
+
+		created, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		id = int(created)
+
+		err = storeQueryRevision(s.tx, id, "Loaded from the shared library")
+		if err != nil {
+			return err
+		}
+	} else {
+		id = query.id
+		entry.Folder = s.folderOf(entry.Folder, query.entry.Folder)
+
+		err = updateQueryInTransaction(s.tx, id, Query{Title: entry.Title, Query: entry.Query, Description: entry.Description}, "Loaded from the shared library")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = applyBundleMetadata(s.tx, id, entry)
+	if err != nil {
+		return err
+	}
+
+	s.linked[id] = true
+	s.refresh[relative] = id
+	s.result.Loaded++
+
+	return rememberSharedFile(s.tx, relative, id, file.hash, "")
+}
+
+// writeQuery writes a query to its file, moving the file when the query
+// changed folders. An empty relative picks a new file name
+func (s *librarySync) writeQuery(relative string, query sharedQuery) error {
+	folder := sqlFolderPath(query.entry.Folder)
+	target := relative
+
+	if target == "" || folderOfFile(target) != folder {
+		name := sqlFileName(query.entry.Title)
+		if relative != "" {
+			name = strings.TrimSuffix(path.Base(relative), path.Ext(relative))
+		}
+
+		base := path.Join(folder, name)
+		target = base + ".sql"
+
+		for i := 2; s.taken[strings.ToLower(target)]; i++ {
+			target = fmt.Sprintf("%s-%d.sql", base, i)
+		}
+
+		s.taken[strings.ToLower(target)] = true
+	}
+
+	err := writeSharedFile(s.dir, target, query.content)
+	if err != nil {
+		return err
+	}
+
+	if relative != "" && target != relative {
+		err = removeSharedFile(s.dir, relative)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.linked[query.id] = true
+	s.result.Written++
+
+	return rememberSharedFile(s.tx, target, query.id, contentHash(query.content), query.hash)
+}
+
+// folderOf maps the directory of a file back to a library folder. Folder
+// names are sanitised on the way out, so the current folder of the query,
+// then any folder that is written to the same directory, is preferred
+func (s *librarySync) folderOf(directory string, current string) string {
+	if sqlFolderPath(current) == directory {
+		return current
+	}
+
+	for _, id := range sortedKeys(s.folders) {
+		if sqlFolderPath(s.folders[id]) == directory {
+			return s.folders[id]
+		}
+	}
+
+	return directory
+}
+
+func (s *librarySync) conflict(relative string, query *sharedQuery, reason string, file string, message string) {
+	conflict := SharedLibraryConflict{Path: relative, Reason: reason, Message: message, File: file}
+
+	if query != nil {
+		id := query.id
+		conflict.QueryID = &id
+		conflict.Title = query.entry.Title
+
+		if !query.trashed {
+			conflict.Library = query.content
+		}
+	}
+
+	s.result.Conflicts = append(s.result.Conflicts, conflict)
+}
+
+func folderOfFile(relative string) string {
+	if folder := path.Dir(relative); folder != "." {
+		return folder
+	}
+
+	return ""
+}
+
+func sortedKeys[K string | int, V any](values map[K]V) []K {
+	keys := make([]K, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	return keys
+}
+
+// resolveSharedConflict settles a conflict reported by syncSharedLibrary by
+// keeping one side. Keeping the library overwrites or removes the file right
+// away; keeping the directory marks the query as out of date so that the
+// next sync loads the file into it
+func resolveSharedConflict(db *sql.DB, dir string, conflict SharedLibraryConflict, keep string) error {
+	if keep != KeepLibrary && keep != KeepDirectory {
+		return fmt.Errorf("unknown side %q", keep)
+	}
+
+	relative := path.Clean(filepath.ToSlash(conflict.Path))
+	if relative == "." || path.IsAbs(relative) || strings.HasPrefix(relative, "../") {
+		return fmt.Errorf("invalid path %q", conflict.Path)
+	}
+
+	_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(relative)))
+	exists := err == nil
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if conflict.QueryID == nil {
+		if keep == KeepLibrary || exists {
+			return fmt.Errorf("%s is not linked to a saved query: fix or delete it in the directory", relative)
+		}
+
+		return forgetSharedFile(db, relative)
+	}
+
+	queries, err := loadSharedQueries(db)
+	if err != nil {
+		return err
+	}
+
+	query, present := queries[*conflict.QueryID]
+	alive := present && !query.trashed
+
+	if keep == KeepLibrary {
+		if !alive {
+			err = removeSharedFile(dir, relative)
+			if err != nil {
+				return err
+			}
+
+			return forgetSharedFile(db, relative)
+		}
+
+		err = writeSharedFile(dir, relative, query.content)
+		if err != nil {
+			return err
+		}
+
+		return rememberSharedFile(db, relative, query.id, contentHash(query.content), query.hash)
+	}
+
+	if !exists {
+		if alive {
+			_, err = db.Exec("UPDATE queries SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", query.id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return forgetSharedFile(db, relative)
+	}
+
+	if !present {
+		// The query is gone for good, so the file comes back as a new one
+		return forgetSharedFile(db, relative)
+	}
+
+	if query.trashed {
+		_, err = db.Exec("UPDATE queries SET deleted_at = NULL WHERE id = ?", query.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rememberSharedFile(db, relative, query.id, "", query.hash)
+}
+
+// runGit runs the git command line inside dir and returns its output
+func runGit(dir string, args ...string) (string, error) {
+	output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	text := strings.TrimRight(string(output), "\n")
+
+	if err != nil {
+		message := strings.TrimSpace(text)
+		if message == "" {
+			message = err.Error()
+		}
+
+		return text, fmt.Errorf("git %s: %s", args[0], message)
+	}
+
+	return text, nil
+}
+
+func sharedLibraryStatus(dir string) (SharedLibraryStatus, error) {
+	status := SharedLibraryStatus{Directory: dir, Changes: []string{}}
+
+	if dir == "" {
+		return status, nil
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return status, nil
+	}
+
+	inside, err := runGit(dir, "rev-parse", "--is-inside-work-tree")
+	if err != nil || inside != "true" {
+		return status, nil
+	}
+
+	status.Git = true
+
+	// symbolic-ref also names the branch of a repository without commits
+	status.Branch, _ = runGit(dir, "symbolic-ref", "--short", "-q", "HEAD")
+
+	changes, err := runGit(dir, "status", "--porcelain", "--", ".")
+	if err != nil {
+		return status, err
+	}
+
+	if changes != "" {
+		status.Changes = strings.Split(changes, "\n")
+	}
+
+	return status, nil
+}
+
+// commitSharedLibrary commits every change under dir with message
+func commitSharedLibrary(dir string, message string) error {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return fmt.Errorf("a commit message is required")
+	}
+
+	status, err := sharedLibraryStatus(dir)
+	if err != nil {
+		return err
+	}
+
+	if !status.Git {
+		return fmt.Errorf("%s is not inside a git working copy", dir)
+	}
+
+	if len(status.Changes) == 0 {
+		return fmt.Errorf("there are no changes to commit")
+	}
+
+	_, err = runGit(dir, "add", "--all", "--", ".")
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(dir, "commit", "-m", message, "--", ".")
+
+	return err
+}
+
+// setSharedLibraryDirectory links the library to dir, or unlinks it when dir
+// is empty. Links between files and queries only hold for one directory
+func setSharedLibraryDirectory(db *sql.DB, dir string) error {
+	if dir != "" {
+		absolute, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+
+		info, err := os.Stat(absolute)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", absolute)
+		}
+
+		dir = absolute
+	}
+
+	current, err := getSetting(db, settingSharedLibraryDirectory, "")
+	if err != nil {
+		return err
+	}
+
+	if current != dir {
+		_, err = db.Exec("DELETE FROM shared_library_files")
+		if err != nil {
+			return err
+		}
+	}
+
+	return setSetting(db, settingSharedLibraryDirectory, dir)
+}
+
+// syncConfiguredSharedLibrary syncs the directory set for the open library.
+// The result has no Directory when none is set
+func syncConfiguredSharedLibrary() (SharedLibrarySyncResult, error) {
+	sharedLibraryLock.Lock()
+	defer sharedLibraryLock.Unlock()
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	dir, err := getSetting(db, settingSharedLibraryDirectory, "")
+	if err != nil || dir == "" {
+		return SharedLibrarySyncResult{Conflicts: []SharedLibraryConflict{}}, err
+	}
+
+	return syncSharedLibrary(db, dir)
+}
+
+func sharedLibraryDirectory() (string, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	dir, err := getSetting(db, settingSharedLibraryDirectory, "")
+	if err == nil && dir == "" {
+		err = fmt.Errorf("no shared library directory is set")
+	}
+
+	return dir, err
+}
+
+// sharedLibraryWatcher syncs the shared library in the background whenever
+// the .sql files under its directory or the library database change
+type sharedLibraryWatcher struct {
+	mu          sync.Mutex
+	interval    time.Duration
+	stop        chan struct{}
+	notify      func(SharedLibrarySyncResult)
+	directory   string
+	fingerprint string
+}
+
+func newSharedLibraryWatcher(interval time.Duration) *sharedLibraryWatcher {
+	return &sharedLibraryWatcher{interval: interval}
+}
+
+// Start launches the watcher. notify receives the result of every sync that
+// changed something or found conflicts
+func (w *sharedLibraryWatcher) Start(notify func(SharedLibrarySyncResult)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stop != nil {
+		return
+	}
+
+	w.notify = notify
+	w.stop = make(chan struct{})
+
+	go w.loop(w.stop)
+}
+
+// Close stops the watcher
+func (w *sharedLibraryWatcher) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+func (w *sharedLibraryWatcher) loop(stop chan struct{}) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check syncs when anything changed since the last check. Syncing is
+// skipped otherwise, so an idle library costs a few stat calls per tick
+func (w *sharedLibraryWatcher) check() {
+	if sharedLibraryFingerprint(storage.Path(), w.directory) == w.fingerprint {
+		return
+	}
+
+	result, err := syncConfiguredSharedLibrary()
+	if err != nil {
+		log.Printf("could not sync the shared library: %v", err)
+	}
+
+	w.directory = result.Directory
+	w.fingerprint = sharedLibraryFingerprint(storage.Path(), w.directory)
+
+	if err == nil && result.changed() && w.notify != nil {
+		w.notify(result)
+	}
+}
+
+// sharedLibraryFingerprint changes whenever the database file or a .sql
+// file under dir is written, added or removed
+func sharedLibraryFingerprint(database string, dir string) string {
+	var fingerprint strings.Builder
+
+	stat := func(name string) {
+		info, err := os.Stat(name)
+		if err != nil {
+			fmt.Fprintf(&fingerprint, "%s missing\n", name)
+			return
+		}
+
+		fmt.Fprintf(&fingerprint, "%s %d %d\n", name, info.Size(), info.ModTime().UnixNano())
+	}
+
+	stat(database)
+
+	if dir != "" {
+		files, err := listSQLFiles(dir)
+		if err != nil {
+			fmt.Fprintf(&fingerprint, "%s %v\n", dir, err)
+		}
+
+		for _, relative := range files {
+			stat(filepath.Join(dir, filepath.FromSlash(relative)))
+		}
+	}
+
+	return fingerprint.String()
+}
+
+// GetSharedLibraryStatus returns the shared directory of the library, with
+// its git branch and uncommitted changes when it is a git working copy
+func (a *App) GetSharedLibraryStatus() (SharedLibraryStatus, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	dir, err := getSetting(db, settingSharedLibraryDirectory, "")
+	if err != nil {
+		return SharedLibraryStatus{Changes: []string{}}, err
+	}
+
+	return sharedLibraryStatus(dir)
+}
+
+// ChooseSharedLibraryDirectory asks for a directory to keep the library in
+// sync with, one .sql file per query, and syncs it right away
+func (a *App) ChooseSharedLibraryDirectory() (SharedLibrarySyncResult, error) {
+	selection, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:                "Select the shared library directory",
+		CanCreateDirectories: true,
+	})
+	if err != nil {
+		return SharedLibrarySyncResult{}, err
+	}
+
+	if selection == "" {
+		return SharedLibrarySyncResult{}, fmt.Errorf("no directory selected")
+	}
+
+	sharedLibraryLock.Lock()
+	defer sharedLibraryLock.Unlock()
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	err = setSharedLibraryDirectory(db, selection)
+	if err != nil {
+		return SharedLibrarySyncResult{}, err
+	}
+
+	dir, err := getSetting(db, settingSharedLibraryDirectory, "")
+	if err != nil {
+		return SharedLibrarySyncResult{}, err
+	}
+
+	return syncSharedLibrary(db, dir)
+}
+
+// DisconnectSharedLibrary stops syncing the library. The files are kept
+func (a *App) DisconnectSharedLibrary() error {
+	sharedLibraryLock.Lock()
+	defer sharedLibraryLock.Unlock()
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return setSharedLibraryDirectory(db, "")
+}
+
+// SyncSharedLibrary syncs the library with its shared directory now
+func (a *App) SyncSharedLibrary() (SharedLibrarySyncResult, error) {
+	result, err := syncConfiguredSharedLibrary()
+	if err == nil && result.Directory == "" {
+		err = fmt.Errorf("no shared library directory is set")
+	}
+
+	return result, err
+}
+
+// ResolveSharedLibraryConflict keeps the library or the directory version of
+// a conflict, as named by keep, and syncs again
+func (a *App) ResolveSharedLibraryConflict(conflict SharedLibraryConflict, keep string) (SharedLibrarySyncResult, error) {
+	dir, err := sharedLibraryDirectory()
+	if err != nil {
+		return SharedLibrarySyncResult{}, err
+	}
+
+	sharedLibraryLock.Lock()
+
+	db := openSqliteConnection()
+	err = resolveSharedConflict(db, dir, conflict, keep)
+	db.Close()
+
+	sharedLibraryLock.Unlock()
+
+	if err != nil {
+		return SharedLibrarySyncResult{}, err
+	}
+
+	return syncConfiguredSharedLibrary()
+}
+
+// CommitSharedLibrary syncs the library and commits the shared directory
+// with git
+func (a *App) CommitSharedLibrary(message string) (SharedLibraryStatus, error) {
+	result, err := a.SyncSharedLibrary()
+	if err != nil {
+		return SharedLibraryStatus{Changes: []string{}}, err
+	}
+
+	err = commitSharedLibrary(result.Directory, message)
+	if err != nil {
+		return SharedLibraryStatus{Changes: []string{}}, err
+	}
+
+	return sharedLibraryStatus(result.Directory)
+}
+
+// PullSharedLibrary fast-forwards the shared directory with git pull and
+// loads what changed. Diverged histories have to be merged with git first
+func (a *App) PullSharedLibrary() (SharedLibrarySyncResult, error) {
+	dir, err := sharedLibraryDirectory()
+	if err != nil {
+		return SharedLibrarySyncResult{}, err
+	}
+
+	_, err = runGit(dir, "pull", "--ff-only")
+	if err != nil {
+		return SharedLibrarySyncResult{}, err
+	}
+
+	return a.SyncSharedLibrary()
+}
+
+// PushSharedLibrary pushes the commits of the shared directory with git push
+func (a *App) PushSharedLibrary() error {
+	dir, err := sharedLibraryDirectory()
+	if err != nil {
+		return err
+	}
+
+	_, err = runGit(dir, "push")
+
+	return err
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// syncShared syncs and fails the test on errors or unexpected conflicts
+func syncShared(t *testing.T, db *sql.DB, dir string) SharedLibrarySyncResult {
+	t.Helper()
+
+	result, err := syncSharedLibrary(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func savedQueryText(t *testing.T, db *sql.DB, id int) string {
+	t.Helper()
+
+	var query string
+
+	if err := db.QueryRow("SELECT query FROM queries WHERE id = ?", id).Scan(&query); err != nil {
+		t.Fatal(err)
+	}
+
+	return query
+}
+
+func readSharedFile(t *testing.T, dir string, relative string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(relative)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestSyncSharedLibrary(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+	seedBundleLibrary(t, app)
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	dir := t.TempDir()
+
+	if err := setSharedLibraryDirectory(db, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	result := syncShared(t, db, dir)
+	if result.Written != 2 || len(result.Conflicts) != 0 {
+		t.Fatalf("expected both queries to be written, got %+v", result)
+	}
+
+	monthly := "Reports/Monthly_ Sales/sales-by-month.sql"
+	if !strings.Contains(readSharedFile(t, dir, monthly), "GROUP BY month") {
+		t.Fatalf("expected %s to hold the query", monthly)
+	}
+
+	if result = syncShared(t, db, dir); result.changed() {
+		t.Errorf("expected a second sync to do nothing, got %+v", result)
+	}
+
+	// An edit made in the directory is loaded into the query
+	edited := strings.Replace(readSharedFile(t, dir, monthly), "GROUP BY month", "GROUP BY month\nORDER BY month", 1)
+	os.WriteFile(filepath.Join(dir, filepath.FromSlash(monthly)), []byte(edited), 0o644)
+
+	if result = syncShared(t, db, dir); result.Loaded != 1 {
+		t.Fatalf("expected the edited file to be loaded, got %+v", result)
+	}
+
+	if !strings.HasSuffix(savedQueryText(t, db, 2), "ORDER BY month") {
+		t.Fatalf("expected the query to be updated, got %q", savedQueryText(t, db, 2))
+	}
+
+	queries, _ := listQueries(db, false, QueryFilter{Tags: []string{"monthly"}})
+	if queryTitles(queries) != "Sales by month" || queries[0].FolderID == nil {
+		t.Fatalf("expected the query to keep its folder and tags, got %+v", queries)
+	}
+
+	if result = syncShared(t, db, dir); result.changed() {
+		t.Errorf("expected nothing left to sync after loading, got %+v", result)
+	}
+
+	// An edit made in the app is written to the file
+	if err := updateQuery(db, 1, Query{Query: "INSERT INTO people (name) VALUES ({{ name }});"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if result = syncShared(t, db, dir); result.Written != 1 || !strings.Contains(readSharedFile(t, dir, "insert-users.sql"), "INTO people") {
+		t.Fatalf("expected the edited query to be written, got %+v", result)
+	}
+
+	// Editing both sides is a conflict that leaves both alone until resolved
+	updateQuery(db, 1, Query{Query: "INSERT INTO staff (name) VALUES ({{ name }});"}, "")
+	os.WriteFile(filepath.Join(dir, "insert-users.sql"), []byte("-- ---\n-- title: Insert users\n-- ---\nINSERT INTO guests (name) VALUES ({{ name }});\n"), 0o644)
+
+	result = syncShared(t, db, dir)
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Reason != ConflictBothEdited || !strings.Contains(result.Conflicts[0].Library, "staff") {
+		t.Fatalf("expected a conflict, got %+v", result)
+	}
+
+	if err := resolveSharedConflict(db, dir, result.Conflicts[0], KeepDirectory); err != nil {
+		t.Fatal(err)
+	}
+
+	if result = syncShared(t, db, dir); result.Loaded != 1 || len(result.Conflicts) != 0 {
+		t.Fatalf("expected the file to be kept, got %+v", result)
+	}
+
+	if !strings.Contains(savedQueryText(t, db, 1), "guests") {
+		t.Errorf("expected the query to come from the file, got %q", savedQueryText(t, db, 1))
+	}
+
+	if queries, _ = listQueries(db, false, QueryFilter{Tags: []string{"users"}}); len(queries) != 0 {
+		t.Errorf("expected the tags to come from the file too, got %+v", queries)
+	}
+
+	// New files become queries, deleted files send their query to the trash
+	os.MkdirAll(filepath.Join(dir, "Shared"), 0o755)
+	os.WriteFile(filepath.Join(dir, "Shared", "count-orders.sql"), []byte("SELECT COUNT(*) FROM orders;\n"), 0o644)
+	os.Remove(filepath.Join(dir, filepath.FromSlash(monthly)))
+
+	result = syncShared(t, db, dir)
+	if result.Loaded != 1 || result.Trashed != 1 {
+		t.Fatalf("expected one loaded and one trashed query, got %+v", result)
+	}
+
+	active, _ := listQueries(db, false, QueryFilter{})
+	if queryTitles(active) != "Insert users,count-orders" {
+		t.Errorf("unexpected queries %s", queryTitles(active))
+	}
+
+	// Deleting a query in the app removes its file
+	if err := app.DeleteQuery(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if result = syncShared(t, db, dir); result.Removed != 1 {
+		t.Fatalf("expected the file to be removed, got %+v", result)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "insert-users.sql")); !os.IsNotExist(err) {
+		t.Errorf("expected insert-users.sql to be gone, got %v", err)
+	}
+}
+
+func TestSyncSharedLibraryFollowsMovedFiles(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+	seedBundleLibrary(t, app)
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	dir := t.TempDir()
+	syncShared(t, db, dir)
+
+	os.MkdirAll(filepath.Join(dir, "Archive"), 0o755)
+	os.Rename(filepath.Join(dir, "insert-users.sql"), filepath.Join(dir, "Archive", "users.sql"))
+
+	result := syncShared(t, db, dir)
+	if result.Loaded != 1 || result.Trashed != 0 {
+		t.Fatalf("expected the moved file to keep its query, got %+v", result)
+	}
+
+	queries, _ := listQueries(db, false, QueryFilter{Search: "Insert users"})
+	paths, _ := folderPaths(db)
+
+	if len(queries) != 1 || queries[0].FolderID == nil || paths[*queries[0].FolderID] != "Archive" {
+		t.Fatalf("expected the query to move to Archive, got %+v", queries)
+	}
+
+	// Moving it back in the app moves the file too
+	if err := app.MoveQueryToFolder(*queries[0].ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if result = syncShared(t, db, dir); result.Written != 1 {
+		t.Fatalf("expected the file to be moved, got %+v", result)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "users.sql")); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "Archive")); !os.IsNotExist(err) {
+		t.Errorf("expected the empty directory to be removed, got %v", err)
+	}
+}
+
+func TestSyncSharedLibraryLinksExistingQueries(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+	seedBundleLibrary(t, app)
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	// A directory exported earlier is linked rather than duplicated
+	bundle, err := buildQueryBundle(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	if _, err := writeSQLFolder(dir, bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "insert-users.sql"), []byte("-- ---\n-- title: Insert users\n-- ---\nSELECT 1;\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "broken.sql"), []byte("<<<<<<< HEAD\nSELECT 1;\n=======\nSELECT 2;\n>>>>>>> main\n"), 0o644)
+
+	result := syncShared(t, db, dir)
+	if result.Loaded != 0 || result.Written != 0 || len(result.Conflicts) != 2 {
+		t.Fatalf("expected only conflicts, got %+v", result)
+	}
+
+	for _, conflict := range result.Conflicts {
+		expected := ConflictUnreadable
+		if conflict.Path == "insert-users.sql" {
+			expected = ConflictSameTitle
+		}
+
+		if conflict.Reason != expected {
+			t.Errorf("expected %s to be %s, got %+v", conflict.Path, expected, conflict)
+		}
+
+		if conflict.Reason == ConflictSameTitle {
+			if err := resolveSharedConflict(db, dir, conflict, KeepLibrary); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := resolveSharedConflict(db, dir, conflict, KeepLibrary); err == nil {
+			t.Error("expected an unlinked unreadable file to need fixing by hand")
+		}
+	}
+
+	if !strings.Contains(readSharedFile(t, dir, "insert-users.sql"), "INSERT INTO users") {
+		t.Error("expected the library version to be written")
+	}
+
+	os.Remove(filepath.Join(dir, "broken.sql"))
+
+	if result = syncShared(t, db, dir); result.changed() {
+		t.Errorf("expected everything to be in sync, got %+v", result)
+	}
+
+	active, _ := listQueries(db, false, QueryFilter{})
+	if len(active) != 2 {
+		t.Errorf("expected no duplicates, got %s", queryTitles(active))
+	}
+}
+
+func TestSharedLibraryGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	useTemporaryLibrary(t)
+	app := NewApp()
+	seedBundleLibrary(t, app)
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	dir := t.TempDir()
+
+	if status, err := sharedLibraryStatus(dir); err != nil || status.Git {
+		t.Fatalf("expected a plain directory, got %+v (%v)", status, err)
+	}
+
+	if _, err := runGit(dir, "init", "-q", "-b", "main"); err != nil {
+		t.Fatal(err)
+	}
+
+	syncShared(t, db, dir)
+
+	status, err := sharedLibraryStatus(dir)
+	if err != nil || !status.Git || status.Branch != "main" || len(status.Changes) != 2 {
+		t.Fatalf("expected two new files on main, got %+v (%v)", status, err)
+	}
+
+	if err := commitSharedLibrary(dir, "Add queries"); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ = sharedLibraryStatus(dir); len(status.Changes) != 0 {
+		t.Errorf("expected a clean working copy, got %v", status.Changes)
+	}
+
+	if err := commitSharedLibrary(dir, "Nothing"); err == nil {
+		t.Error("expected an empty commit to be refused")
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sql_script_maker/schema"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// snapshotRetention is how many unlabeled snapshots are kept per database.
+// Labeled snapshots are never pruned automatically
+const snapshotRetention = 20
+
+// DatabaseStructureSnapshot describes a stored schema snapshot without its content
+type DatabaseStructureSnapshot struct {
+	ID           int
+	ConnectionID *int
+	Source       string
+	Label        string
+	ContentHash  string
+	TableCount   int
+	CreatedAt    string
+}
+
+// structureSource identifies the database a snapshot was taken from. The
+// saved profile can be re-pointed at another database, so the ID alone is
+// not enough to tell snapshots apart
+func structureSource(input DatabaseConnection) string {
+	return fmt.Sprintf("%s:%d/%s", input.Host, input.Port, input.Database)
+}
+
+// structureHash identifies the content of a structure for dedupe. Row
+// estimates change on almost every scan, so they are left out
+func structureHash(structure schema.Structure) (string, error) {
+	tables := make([]schema.Table, len(structure.Tables))
+
+	for i, table := range structure.Tables {
+		table.EstimatedRows = 0
+		tables[i] = table
+	}
+
+	structure.Tables = tables
+
+	content, err := json.Marshal(structure)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// storeDatabaseStructure saves a structure under the connection and source it
+// came from and returns its JSON. When the latest snapshot of the same source
+// has identical content no new row is written
+func storeDatabaseStructure(connectionID *int, source string, structure schema.Structure) (string, error) {
+	structureJSON, err := json.Marshal(structure)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := structureHash(structure)
+	if err != nil {
+		return "", err
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	var latestHash string
+	err = db.QueryRow(`
+		SELECT content_hash FROM database_structure
+		WHERE connection_id IS ? AND source = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, connectionID, source).Scan(&latestHash)
+
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	if latestHash == hash {
+		return string(structureJSON), nil
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO database_structure (structure, connection_id, source, content_hash, table_count)
+		VALUES (?, ?, ?, ?, ?)
+	`, string(structureJSON), connectionID, source, hash, len(structure.Tables))
+	if err != nil {
+		return "", err
+	}
+
+	_, err = pruneDatabaseStructures(db, connectionID, source, snapshotRetention)
+	if err != nil {
+		return "", err
+	}
+
+	return string(structureJSON), nil
+}
+
+// pruneDatabaseStructures deletes all but the newest keep unlabeled snapshots
+// of a database and returns how many were removed
+func pruneDatabaseStructures(db *sql.DB, connectionID *int, source string, keep int) (int, error) {
+	result, err := db.Exec(`
+		DELETE FROM database_structure
+		WHERE connection_id IS ? AND source = ? AND label = ''
+		AND id NOT IN (
+			SELECT id FROM database_structure
+			WHERE connection_id IS ? AND source = ? AND label = ''
+			ORDER BY created_at DESC, id DESC
+			LIMIT ?
+		)
+	`, connectionID, source, connectionID, source, keep)
+	if err != nil {
+		return 0, err
+	}
+
+	removed, err := result.RowsAffected()
+
+	return int(removed), err
+}
+
+// loadDatabaseStructure reads a stored schema snapshot by ID
+func loadDatabaseStructure(db *sql.DB, id int) (schema.Structure, error) {
+	var structureJSON string
+
+	err := db.QueryRow("SELECT structure FROM database_structure WHERE id = ?", id).Scan(&structureJSON)
+
+	if err == sql.ErrNoRows {
+		return schema.Structure{}, fmt.Errorf("database structure %d not found", id)
+	}
+
+	if err != nil {
+		return schema.Structure{}, err
+	}
+
+	var structure schema.Structure
+
+	err = json.Unmarshal([]byte(structureJSON), &structure)
+
+	if err != nil {
+		return schema.Structure{}, fmt.Errorf("database structure %d is not valid: %w", id, err)
+	}
+
+	return structure, nil
+}
+
+func compareDatabaseStructures(fromID int, toID int) (schema.Diff, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	from, err := loadDatabaseStructure(db, fromID)
+	if err != nil {
+		return schema.Diff{}, err
+	}
+
+	to, err := loadDatabaseStructure(db, toID)
+	if err != nil {
+		return schema.Diff{}, err
+	}
+
+	return schema.Compare(from, to), nil
+}
+
+// DiffDatabaseStructures reports the tables, columns, indexes and foreign
+// keys added, dropped or altered between two stored snapshots
+func (a *App) DiffDatabaseStructures(fromID int, toID int) (schema.Diff, error) {
+	return compareDatabaseStructures(fromID, toID)
+}
+
+// GetMigrationSQL returns the DDL that turns snapshot fromID into snapshot toID
+func (a *App) GetMigrationSQL(fromID int, toID int) (string, error) {
+	diff, err := compareDatabaseStructures(fromID, toID)
+	if err != nil {
+		return "", err
+	}
+
+	return diff.MigrationSQL(), nil
+}
+
+// ImportDatabaseStructureFile reads the CREATE statements of a DDL script or
+// a mysqldump --no-data file and stores them as a snapshot that is not tied
+// to any connection, so a schema can be used without database access
+func (a *App) ImportDatabaseStructureFile() (string, error) {
+	selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select File",
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "SQL (*.sql)",
+				Pattern:     "*.sql",
+			},
+		},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	if selection == "" {
+		return "", fmt.Errorf("no file selected")
+	}
+
+	return importDatabaseStructureFile(selection)
+}
+
+// importDatabaseStructureFile parses the DDL script at path and stores it as
+// a snapshot whose source is the file name
+func importDatabaseStructureFile(path string) (string, error) {
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	structure, err := schema.ParseDDL(string(script))
+	if err != nil {
+		return "", err
+	}
+
+	return storeDatabaseStructure(nil, "file:"+filepath.Base(path), structure)
+}
+
+// GenerateDDLFromStructure renders the DDL that recreates snapshot id as an
+// empty schema in the given dialect (mysql, postgres or sqlite)
+func (a *App) GenerateDDLFromStructure(id int, dialect string) (string, error) {
+	target, err := schema.ParseDialect(dialect)
+	if err != nil {
+		return "", err
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	structure, err := loadDatabaseStructure(db, id)
+	if err != nil {
+		return "", err
+	}
+
+	return schema.GenerateDDL(structure, target)
+}
+
+// ExportDatabaseDiagram renders snapshot id as a Mermaid, DOT, PlantUML or
+// DBML diagram, optionally narrowed to some tables or around a focus table
+func (a *App) ExportDatabaseDiagram(id int, format string, options schema.DiagramOptions) (string, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	structure, err := loadDatabaseStructure(db, id)
+	if err != nil {
+		return "", err
+	}
+
+	return schema.ExportDiagram(structure, format, options)
+}
+
+// ListDatabaseStructures lists stored snapshots, newest first. A connectionID
+// of 0 lists the snapshots of every connection
+func (a *App) ListDatabaseStructures(connectionID int) ([]DatabaseStructureSnapshot, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	query := `SELECT id, connection_id, source, label, content_hash, table_count, created_at FROM database_structure`
+	args := []interface{}{}
+
+	if connectionID != 0 {
+		query += ` WHERE connection_id = ?`
+		args = append(args, connectionID)
+	}
+
+	rows, err := db.Query(query+` ORDER BY created_at DESC, id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make([]DatabaseStructureSnapshot, 0)
+
+	for rows.Next() {
+		var snapshot DatabaseStructureSnapshot
+
+		err = rows.Scan(&snapshot.ID, &snapshot.ConnectionID, &snapshot.Source, &snapshot.Label, &snapshot.ContentHash, &snapshot.TableCount, &snapshot.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// GetDatabaseStructureByID returns the JSON of a stored snapshot
+func (a *App) GetDatabaseStructureByID(id int) (string, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	var structure string
+
+	err := db.QueryRow("SELECT structure FROM database_structure WHERE id = ?", id).Scan(&structure)
+
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("database structure %d not found", id)
+	}
+
+	return structure, err
+}
+
+// LabelDatabaseStructure names a snapshot, which also exempts it from pruning.
+// An empty label removes the name again
+func (a *App) LabelDatabaseStructure(id int, label string) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE database_structure SET label = ? WHERE id = ?", label, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, fmt.Sprintf("database structure %d not found", id))
+}
+
+// DeleteDatabaseStructure removes a stored snapshot
+func (a *App) DeleteDatabaseStructure(id int) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	result, err := db.Exec("DELETE FROM database_structure WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, fmt.Sprintf("database structure %d not found", id))
+}
+
+// PruneDatabaseStructures keeps only the newest keep unlabeled snapshots of
+// the database the connection points at and returns how many were removed
+func (a *App) PruneDatabaseStructures(input DatabaseConnection, keep int) (int, error) {
+	if keep < 0 {
+		return 0, fmt.Errorf("cannot keep a negative number of snapshots")
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return pruneDatabaseStructures(db, input.ID, structureSource(input), keep)
+}
+
+// expectAffected turns an update that matched no rows into an error
+func expectAffected(result sql.Result, message string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%s", message)
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sql_script_maker/schema"
+)
+
+func snapshotFixture(tables int, estimatedRows int) schema.Structure {
+	structure := schema.Structure{DBType: "mysql"}
+
+	for i := 0; i < tables; i++ {
+		structure.Tables = append(structure.Tables, schema.Table{
+			Name:          fmt.Sprintf("table_%d", i),
+			Type:          schema.TableTypeBase,
+			EstimatedRows: estimatedRows,
+			Columns:       []schema.Column{{Name: "id", Type: "int(11)", Nullable: "NO", IsPrimary: true}},
+		})
+	}
+
+	return structure
+}
+
+func snapshotIDs(t *testing.T, app *App) []int {
+	t.Helper()
+
+	snapshots, err := app.ListDatabaseStructures(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []int{}
+	for _, snapshot := range snapshots {
+		ids = append(ids, snapshot.ID)
+	}
+
+	return ids
+}
+
+func TestStoreDatabaseStructureDedupe(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+	connectionID := 1
+
+	if _, err := storeDatabaseStructure(&connectionID, "db:3306/shop", snapshotFixture(2, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the row estimates changed
+	stored, err := storeDatabaseStructure(&connectionID, "db:3306/shop", snapshotFixture(2, 99))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var structure schema.Structure
+	if err := json.Unmarshal([]byte(stored), &structure); err != nil || structure.Tables[0].EstimatedRows != 99 {
+		t.Errorf("expected the fresh structure to be returned, got %s (%v)", stored, err)
+	}
+
+	if ids := snapshotIDs(t, app); len(ids) != 1 {
+		t.Fatalf("expected a changed row estimate not to store a snapshot, got %v", ids)
+	}
+
+	// Another source and a changed structure are both stored
+	if _, err := storeDatabaseStructure(&connectionID, "db:3306/staging", snapshotFixture(2, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storeDatabaseStructure(&connectionID, "db:3306/shop", snapshotFixture(3, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := app.ListDatabaseStructures(connectionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshots) != 3 || snapshots[0].TableCount != 3 || snapshots[0].ContentHash == snapshots[2].ContentHash {
+		t.Errorf("unexpected snapshots %+v", snapshots)
+	}
+}
+
+func TestPruneAndLabelDatabaseStructures(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+	connection := DatabaseConnection{Host: "db", Port: 3306, Database: "shop"}
+
+	for tables := 1; tables <= 4; tables++ {
+		if _, err := storeDatabaseStructure(connection.ID, structureSource(connection), snapshotFixture(tables, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := snapshotIDs(t, app)
+	if len(ids) != 4 {
+		t.Fatalf("expected 4 snapshots, got %v", ids)
+	}
+
+	oldest, newest := ids[3], ids[0]
+
+	if err := app.LabelDatabaseStructure(oldest, "before release"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.LabelDatabaseStructure(999, "missing"); err == nil {
+		t.Error("expected labeling a missing snapshot to fail")
+	}
+
+	if _, err := app.PruneDatabaseStructures(connection, -1); err == nil {
+		t.Error("expected a negative keep to be rejected")
+	}
+
+	removed, err := app.PruneDatabaseStructures(connection, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 2 {
+		t.Errorf("expected 2 snapshots to be pruned, got %d", removed)
+	}
+
+	if ids := snapshotIDs(t, app); !reflect.DeepEqual(ids, []int{newest, oldest}) {
+		t.Errorf("expected the newest and the labeled snapshot to be kept, got %v", ids)
+	}
+
+	// Removing the label makes the snapshot prunable again
+	if err := app.LabelDatabaseStructure(oldest, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, err := app.PruneDatabaseStructures(connection, 1); err != nil || removed != 1 {
+		t.Errorf("expected the unlabeled snapshot to be pruned, got %d (%v)", removed, err)
+	}
+}
+
+func TestGetLatestDatabaseStructureUsesLegacySnapshots(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	legacy := `{"dbType":"mysql","tables":[]}`
+	if _, err := db.Exec("INSERT INTO database_structure (structure) VALUES (?)", legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := app.GetLatestDatabaseStructure()
+	if err != nil || latest != legacy {
+		t.Fatalf("expected the unscoped snapshot, got %q (%v)", latest, err)
+	}
+
+	connection, err := app.GetDatabaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scoped, err := storeDatabaseStructure(connection.ID, structureSource(connection), snapshotFixture(1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest, err := app.GetLatestDatabaseStructure(); err != nil || latest != scoped {
+		t.Errorf("expected the scoped snapshot to win, got %q (%v)", latest, err)
+	}
+}
+
+func TestGetLatestDatabaseStructureFallsBackToImportedFile(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+
+	dump := "-- MySQL dump 10.13  Distrib 8.0.36, for Linux (x86_64)\n" +
+		"/*!40101 SET NAMES utf8mb4 */;\n" +
+		"DROP TABLE IF EXISTS `customers`;\n" +
+		"CREATE TABLE `customers` (\n" +
+		"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+		"  `email` varchar(255) NOT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n"
+
+	path := filepath.Join(t.TempDir(), "shop.sql")
+	if err := os.WriteFile(path, []byte(dump), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := importDatabaseStructureFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := app.GetLatestDatabaseStructure()
+	if err != nil || latest != imported {
+		t.Fatalf("expected the imported dump, got %q (%v)", latest, err)
+	}
+
+	var structure schema.Structure
+	if err := json.Unmarshal([]byte(latest), &structure); err != nil || structure.FindTable("customers") == nil {
+		t.Errorf("expected the dump's tables, got %s (%v)", latest, err)
+	}
+
+	connection, err := app.GetDatabaseConnection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanned, err := storeDatabaseStructure(connection.ID, structureSource(connection), snapshotFixture(1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest, err := app.GetLatestDatabaseStructure(); err != nil || latest != scanned {
+		t.Errorf("expected a scan of the connection to win over the import, got %q (%v)", latest, err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"github.com/xuri/excelize/v2"
+)
+
+var xlsxFileFilters = []runtime.FileFilter{
+	{
+		DisplayName: "XLSX (*.xlsx)",
+		Pattern:     "*.xlsx",
+	},
+}
+
+// spreadsheet is a sheet read into rows keyed by the header of each column,
+// in the order the rows appear in the file. Lines holds the row number of
+// each record in the sheet, for error messages
+type spreadsheet struct {
+	Sheet   string
+	Headers []string
+	Rows    []map[string]string
+	Lines   []int
+}
+
+// readSpreadsheet reads a sheet of an XLSX file, or the first sheet when
+// sheet is empty or missing from the file. Header names are trimmed
+func readSpreadsheet(path string, sheet string) (spreadsheet, error) {
+	result := spreadsheet{Headers: []string{}, Rows: []map[string]string{}, Lines: []int{}}
+
+	file, err := excelize.OpenFile(path)
+	if err != nil {
+		return result, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	result.Sheet = file.GetSheetName(0)
+
+	if sheet != "" {
+		if index, err := file.GetSheetIndex(sheet); err == nil && index >= 0 {
+			result.Sheet = sheet
+		}
+	}
+
+	rows, err := file.Rows(result.Sheet)
+	if err != nil {
+		return result, fmt.Errorf("failed to get rows: %w", err)
+	}
+	defer rows.Close()
+
+	line := 0
+
+	for rows.Next() {
+		line++
+
+		columns, err := rows.Columns()
+		if err != nil {
+			return result, fmt.Errorf("failed to read row %d: %w", line, err)
+		}
+
+		// Blank rows before the header and between records are skipped
+		if len(columns) == 0 {
+			continue
+		}
+
+		if len(result.Headers) == 0 {
+			for _, header := range columns {
+				result.Headers = append(result.Headers, strings.TrimSpace(header))
+			}
+
+			continue
+		}
+
+		row := make(map[string]string, len(result.Headers))
+
+		for i, header := range result.Headers {
+			if i < len(columns) {
+				row[header] = columns[i]
+			} else {
+				row[header] = ""
+			}
+		}
+
+		result.Rows = append(result.Rows, row)
+		result.Lines = append(result.Lines, line)
+	}
+
+	return result, rows.Error()
+}
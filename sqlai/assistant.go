@@ -2218,6 +2218,19 @@ func (s *SQLAssistant) validateAndOptimizeSQL(sql string) string {
 		return sql
 	}
 
+	// Views are read-only, so writes against them can never succeed
+	writeRegex := operations.CompileRegex(`(?i)^\s*(?:INSERT\s+INTO|UPDATE|DELETE\s+FROM)\s+` + "`?" + `(\w+)`)
+	if match := writeRegex.FindStringSubmatch(sql); match != nil {
+		for _, table := range s.dbStructure.Tables {
+			if strings.EqualFold(table.Name, match[1]) && table.IsView() {
+				if s.detectedLanguage == "pt" {
+					return fmt.Sprintf("-- %s é uma view e não pode ser modificada.", table.Name)
+				}
+				return fmt.Sprintf("-- %s is a view and cannot be modified.", table.Name)
+			}
+		}
+	}
+
 	// Simple validation checks
 	if !strings.Contains(sql, "FROM") && strings.Contains(sql, "SELECT") {
 		// In this case, we have a SELECT without FROM
@@ -2254,9 +2267,9 @@ func (s *SQLAssistant) validateAndOptimizeSQL(sql string) string {
 			for _, tableName := range tablesInQuery {
 				for _, table := range s.dbStructure.Tables {
 					if table.Name == tableName {
-						// Add primary key and a few important columns
+						// Add primary key, natural keys and a few important columns
 						for _, col := range table.Columns {
-							if col.IsPrimary ||
+							if col.IsPrimary || col.IsUnique ||
 								strings.ToLower(col.Name) == "id" ||
 								util.ContainsAny(strings.ToLower(col.Name),
 									[]string{"name", "title", "created_at"}) {
@@ -2642,6 +2655,12 @@ func buildTableContext(sb *strings.Builder, table models.TableForAI, allTables [
 	if table.Description != "" {
 		sb.WriteString(fmt.Sprintf(" - %s", table.Description))
 	}
+	if table.IsView() {
+		sb.WriteString(" (view, read-only)")
+	}
+	if table.EstimatedRows > 0 {
+		sb.WriteString(fmt.Sprintf(" (~%d rows)", table.EstimatedRows))
+	}
 	sb.WriteString("\n")
 
 	// Add columns
@@ -2651,11 +2670,18 @@ func buildTableContext(sb *strings.Builder, table models.TableForAI, allTables [
 		colDesc := col.Name
 		if col.IsPrimary {
 			colDesc += " (PK)"
+		} else if col.IsUnique {
+			colDesc += " (UNIQUE)"
+		} else if col.HasIndex {
+			colDesc += " (indexed)"
 		}
 		// Check for foreign keys
 		for _, fk := range table.ForeignKeys {
 			if fk.ColumnName == col.Name {
 				colDesc += fmt.Sprintf(" (FK -> %s.%s)", fk.ReferencedTable, fk.ReferencedColumn)
+				if fk.CascadeDelete {
+					colDesc += " (ON DELETE CASCADE)"
+				}
 				break
 			}
 		}
@@ -20,6 +20,12 @@ type TableForAI struct {
 	Description      string            `json:"description"`
 	EstimatedRows    int               `json:"estimatedRows"`
 	CommonQueryTypes []string          `json:"commonQueryTypes"`
+	Type             string            `json:"type"`
+}
+
+// IsView reports whether the table is a view, which cannot be written to
+func (t TableForAI) IsView() bool {
+	return t.Type == "view"
 }
 
 // ColumnForAI represents a database column for AI usage
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The library location can be overridden with these environment variables or
+// with the matching --database and --workspace flags, flags taking precedence
+const (
+	databasePathEnv = "SQL_SCRIPT_MAKER_DB"
+	workspaceEnv    = "SQL_SCRIPT_MAKER_WORKSPACE"
+)
+
+const (
+	defaultWorkspace = "default"
+	appDataDirName   = "sql_script_maker"
+	legacyDatabase   = "database.db"
+)
+
+var workspaceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _.-]{0,63}$`)
+
+// DatabaseLocation describes where the library currently lives
+type DatabaseLocation struct {
+	Path       string
+	Workspace  string
+	Overridden bool
+}
+
+// databaseStorage resolves the library file. Each workspace has its own file
+// under the user config directory, unless an explicit path overrides it
+type databaseStorage struct {
+	mu        sync.RWMutex
+	dir       string
+	override  string
+	workspace string
+}
+
+var storage = &databaseStorage{dir: ".", override: legacyDatabase, workspace: defaultWorkspace}
+
+// configureStorage picks the library location at launch from the command
+// line, the environment and the last workspace used
+func configureStorage(args []string, getenv func(string) string) error {
+	flags := flag.NewFlagSet("sql_script_maker", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	override := flags.String("database", getenv(databasePathEnv), "path of the library database")
+	workspace := flags.String("workspace", getenv(workspaceEnv), "name of the workspace to open")
+
+	// Arguments the app doesn't define, e.g. the -psn_* one added by macOS
+	// when launching an app bundle, are dropped before parsing. Otherwise
+	// parsing would stop at them and miss the flags that follow
+	err := flags.Parse(knownFlagArgs(flags, args))
+	if err != nil {
+		return fmt.Errorf("invalid command line: %w", err)
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		// An explicit path is still honoured, it's the only way to choose a
+		// location on such a system
+		if *override != "" {
+			storage = &databaseStorage{dir: ".", override: *override, workspace: defaultWorkspace}
+			return nil
+		}
+
+		log.Printf("no user config directory, keeping the library in the working directory: %v", err)
+		return nil
+	}
+
+	configured, err := newDatabaseStorage(filepath.Join(dir, appDataDirName), *override, *workspace)
+	if err != nil {
+		return err
+	}
+
+	storage = configured
+
+	return nil
+}
+
+// knownFlagArgs keeps the arguments naming flags defined in flags, with
+// their values, and logs the rest
+func knownFlagArgs(flags *flag.FlagSet, args []string) []string {
+	known := []string{}
+
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		name, _, hasValue := strings.Cut(name, "=")
+
+		if !strings.HasPrefix(args[i], "-") || flags.Lookup(name) == nil {
+			log.Printf("ignoring unknown argument %q", args[i])
+			continue
+		}
+
+		known = append(known, args[i])
+
+		if !hasValue && i+1 < len(args) {
+			i++
+			known = append(known, args[i])
+		}
+	}
+
+	return known
+}
+
+func newDatabaseStorage(dir string, override string, workspace string) (*databaseStorage, error) {
+	s := &databaseStorage{dir: dir, override: override, workspace: workspace}
+
+	if s.workspace == "" {
+		s.workspace = s.lastWorkspace()
+	}
+
+	if !workspaceName.MatchString(s.workspace) {
+		return nil, fmt.Errorf("invalid workspace name %q", s.workspace)
+	}
+
+	return s, nil
+}
+
+// lastWorkspace reads the workspace that was open when the app last switched
+func (s *databaseStorage) lastWorkspace() string {
+	content, err := os.ReadFile(filepath.Join(s.dir, "workspace"))
+	if err != nil {
+		return defaultWorkspace
+	}
+
+	name := strings.TrimSpace(string(content))
+	if !workspaceName.MatchString(name) {
+		return defaultWorkspace
+	}
+
+	return name
+}
+
+func (s *databaseStorage) workspacePath(name string) string {
+	if name == defaultWorkspace {
+		return filepath.Join(s.dir, legacyDatabase)
+	}
+
+	return filepath.Join(s.dir, "workspaces", name+".db")
+}
+
+// Path returns the library file to open
+func (s *databaseStorage) Path() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.override != "" {
+		return s.override
+	}
+
+	return s.workspacePath(s.workspace)
+}
+
+func (s *databaseStorage) Location() DatabaseLocation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	location := DatabaseLocation{Workspace: s.workspace, Overridden: s.override != ""}
+
+	if location.Overridden {
+		location.Path = s.override
+	} else {
+		location.Path = s.workspacePath(s.workspace)
+	}
+
+	return location
+}
+
+// Prepare creates the directory of the library file and, on the first launch
+// with the default workspace, adopts a database.db left by releases that kept
+// the library in the working directory. The legacy file is copied, not moved
+func (s *databaseStorage) Prepare(legacyCandidates []string) error {
+	path := s.Path()
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	adopt := s.override == "" && s.workspace == defaultWorkspace
+	s.mu.RUnlock()
+
+	if !adopt {
+		return nil
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, candidate := range legacyCandidates {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		if same, _ := filepath.Abs(candidate); same == path {
+			continue
+		}
+
+		log.Printf("copying the library from %s to %s", candidate, path)
+
+		return backupSqliteDatabase(candidate, path)
+	}
+
+	return nil
+}
+
+// Switch makes name the current workspace and remembers it for the next launch
+func (s *databaseStorage) Switch(name string) error {
+	if !workspaceName.MatchString(name) {
+		return fmt.Errorf("invalid workspace name %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.override != "" {
+		return fmt.Errorf("the library path is fixed to %s", s.override)
+	}
+
+	err := os.MkdirAll(s.dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(filepath.Join(s.dir, "workspace"), []byte(name+"\n"), 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.workspace = name
+
+	return nil
+}
+
+// Workspaces lists the default workspace and every workspace with a file
+func (s *databaseStorage) Workspaces() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := []string{defaultWorkspace}
+	seen := map[string]bool{defaultWorkspace: true}
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, "workspaces"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".db")
+
+		if entry.IsDir() || name == entry.Name() || !workspaceName.MatchString(name) || seen[name] {
+			continue
+		}
+
+		names = append(names, name)
+		seen[name] = true
+	}
+
+	if !seen[s.workspace] {
+		names = append(names, s.workspace)
+	}
+
+	sort.Strings(names[1:])
+
+	return names, nil
+}
+
+// legacyDatabaseCandidates lists where older releases kept database.db: the
+// working directory, and next to the executable for shortcut launches
+func legacyDatabaseCandidates() []string {
+	candidates := []string{legacyDatabase}
+
+	if executable, err := os.Executable(); err == nil {
+		candidates = append(candidates, filepath.Join(filepath.Dir(executable), legacyDatabase))
+	}
+
+	return candidates
+}
+
+// GetDatabaseLocation returns the library file and workspace in use
+func (a *App) GetDatabaseLocation() DatabaseLocation {
+	return storage.Location()
+}
+
+// ListWorkspaces returns the names of the available workspaces
+func (a *App) ListWorkspaces() ([]string, error) {
+	return storage.Workspaces()
+}
+
+// SwitchWorkspace opens the named workspace, creating its library on first
+// use. When the library can't be opened the previous workspace stays current
+func (a *App) SwitchWorkspace(name string) error {
+	previous := storage.Location().Workspace
+
+	err := storage.Switch(strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+
+	err = storage.Prepare(nil)
+	if err == nil {
+		err = migrateDatabaseFile(storage.Path())
+	}
+
+	if err != nil {
+		if switchErr := storage.Switch(previous); switchErr != nil {
+			log.Printf("failed to switch back to workspace %s: %v", previous, switchErr)
+		}
+
+		return err
+	}
+
+	purgeExpiredQueriesOnOpen()
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDatabaseStorageWorkspaces(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := newDatabaseStorage(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Path() != filepath.Join(dir, "database.db") {
+		t.Errorf("expected the default workspace in the app directory, got %s", s.Path())
+	}
+
+	if err := s.Switch("client a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Path() != filepath.Join(dir, "workspaces", "client a.db") {
+		t.Errorf("unexpected workspace path %s", s.Path())
+	}
+
+	if err := s.Switch("../escape"); err == nil {
+		t.Error("expected a workspace name with a path to be rejected")
+	}
+
+	// The last workspace is reopened on the next launch
+	reopened, err := newDatabaseStorage(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if location := reopened.Location(); location.Workspace != "client a" || location.Overridden {
+		t.Errorf("expected to reopen the last workspace, got %+v", location)
+	}
+
+	names, err := reopened.Workspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 2 || names[0] != "default" || names[1] != "client a" {
+		t.Errorf("unexpected workspaces %v", names)
+	}
+
+	override := filepath.Join(dir, "elsewhere.db")
+
+	fixed, err := newDatabaseStorage(dir, override, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fixed.Path() != override {
+		t.Errorf("expected the override to win, got %s", fixed.Path())
+	}
+
+	if err := fixed.Switch("other"); err == nil {
+		t.Error("expected switching to fail while the path is overridden")
+	}
+}
+
+func TestConfigureStorageFlagsOverEnvironment(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	previous := storage
+	t.Cleanup(func() { storage = previous })
+
+	env := map[string]string{databasePathEnv: "/from/env.db", workspaceEnv: "env"}
+	getenv := func(key string) string { return env[key] }
+
+	if err := configureStorage([]string{"-psn_0_12345"}, getenv); err != nil {
+		t.Fatal(err)
+	}
+
+	if storage.Path() != "/from/env.db" {
+		t.Errorf("expected the environment override, got %s", storage.Path())
+	}
+
+	if err := configureStorage([]string{"--database", "/from/flag.db"}, getenv); err != nil {
+		t.Fatal(err)
+	}
+
+	if storage.Path() != "/from/flag.db" {
+		t.Errorf("expected the flag to take precedence, got %s", storage.Path())
+	}
+
+	if err := configureStorage([]string{"--workspace", "bad/name"}, func(string) string { return "" }); err == nil {
+		t.Error("expected an invalid workspace name to be rejected")
+	}
+
+	// Flags after an argument added by the OS still count
+	if err := configureStorage([]string{"-psn_0_12345", "stray", "-workspace", "flagged", "-database=/from/equals.db"}, func(string) string { return "" }); err != nil {
+		t.Fatal(err)
+	}
+
+	if location := storage.Location(); location.Workspace != "flagged" || location.Path != "/from/equals.db" {
+		t.Errorf("expected the flags after the unknown arguments to apply, got %+v", location)
+	}
+
+	if err := configureStorage([]string{"-workspace"}, getenv); err == nil {
+		t.Error("expected a flag without its value to be reported")
+	}
+}
+
+func TestConfigureStorageWithoutConfigDirectory(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "")
+
+	if _, err := os.UserConfigDir(); err == nil {
+		t.Skip("the user config directory can't be hidden on this system")
+	}
+
+	previous := storage
+	t.Cleanup(func() { storage = previous })
+
+	if err := configureStorage(nil, func(string) string { return "" }); err != nil || storage.Path() != legacyDatabase {
+		t.Errorf("expected the working directory library, got %s (%v)", storage.Path(), err)
+	}
+
+	if err := configureStorage([]string{"-database", "/from/flag.db"}, func(string) string { return "" }); err != nil || storage.Path() != "/from/flag.db" {
+		t.Errorf("expected the flag to be honoured, got %s (%v)", storage.Path(), err)
+	}
+
+	storage = previous
+
+	if err := configureStorage(nil, func(key string) string { return map[string]string{databasePathEnv: "/from/env.db"}[key] }); err != nil || storage.Path() != "/from/env.db" {
+		t.Errorf("expected the environment to be honoured, got %s (%v)", storage.Path(), err)
+	}
+}
+
+func TestSwitchWorkspaceKeepsPreviousOnFailure(t *testing.T) {
+	previous := storage
+	t.Cleanup(func() { storage = previous })
+
+	dir := t.TempDir()
+
+	configured, err := newDatabaseStorage(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage = configured
+
+	if err := os.MkdirAll(filepath.Join(dir, "workspaces"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "workspaces", "broken.db"), []byte("not a database, just some text that is long enough"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewApp()
+
+	if err := app.SwitchWorkspace("broken"); err == nil {
+		t.Fatal("expected a workspace with a corrupt library to fail")
+	}
+
+	if location := app.GetDatabaseLocation(); location.Workspace != defaultWorkspace {
+		t.Errorf("expected the previous workspace to stay current, got %+v", location)
+	}
+
+	if last := storage.lastWorkspace(); last != defaultWorkspace {
+		t.Errorf("expected the previous workspace to be remembered, got %s", last)
+	}
+
+	if err := app.SwitchWorkspace("working"); err != nil {
+		t.Fatal(err)
+	}
+
+	if location := app.GetDatabaseLocation(); location.Workspace != "working" {
+		t.Errorf("expected to switch to the new workspace, got %+v", location)
+	}
+}
+
+func TestPrepareAdoptsLegacyDatabase(t *testing.T) {
+	legacy := openFixtureDatabase(t)
+
+	var legacyPath string
+	if err := legacy.QueryRow("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&legacyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newDatabaseStorage(filepath.Join(t.TempDir(), "app"), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.db")
+
+	if err := s.Prepare([]string{missing, legacyPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var title string
+	if err := db.QueryRow("SELECT title FROM queries WHERE id = 1").Scan(&title); err != nil || title != "Insert users" {
+		t.Errorf("expected the legacy library to be copied, got %q (%v)", title, err)
+	}
+
+	// Once the new location exists the legacy file is never read again
+	if _, err := legacy.Exec("UPDATE queries SET title = 'changed' WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Prepare([]string{legacyPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow("SELECT title FROM queries WHERE id = 1").Scan(&title); err != nil || title != "Insert users" {
+		t.Errorf("expected the adopted library to be kept, got %q (%v)", title, err)
+	}
+}
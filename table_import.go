@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"sql_script_maker/schema"
+	"sql_script_maker/sqlai/util"
+)
+
+// columnMatchThreshold is the lowest similarity at which a header is mapped
+// to a column automatically
+const columnMatchThreshold = 0.85
+
+// ColumnMapping fills a table column from a spreadsheet header. Score is how
+// much the header looks like the column name, 1 being the same name. An
+// empty Field leaves the column out of the statements
+type ColumnMapping struct {
+	Column string
+	Field  string
+	Score  float64
+}
+
+// TableInsertRequest describes statements that load spreadsheet rows into a
+// table. The table is read from the snapshot StructureID, or from the latest
+// snapshot of the saved connection when it is 0. Mode is one of the insert
+// modes of the schema package
+type TableInsertRequest struct {
+	StructureID int
+	Table       string
+	Dialect     string
+	Mode        string
+	Mappings    []ColumnMapping
+	Minify      bool
+	// NullInvalid writes values that do not fit their column type as NULL
+	// instead of refusing to generate the script
+	NullInvalid bool
+}
+
+// TableInsertResult holds the generated statements. Problems lists values
+// that do not fit their column type. While there are any, no SQL is written
+// unless the request asks for them to become NULL
+type TableInsertResult struct {
+	SQL      string
+	Rows     int
+	Problems []string
+}
+
+var headerAccents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+)
+
+// normalizeHeader reduces a header or column name to lowercase letters and
+// digits, so "Born On", "born_on" and "Born-On" compare equal
+func normalizeHeader(name string) string {
+	name = headerAccents.Replace(strings.ToLower(name))
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+
+		return -1
+	}, name)
+}
+
+// matchColumns maps each column of the table to the header most similar to
+// it. The best pairs are taken first, so a header fills one column at most
+func matchColumns(table schema.Table, headers []string) []ColumnMapping {
+	type candidate struct {
+		column int
+		header int
+		score  float64
+	}
+
+	mappings := make([]ColumnMapping, len(table.Columns))
+	candidates := []candidate{}
+
+	for i, column := range table.Columns {
+		mappings[i] = ColumnMapping{Column: column.Name}
+		name := normalizeHeader(column.Name)
+
+		for j, header := range headers {
+			normalized := normalizeHeader(header)
+
+			if name == "" || normalized == "" {
+				continue
+			}
+
+			score := util.JaroWinklerSimilarity(name, normalized)
+
+			if score >= columnMatchThreshold {
+				candidates = append(candidates, candidate{column: i, header: j, score: score})
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	usedHeaders := make(map[int]bool)
+
+	for _, c := range candidates {
+		if mappings[c.column].Field != "" || usedHeaders[c.header] {
+			continue
+		}
+
+		mappings[c.column].Field = headers[c.header]
+		mappings[c.column].Score = c.score
+		usedHeaders[c.header] = true
+	}
+
+	return mappings
+}
+
+// columnValueType is the QueryVariable type that spreadsheet values of a
+// column are read as. tinyint(1) is the MySQL convention for booleans
+func columnValueType(column schema.Column) string {
+	base, args, _ := schema.SplitColumnType(column.Type)
+
+	switch base {
+	case "bool", "boolean":
+		return VariableBoolean
+	case "tinyint":
+		if args == "1" {
+			return VariableBoolean
+		}
+
+		return VariableNumber
+	case "smallint", "mediumint", "int", "integer", "bigint", "decimal", "numeric", "dec", "fixed", "float", "double", "real", "year":
+		return VariableNumber
+	case "date", "datetime", "timestamp":
+		return VariableDate
+	}
+
+	return VariableString
+}
+
+// columnLiteral renders a spreadsheet value as a literal for a column.
+// Empty cells are NULL, and so are values that do not fit the column type,
+// with the error saying why
+func columnLiteral(column schema.Column, value string, dialect schema.Dialect) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "NULL", nil
+	}
+
+	switch valueType := columnValueType(column); valueType {
+	case VariableNumber, VariableDate:
+		return formatVariable(QueryVariable{Type: valueType}, value)
+	case VariableBoolean:
+		boolean, err := parseBoolean(value)
+		if err != nil {
+			return "NULL", err
+		}
+
+		base, _, _ := schema.SplitColumnType(column.Type)
+
+		switch {
+		case base == "tinyint" && boolean:
+			return "1", nil
+		case base == "tinyint":
+			return "0", nil
+		case boolean:
+			return "TRUE", nil
+		}
+
+		return "FALSE", nil
+	}
+
+	return schema.QuoteString(dialect, value), nil
+}
+
+// cellText is the text of a value as read by ReadXLSXFile
+func cellText(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// loadTargetTable finds a base table in a schema snapshot, the latest of the
+// saved connection when structureID is 0
+func (a *App) loadTargetTable(structureID int, name string) (schema.Table, error) {
+	var structure schema.Structure
+
+	if structureID > 0 {
+		db := openSqliteConnection()
+		defer db.Close()
+
+		loaded, err := loadDatabaseStructure(db, structureID)
+		if err != nil {
+			return schema.Table{}, err
+		}
+
+		structure = loaded
+	} else {
+		structureJSON, err := a.GetLatestDatabaseStructure()
+		if err != nil {
+			return schema.Table{}, err
+		}
+
+		if structureJSON == "" {
+			return schema.Table{}, fmt.Errorf("database structure not found, please scan your database first")
+		}
+
+		err = json.Unmarshal([]byte(structureJSON), &structure)
+		if err != nil {
+			return schema.Table{}, fmt.Errorf("the database structure is not valid: %w", err)
+		}
+	}
+
+	table := structure.FindTable(name)
+
+	if table == nil {
+		return schema.Table{}, fmt.Errorf("table %s is not in the database structure", name)
+	}
+
+	if table.IsView() {
+		return schema.Table{}, fmt.Errorf("%s is a view, choose a table", name)
+	}
+
+	return *table, nil
+}
+
+// mappedColumns returns the mapped columns and their headers, checking that
+// each column is mapped once and exists in the table
+func mappedColumns(table schema.Table, mappings []ColumnMapping) ([]string, []string, error) {
+	columns := []string{}
+	fields := []string{}
+	seen := make(map[string]bool)
+
+	for _, mapping := range mappings {
+		if mapping.Field == "" {
+			continue
+		}
+
+		if table.FindColumn(mapping.Column) == nil {
+			return nil, nil, fmt.Errorf("table %s has no column %s", table.Name, mapping.Column)
+		}
+
+		if seen[mapping.Column] {
+			return nil, nil, fmt.Errorf("column %s is mapped twice", mapping.Column)
+		}
+
+		seen[mapping.Column] = true
+		columns = append(columns, mapping.Column)
+		fields = append(fields, mapping.Field)
+	}
+
+	return columns, fields, nil
+}
+
+// SuggestColumnMappings maps every column of a table to the spreadsheet
+// header that looks most like it. Columns with no header close enough are
+// left unmapped for the user to fill in
+func (a *App) SuggestColumnMappings(structureID int, tableName string, headers []string) ([]ColumnMapping, error) {
+	table, err := a.loadTargetTable(structureID, tableName)
+	if err != nil {
+		return []ColumnMapping{}, err
+	}
+
+	return matchColumns(table, headers), nil
+}
+
+// GenerateTableInserts writes one INSERT, INSERT IGNORE, upsert or MERGE
+// statement per spreadsheet row, filling the columns as mapped
+func (a *App) GenerateTableInserts(request TableInsertRequest, data []map[string]interface{}) (TableInsertResult, error) {
+	result := TableInsertResult{Problems: []string{}}
+
+	table, err := a.loadTargetTable(request.StructureID, request.Table)
+	if err != nil {
+		return result, err
+	}
+
+	return generateTableInserts(table, request, data)
+}
+
+func generateTableInserts(table schema.Table, request TableInsertRequest, data []map[string]interface{}) (TableInsertResult, error) {
+	result := TableInsertResult{Problems: []string{}}
+
+	dialect, err := schema.ParseDialect(request.Dialect)
+	if err != nil {
+		return result, err
+	}
+
+	mode := request.Mode
+	if mode == "" {
+		mode = schema.InsertPlain
+	}
+
+	columns, fields, err := mappedColumns(table, request.Mappings)
+	if err != nil {
+		return result, err
+	}
+
+	rows := make([][]string, len(data))
+
+	for i, row := range data {
+		rows[i] = make([]string, len(columns))
+
+		for j, name := range columns {
+			literal, err := columnLiteral(*table.FindColumn(name), cellText(row[fields[j]]), dialect)
+
+			if err != nil {
+				result.Problems = append(result.Problems, fmt.Sprintf("row %d, %s: %v", i+1, fields[j], err))
+			}
+
+			rows[i][j] = literal
+		}
+	}
+
+	if len(result.Problems) > 0 && !request.NullInvalid {
+		return result, nil
+	}
+
+	statements, err := schema.InsertStatements(table, columns, rows, mode, dialect)
+	if err != nil {
+		return result, err
+	}
+
+	separator := "\n"
+	if request.Minify {
+		separator = " "
+	}
+
+	result.SQL = strings.Join(statements, separator)
+	result.Rows = len(statements)
+
+	return result, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"sql_script_maker/schema"
+)
+
+func importFixture() schema.Table {
+	return schema.Table{
+		Name: "customers",
+		Type: schema.TableTypeBase,
+		Columns: []schema.Column{
+			{Name: "id", Type: "int(10) unsigned", Nullable: "NO", Extra: "auto_increment", IsPrimary: true},
+			{Name: "email", Type: "varchar(120)", Nullable: "NO"},
+			{Name: "full_name", Type: "varchar(80)", Nullable: "YES"},
+			{Name: "born_on", Type: "date", Nullable: "YES"},
+			{Name: "active", Type: "tinyint(1)", Nullable: "NO"},
+			{Name: "balance", Type: "decimal(10,2)", Nullable: "YES"},
+		},
+		Indexes: []schema.Index{
+			{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+			{Name: "email", Columns: []string{"email"}, Unique: true},
+		},
+	}
+}
+
+func TestMatchColumns(t *testing.T) {
+	headers := []string{"Emails", "Notes", "Full Name", "E-mail", "Born On", "Active?", "Balançe"}
+
+	mappings := matchColumns(importFixture(), headers)
+
+	expected := map[string]string{
+		"id":        "",
+		"email":     "E-mail",
+		"full_name": "Full Name",
+		"born_on":   "Born On",
+		"active":    "Active?",
+		"balance":   "Balançe",
+	}
+
+	for _, mapping := range mappings {
+		if mapping.Field != expected[mapping.Column] {
+			t.Errorf("expected %s to be mapped to %q, got %q (%.2f)", mapping.Column, expected[mapping.Column], mapping.Field, mapping.Score)
+		}
+	}
+
+	if mappings[1].Score != 1 {
+		t.Errorf("expected an exact match to score 1, got %.2f", mappings[1].Score)
+	}
+}
+
+func TestGenerateTableInserts(t *testing.T) {
+	table := importFixture()
+
+	request := TableInsertRequest{
+		Table:   "customers",
+		Dialect: "mysql",
+		Mode:    schema.InsertUpsert,
+		Mappings: []ColumnMapping{
+			{Column: "id"},
+			{Column: "email", Field: "E-mail"},
+			{Column: "full_name", Field: "Name"},
+			{Column: "born_on", Field: "Born"},
+			{Column: "active", Field: "Active"},
+			{Column: "balance", Field: "Balance"},
+		},
+	}
+
+	data := []map[string]interface{}{
+		{"E-mail": "ana@example.com", "Name": `O'Hara \ Ana`, "Born": "01/05/1990", "Active": "sim", "Balance": "1.234,50"},
+		{"E-mail": "bia@example.com", "Name": "", "Born": "someday", "Active": "no", "Balance": nil},
+	}
+
+	result, err := generateTableInserts(table, request, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.SQL != "" || result.Rows != 0 || len(result.Problems) != 1 {
+		t.Errorf("expected no SQL while a value is invalid, got %+v", result)
+	}
+
+	request.NullInvalid = true
+
+	result, err = generateTableInserts(table, request, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "INSERT INTO `customers` (`email`, `full_name`, `born_on`, `active`, `balance`) VALUES ('ana@example.com', 'O''Hara \\\\ Ana', '1990-05-01', 1, 1234.5) ON DUPLICATE KEY UPDATE `full_name` = VALUES(`full_name`), `born_on` = VALUES(`born_on`), `active` = VALUES(`active`), `balance` = VALUES(`balance`);\n" +
+		"INSERT INTO `customers` (`email`, `full_name`, `born_on`, `active`, `balance`) VALUES ('bia@example.com', NULL, NULL, 0, NULL) ON DUPLICATE KEY UPDATE `full_name` = VALUES(`full_name`), `born_on` = VALUES(`born_on`), `active` = VALUES(`active`), `balance` = VALUES(`balance`);"
+
+	if result.SQL != expected {
+		t.Errorf("unexpected SQL:\n%s", result.SQL)
+	}
+
+	if result.Rows != 2 || len(result.Problems) != 1 || result.Problems[0] != `row 2, Born: "someday" is not a date` {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	request.Dialect = "postgres"
+	request.Mode = schema.InsertIgnore
+	request.Minify = true
+
+	result, err = generateTableInserts(table, request, data[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result.SQL, `'O''Hara \ Ana'`) || !strings.HasSuffix(result.SQL, "ON CONFLICT DO NOTHING;") {
+		t.Errorf("unexpected PostgreSQL SQL: %s", result.SQL)
+	}
+
+	request.Mappings = append(request.Mappings, ColumnMapping{Column: "email", Field: "Other"})
+
+	if _, err := generateTableInserts(table, request, data); err == nil {
+		t.Error("expected a column mapped twice to be rejected")
+	}
+}
+
+func TestSuggestColumnMappingsFromSnapshot(t *testing.T) {
+	useTemporaryLibrary(t)
+
+	if _, err := storeDatabaseStructure(nil, "test", schema.Structure{Tables: []schema.Table{importFixture()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	var id int
+	if err := db.QueryRow("SELECT MAX(id) FROM database_structure").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewApp()
+
+	mappings, err := app.SuggestColumnMappings(id, "customers", []string{"EMAIL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mappings) != 6 || mappings[1].Field != "EMAIL" {
+		t.Errorf("unexpected mappings %+v", mappings)
+	}
+
+	if _, err := app.SuggestColumnMappings(id, "orders", nil); err == nil {
+		t.Error("expected a missing table to be reported")
+	}
+}
+
+func TestGenerateTableInsertsKeepsExactNumbers(t *testing.T) {
+	table := schema.Table{
+		Name: "ledger",
+		Type: schema.TableTypeBase,
+		Columns: []schema.Column{
+			{Name: "id", Type: "bigint(20) unsigned", Nullable: "NO", IsPrimary: true},
+			{Name: "amount", Type: "decimal(20,2)", Nullable: "NO"},
+		},
+	}
+
+	request := TableInsertRequest{
+		Table:    "ledger",
+		Dialect:  "mysql",
+		Mappings: []ColumnMapping{{Column: "id", Field: "ID"}, {Column: "amount", Field: "Amount"}},
+	}
+
+	data := []map[string]interface{}{
+		{"ID": "9007199254740993", "Amount": "123.456.789.012.345.678,91"},
+		{"ID": "18446744073709551615", "Amount": "12345678901234567.89"},
+	}
+
+	result, err := generateTableInserts(table, request, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "INSERT INTO `ledger` (`id`, `amount`) VALUES (9007199254740993, 123456789012345678.91);\n" +
+		"INSERT INTO `ledger` (`id`, `amount`) VALUES (18446744073709551615, 12345678901234567.89);"
+
+	if result.SQL != expected || len(result.Problems) != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
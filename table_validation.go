@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"sql_script_maker/schema"
+)
+
+// maxValidationProblems caps the report, so a sheet with a wrong column
+// mapped does not produce one problem per row
+const maxValidationProblems = 1000
+
+// foreignKeyLookupSize is how many values go into one IN list when looking
+// up referenced rows
+const foreignKeyLookupSize = 500
+
+// ValidationProblem is a spreadsheet value that does not fit its column.
+// Row counts data rows from 1
+type ValidationProblem struct {
+	Row     int
+	Column  string
+	Field   string
+	Value   string
+	Problem string
+}
+
+// TableValidationRequest describes spreadsheet rows about to be written into
+// a table, as in TableInsertRequest. With CheckForeignKeys the values of
+// foreign key columns are looked up in the referenced tables through
+// Connection
+type TableValidationRequest struct {
+	StructureID      int
+	Table            string
+	Mappings         []ColumnMapping
+	CheckForeignKeys bool
+	Connection       DatabaseConnection
+}
+
+// TableValidationReport lists the problems found, ordered by row. Truncated
+// is set when there were more than could be reported
+type TableValidationReport struct {
+	Rows      int
+	Problems  []ValidationProblem
+	Truncated bool
+}
+
+// TemplateTarget is the table a query template inserts into and the
+// spreadsheet header bound to each of its columns
+type TemplateTarget struct {
+	Table    string
+	Mappings []ColumnMapping
+}
+
+// Bits of the MySQL integer types
+var integerBits = map[string]uint{
+	"tinyint":   8,
+	"smallint":  16,
+	"mediumint": 24,
+	"int":       32,
+	"integer":   32,
+	"bigint":    64,
+}
+
+// checkColumnValue tells why a spreadsheet value cannot be stored in the
+// column, or returns nil when it can. Empty cells are written as NULL
+func checkColumnValue(column schema.Column, value string) error {
+	trimmed := strings.TrimSpace(value)
+
+	if trimmed == "" {
+		if strings.EqualFold(column.Nullable, "NO") && !strings.Contains(strings.ToLower(column.Extra), "auto_increment") {
+			return fmt.Errorf("is empty but the column is NOT NULL")
+		}
+
+		return nil
+	}
+
+	base, args, unsigned := schema.SplitColumnType(column.Type)
+
+	switch columnValueType(column) {
+	case VariableBoolean:
+		_, err := parseBoolean(trimmed)
+		return err
+	case VariableDate:
+		_, err := parseSpreadsheetDate(trimmed)
+		return err
+	case VariableNumber:
+		return checkNumber(base, args, unsigned, trimmed)
+	}
+
+	switch base {
+	case "char", "varchar":
+		limit, err := strconv.Atoi(args)
+		if err == nil && utf8.RuneCountInString(value) > limit {
+			return fmt.Errorf("has %d characters, %s allows %d", utf8.RuneCountInString(value), column.Type, limit)
+		}
+	case "enum":
+		for _, member := range schema.EnumValues(column.Type) {
+			if strings.EqualFold(member, trimmed) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%q is not one of %s", value, args)
+	}
+
+	return nil
+}
+
+// checkNumber checks a number against the range of an integer type and the
+// precision and scale of a decimal type
+func checkNumber(base string, args string, unsigned bool, value string) error {
+	number, err := parseDecimal(value)
+	if err != nil {
+		return err
+	}
+
+	if bits, ok := integerBits[base]; ok {
+		if !number.IsInt() {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+
+		integer := number.Num()
+		low := new(big.Int)
+		high := new(big.Int).Lsh(big.NewInt(1), bits)
+
+		if unsigned {
+			high.Sub(high, big.NewInt(1))
+		} else {
+			high.Rsh(high, 1)
+			low.Neg(high)
+			high.Sub(high, big.NewInt(1))
+		}
+
+		if integer.Cmp(low) < 0 || integer.Cmp(high) > 0 {
+			return fmt.Errorf("%s is out of range for %s, from %s to %s", value, base, low, high)
+		}
+
+		return nil
+	}
+
+	if unsigned && number.Sign() < 0 {
+		return fmt.Errorf("%s is negative but the column is unsigned", value)
+	}
+
+	switch base {
+	case "decimal", "numeric", "dec", "fixed":
+	case "year":
+		if !number.IsInt() {
+			return fmt.Errorf("%q is not a year", value)
+		}
+
+		year := number.Num().Int64()
+		if year != 0 && (year < 1901 || year > 2155) {
+			return fmt.Errorf("%s is out of range for year, from 1901 to 2155", value)
+		}
+
+		return nil
+	default:
+		return nil
+	}
+
+	// MySQL defaults to decimal(10,0)
+	precision, scale := 10, 0
+
+	if args != "" {
+		parts := strings.Split(args, ",")
+		precision, _ = strconv.Atoi(strings.TrimSpace(parts[0]))
+
+		if len(parts) > 1 {
+			scale, _ = strconv.Atoi(strings.TrimSpace(parts[1]))
+		}
+	}
+
+	digits := strings.TrimPrefix(decimalText(number), "-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	whole = strings.TrimLeft(whole, "0")
+
+	if len(whole) > precision-scale {
+		return fmt.Errorf("%s is out of range for decimal(%d,%d), which allows %d digits before the point", value, precision, scale, precision-scale)
+	}
+
+	if len(fraction) > scale {
+		return fmt.Errorf("%s has more than the %d decimal places of decimal(%d,%d)", value, scale, precision, scale)
+	}
+
+	return nil
+}
+
+// validateTableData checks every mapped value of every row against its
+// column definition
+func validateTableData(table schema.Table, mappings []ColumnMapping, data []map[string]interface{}) ([]ValidationProblem, error) {
+	columns, fields, err := mappedColumns(table, mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []ValidationProblem{}
+
+	for i, row := range data {
+		for j, name := range columns {
+			value := cellText(row[fields[j]])
+
+			if err := checkColumnValue(*table.FindColumn(name), value); err != nil {
+				problems = append(problems, ValidationProblem{Row: i + 1, Column: name, Field: fields[j], Value: value, Problem: err.Error()})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// referenceValue is the value looked up in the referenced column, with
+// numbers written the way SQL reads them
+func referenceValue(column schema.Column, value string) (string, bool) {
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return "", false
+	}
+
+	if columnValueType(column) == VariableNumber {
+		number, err := formatVariable(QueryVariable{Type: VariableNumber}, value)
+		return number, err == nil
+	}
+
+	return value, true
+}
+
+// checkForeignKeys looks up the values of single column foreign keys in the
+// referenced tables and reports the ones not found there
+func checkForeignKeys(ctx context.Context, runner queryRunner, table schema.Table, mappings []ColumnMapping, data []map[string]interface{}) ([]ValidationProblem, error) {
+	columns, fields, err := mappedColumns(table, mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := make(map[string]string, len(columns))
+	for i, column := range columns {
+		mapped[column] = fields[i]
+	}
+
+	problems := []ValidationProblem{}
+
+	for _, constraint := range table.ForeignKeyConstraints() {
+		field, ok := mapped[constraint.Columns[0]]
+		if len(constraint.Columns) != 1 || !ok {
+			continue
+		}
+
+		column := table.FindColumn(constraint.Columns[0])
+		values := []string{}
+		seen := make(map[string]bool)
+
+		for _, row := range data {
+			value, ok := referenceValue(*column, cellText(row[field]))
+
+			if ok && !seen[value] {
+				seen[value] = true
+				values = append(values, value)
+			}
+		}
+
+		found, err := lookupReferences(ctx, runner, constraint, *column, values)
+		if err != nil {
+			return nil, fmt.Errorf("could not look up %s.%s: %w", constraint.ReferencedTable, constraint.ReferencedColumns[0], err)
+		}
+
+		for i, row := range data {
+			value := cellText(row[field])
+			reference, ok := referenceValue(*column, value)
+
+			if ok && !found[strings.ToLower(reference)] {
+				problems = append(problems, ValidationProblem{
+					Row:     i + 1,
+					Column:  column.Name,
+					Field:   field,
+					Value:   value,
+					Problem: fmt.Sprintf("%q is not in %s.%s", value, constraint.ReferencedTable, constraint.ReferencedColumns[0]),
+				})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// lookupReferences returns the values found in the referenced column, in
+// lowercase since the default MySQL collations ignore case
+func lookupReferences(ctx context.Context, runner queryRunner, constraint schema.ForeignKeyConstraint, column schema.Column, values []string) (map[string]bool, error) {
+	found := make(map[string]bool, len(values))
+	referenced := schema.QuoteIdentifier(schema.DialectMySQL, constraint.ReferencedColumns[0])
+
+	for start := 0; start < len(values); start += foreignKeyLookupSize {
+		batch := values[start:min(start+foreignKeyLookupSize, len(values))]
+		args := make([]interface{}, len(batch))
+
+		for i, value := range batch {
+			args[i] = value
+		}
+
+		query := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IN (%s)", referenced,
+			schema.QuoteIdentifier(schema.DialectMySQL, constraint.ReferencedTable), referenced,
+			strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", "))
+
+		rows, err := runTestQuery(ctx, runner, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range rows {
+			if value, ok := referenceValue(column, cellText(row[constraint.ReferencedColumns[0]])); ok {
+				found[strings.ToLower(value)] = true
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// ValidateTableData checks spreadsheet rows against the columns they are
+// mapped to before any SQL is generated: NOT NULL, text length, numeric
+// range and precision, dates, booleans and enum members, and optionally
+// whether foreign keys point at existing rows
+func (a *App) ValidateTableData(request TableValidationRequest, data []map[string]interface{}) (TableValidationReport, error) {
+	report := TableValidationReport{Rows: len(data), Problems: []ValidationProblem{}}
+
+	table, err := a.loadTargetTable(request.StructureID, request.Table)
+	if err != nil {
+		return report, err
+	}
+
+	problems, err := validateTableData(table, request.Mappings, data)
+	if err != nil {
+		return report, err
+	}
+
+	if request.CheckForeignKeys {
+		session, err := a.connections.Session(request.Connection)
+		if err != nil {
+			return report, err
+		}
+
+		missing, err := checkForeignKeys(context.Background(), session, table, request.Mappings, data)
+		if err != nil {
+			return report, err
+		}
+
+		problems = append(problems, missing...)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Row < problems[j].Row
+	})
+
+	if len(problems) > maxValidationProblems {
+		problems = problems[:maxValidationProblems]
+		report.Truncated = true
+	}
+
+	report.Problems = problems
+
+	return report, nil
+}
+
+var (
+	templateInsert      = regexp.MustCompile("(?is)\\binsert\\s+(?:ignore\\s+)?into\\s+((?:[`\"]?[\\w$]+[`\"]?\\.)?[`\"]?[\\w$]+[`\"]?)\\s*\\(")
+	templateValues      = regexp.MustCompile(`(?is)^\s*values\s*\(`)
+	templatePlaceholder = regexp.MustCompile(`^'?\{\{ (\w+) \}\}'?$`)
+)
+
+// closingParen returns the index of the parenthesis closing the one at
+// open, skipping quoted text, or -1 when it is not closed
+func closingParen(text string, open int) int {
+	depth := 0
+
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case '\'', '"', '`':
+			end := strings.IndexByte(text[i+1:], text[i])
+			if end < 0 {
+				return -1
+			}
+
+			i += end + 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// splitSQLList splits a comma separated list, leaving commas inside quotes
+// and parentheses alone
+func splitSQLList(list string) []string {
+	items := []string{}
+	depth, start := 0, 0
+
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '\'', '"', '`':
+			if end := strings.IndexByte(list[i+1:], list[i]); end >= 0 {
+				i += end + 1
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	return append(items, strings.TrimSpace(list[start:]))
+}
+
+// templateTarget finds the first INSERT of a template and maps each column
+// whose value is a bare {{ placeholder }}, quoted or not, to the header the
+// placeholder is bound to. Columns filled by expressions are left unmapped
+func templateTarget(query string, variables []Variable) (TemplateTarget, error) {
+	target := TemplateTarget{Mappings: []ColumnMapping{}}
+
+	match := templateInsert.FindStringSubmatchIndex(query)
+	if match == nil {
+		return target, fmt.Errorf("the template has no INSERT INTO statement")
+	}
+
+	name := query[match[2]:match[3]]
+	target.Table = strings.Trim(name[strings.LastIndex(name, ".")+1:], "`\"")
+
+	open := match[1] - 1
+	end := closingParen(query, open)
+	if end < 0 {
+		return target, fmt.Errorf("the column list of the INSERT INTO %s is not closed", target.Table)
+	}
+
+	columns := splitSQLList(query[open+1 : end])
+	rest := query[end+1:]
+
+	values := templateValues.FindStringIndex(rest)
+	if values == nil {
+		return target, fmt.Errorf("the INSERT INTO %s has no VALUES list", target.Table)
+	}
+
+	valuesEnd := closingParen(rest, values[1]-1)
+	if valuesEnd < 0 {
+		return target, fmt.Errorf("the VALUES list of the INSERT INTO %s is not closed", target.Table)
+	}
+
+	items := splitSQLList(rest[values[1]:valuesEnd])
+	if len(items) != len(columns) {
+		return target, fmt.Errorf("the INSERT INTO %s has %d columns and %d values", target.Table, len(columns), len(items))
+	}
+
+	fields := make(map[string]string, len(variables))
+	for _, variable := range variables {
+		fields[variable.Value] = variable.Field
+	}
+
+	for i, column := range columns {
+		mapping := ColumnMapping{Column: strings.Trim(column, "`\"")}
+
+		if placeholder := templatePlaceholder.FindStringSubmatch(items[i]); placeholder != nil {
+			mapping.Field = fields[placeholder[1]]
+		}
+
+		target.Mappings = append(target.Mappings, mapping)
+	}
+
+	return target, nil
+}
+
+// GetTemplateTarget tells which table a query template inserts into and
+// which spreadsheet header fills each column, so the rows can be validated
+// with ValidateTableData before binding
+func (a *App) GetTemplateTarget(query string, variables []Variable) (TemplateTarget, error) {
+	return templateTarget(query, variables)
+}
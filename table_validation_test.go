@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sql_script_maker/schema"
+)
+
+func TestCheckColumnValue(t *testing.T) {
+	cases := []struct {
+		column  schema.Column
+		value   string
+		problem string
+	}{
+		{schema.Column{Type: "varchar(5)", Nullable: "NO"}, "", "NOT NULL"},
+		{schema.Column{Type: "int(10) unsigned", Nullable: "NO", Extra: "auto_increment"}, "", ""},
+		{schema.Column{Type: "varchar(5)"}, "ação!", ""},
+		{schema.Column{Type: "varchar(5)"}, "abcdef", "has 6 characters"},
+		{schema.Column{Type: "tinyint(4)"}, "127", ""},
+		{schema.Column{Type: "tinyint(4)"}, "128", "out of range for tinyint, from -128 to 127"},
+		{schema.Column{Type: "tinyint(3) unsigned"}, "-1", "from 0 to 255"},
+		{schema.Column{Type: "bigint(20) unsigned"}, "18446744073709551615", ""},
+		{schema.Column{Type: "bigint(20)"}, "9223372036854775807", ""},
+		{schema.Column{Type: "bigint(20)"}, "9223372036854775808", "out of range for bigint"},
+		{schema.Column{Type: "decimal(20,2)"}, "123456789012345678.91", ""},
+		{schema.Column{Type: "decimal(20,2)"}, "12345678901234567.891", "has more than the 2 decimal places"},
+		{schema.Column{Type: "int(11)"}, "1.5", "not a whole number"},
+		{schema.Column{Type: "int(11)"}, "abc", "not a number"},
+		{schema.Column{Type: "decimal(5,2)"}, "1,234", "has more than the 2 decimal places"},
+		{schema.Column{Type: "decimal(5,2)"}, "-999,99", ""},
+		{schema.Column{Type: "decimal(5,2)"}, "1000", "allows 3 digits before the point"},
+		{schema.Column{Type: "decimal(10,2) unsigned"}, "-1", "unsigned"},
+		{schema.Column{Type: "date"}, "31/12/2024", ""},
+		{schema.Column{Type: "datetime"}, "someday", "not a date"},
+		{schema.Column{Type: "tinyint(1)"}, "talvez", "not a boolean"},
+		{schema.Column{Type: "enum('new','paid')"}, "Paid", ""},
+		{schema.Column{Type: "enum('new','paid')"}, "lost", `"lost" is not one of 'new','paid'`},
+		{schema.Column{Type: "year(4)"}, "1800", "out of range for year"},
+		{schema.Column{Type: "text"}, strings.Repeat("x", 1000), ""},
+	}
+
+	for _, c := range cases {
+		err := checkColumnValue(c.column, c.value)
+
+		switch {
+		case c.problem == "" && err != nil:
+			t.Errorf("%s %q: unexpected problem %v", c.column.Type, c.value, err)
+		case c.problem != "" && (err == nil || !strings.Contains(err.Error(), c.problem)):
+			t.Errorf("%s %q: expected a problem about %q, got %v", c.column.Type, c.value, c.problem, err)
+		}
+	}
+}
+
+func TestValidateTableData(t *testing.T) {
+	mappings := []ColumnMapping{
+		{Column: "email", Field: "E-mail"},
+		{Column: "born_on", Field: "Born"},
+		{Column: "balance", Field: "Balance"},
+	}
+
+	data := []map[string]interface{}{
+		{"E-mail": "ana@example.com", "Born": "01/05/1990", "Balance": "12.5"},
+		{"E-mail": "", "Born": "someday", "Balance": 12345678901.5},
+	}
+
+	problems, err := validateTableData(importFixture(), mappings, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(problems) != 3 {
+		t.Fatalf("expected 3 problems, got %+v", problems)
+	}
+
+	expected := ValidationProblem{Row: 2, Column: "born_on", Field: "Born", Value: "someday", Problem: `"someday" is not a date`}
+	if !reflect.DeepEqual(problems[1], expected) {
+		t.Errorf("expected %+v, got %+v", expected, problems[1])
+	}
+
+	if problems[0].Column != "email" || problems[2].Column != "balance" {
+		t.Errorf("unexpected problems %+v", problems)
+	}
+}
+
+func TestCheckForeignKeys(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("CREATE TABLE customers (id INTEGER PRIMARY KEY, code TEXT); INSERT INTO customers (id, code) VALUES (1, 'ACME'), (2, 'GLOBEX'), (9007199254740993, 'BIG')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := schema.Table{
+		Name: "orders",
+		Columns: []schema.Column{
+			{Name: "customer_id", Type: "bigint(20)"},
+			{Name: "customer_code", Type: "varchar(10)"},
+		},
+		ForeignKeys: []schema.ForeignKey{
+			{ColumnName: "customer_id", ReferencedTable: "customers", ReferencedColumn: "id", ConstraintName: "fk_customer"},
+			{ColumnName: "customer_code", ReferencedTable: "customers", ReferencedColumn: "code", ConstraintName: "fk_code"},
+		},
+	}
+
+	mappings := []ColumnMapping{
+		{Column: "customer_id", Field: "Customer"},
+		{Column: "customer_code", Field: "Code"},
+	}
+
+	data := []map[string]interface{}{
+		{"Customer": "1", "Code": "ACME"},
+		{"Customer": "2,0", "Code": ""},
+		{"Customer": "3", "Code": "INITECH"},
+		{"Customer": "9007199254740993", "Code": "BIG"},
+		{"Customer": "9007199254740992", "Code": "BIG"},
+	}
+
+	problems, err := checkForeignKeys(context.Background(), db, table, mappings, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(problems) != 3 {
+		t.Fatalf("expected 3 problems, got %+v", problems)
+	}
+
+	if problems[1].Row != 5 || problems[1].Value != "9007199254740992" {
+		t.Errorf("expected only the rounded ID to be missing, got %+v", problems[1])
+	}
+
+	if problems[0].Row != 3 || problems[0].Problem != `"3" is not in customers.id` {
+		t.Errorf("unexpected problem %+v", problems[0])
+	}
+
+	if problems[2].Row != 3 || problems[2].Column != "customer_code" {
+		t.Errorf("unexpected problem %+v", problems[2])
+	}
+}
+
+func TestTemplateTarget(t *testing.T) {
+	query := "INSERT INTO `shop`.`customers` (`email`, full_name, active, created_at)\nVALUES ('{{ email }}', '{{ name }}', {{ active }}, NOW());"
+	variables := []Variable{
+		{Field: "E-mail", Value: "email"},
+		{Field: "Name", Value: "name"},
+		{Field: "Active", Value: "active"},
+	}
+
+	target, err := templateTarget(query, variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := TemplateTarget{
+		Table: "customers",
+		Mappings: []ColumnMapping{
+			{Column: "email", Field: "E-mail"},
+			{Column: "full_name", Field: "Name"},
+			{Column: "active", Field: "Active"},
+			{Column: "created_at"},
+		},
+	}
+
+	if !reflect.DeepEqual(target, expected) {
+		t.Errorf("expected %+v, got %+v", expected, target)
+	}
+
+	if _, err := templateTarget("UPDATE customers SET name = '{{ name }}'", variables); err == nil {
+		t.Error("expected a template without INSERT to be rejected")
+	}
+
+	if _, err := templateTarget("INSERT INTO customers (a, b) VALUES ('{{ a }}')", variables); err == nil {
+		t.Error("expected a column and value count mismatch to be rejected")
+	}
+}
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Kinds of templateNode
+const (
+	templateText  = "text"
+	templateIf    = "if"
+	templateGroup = "group"
+	templateEach  = "each"
+)
+
+var (
+	templateTag        = regexp.MustCompile(`\{%\s*(.*?)\s*%\}`)
+	bindingPlaceholder = regexp.MustCompile(`{{ \w+ }}`)
+)
+
+// templateNode is a piece of a query template. Text is bound to a row as it
+// is; an if renders Body or Otherwise; a group renders Body once per
+// distinct value of Key; an each renders Body once per row
+type templateNode struct {
+	Kind      string
+	Text      string
+	Condition templateCondition
+	Key       string
+	Body      []templateNode
+	Otherwise []templateNode
+}
+
+// templateCondition is a list of alternatives joined by "or", each a list of
+// comparisons joined by "and"
+type templateCondition [][]templateComparison
+
+// templateComparison compares two operands, or tests whether Left is set
+// when there is no Operator
+type templateComparison struct {
+	Negate   bool
+	Left     templateOperand
+	Operator string
+	Right    templateOperand
+}
+
+// templateOperand is a placeholder name, or a literal when Literal is set
+type templateOperand struct {
+	Value   string
+	Literal bool
+}
+
+// parseTemplate splits a query template into text and blocks. A tag alone on
+// its line takes the whole line with it, so blocks leave no blank lines
+func parseTemplate(query string) ([]templateNode, error) {
+	type frame struct {
+		node *templateNode
+		line int
+		tag  string
+		alt  bool
+	}
+
+	root := &templateNode{}
+	stack := []frame{{node: root}}
+	position := 0
+
+	add := func(node templateNode) *templateNode {
+		top := &stack[len(stack)-1]
+
+		if top.alt {
+			top.node.Otherwise = append(top.node.Otherwise, node)
+			return &top.node.Otherwise[len(top.node.Otherwise)-1]
+		}
+
+		top.node.Body = append(top.node.Body, node)
+		return &top.node.Body[len(top.node.Body)-1]
+	}
+
+	for _, match := range templateTag.FindAllStringSubmatchIndex(query, -1) {
+		start, end := match[0], match[1]
+		line := strings.Count(query[:start], "\n") + 1
+
+		textEnd, next := start, end
+		lineStart := strings.LastIndex(query[:start], "\n") + 1
+		lineEnd := strings.IndexByte(query[end:], '\n')
+
+		if lineEnd < 0 {
+			lineEnd = len(query) - end
+		}
+
+		if lineStart >= position && strings.TrimSpace(query[lineStart:start]) == "" && strings.TrimSpace(query[end:end+lineEnd]) == "" {
+			textEnd = lineStart
+			next = min(end+lineEnd+1, len(query))
+		}
+
+		if textEnd > position {
+			add(templateNode{Kind: templateText, Text: query[position:textEnd]})
+		}
+
+		position = next
+
+		words := strings.Fields(query[match[2]:match[3]])
+		if len(words) == 0 {
+			return nil, fmt.Errorf("line %d: empty tag", line)
+		}
+
+		keyword := strings.ToLower(words[0])
+		argument := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(query[match[2]:match[3]]), words[0]))
+		top := &stack[len(stack)-1]
+
+		switch keyword {
+		case "if":
+			condition, err := parseTemplateCondition(argument)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+
+			stack = append(stack, frame{node: add(templateNode{Kind: templateIf, Condition: condition}), line: line, tag: "if"})
+		case "else":
+			if top.tag != "if" || top.alt {
+				return nil, fmt.Errorf("line %d: {%% else %%} outside of an {%% if %%}", line)
+			}
+
+			top.alt = true
+		case "group":
+			if !placeholderName.MatchString(argument) {
+				return nil, fmt.Errorf("line %d: {%% group %%} needs one placeholder name", line)
+			}
+
+			stack = append(stack, frame{node: add(templateNode{Kind: templateGroup, Key: argument}), line: line, tag: "group"})
+		case "each":
+			if argument != "" {
+				return nil, fmt.Errorf("line %d: {%% each %%} takes no arguments", line)
+			}
+
+			stack = append(stack, frame{node: add(templateNode{Kind: templateEach}), line: line, tag: "each"})
+		case "endif", "endgroup", "endeach":
+			if top.tag != strings.TrimPrefix(keyword, "end") {
+				return nil, fmt.Errorf("line %d: {%% %s %%} without a matching {%% %s %%}", line, keyword, strings.TrimPrefix(keyword, "end"))
+			}
+
+			stack = stack[:len(stack)-1]
+		default:
+			return nil, fmt.Errorf("line %d: unknown tag {%% %s %%}", line, words[0])
+		}
+	}
+
+	if len(stack) > 1 {
+		open := stack[len(stack)-1]
+		return nil, fmt.Errorf("line %d: {%% %s %%} is never closed with {%% end%s %%}", open.line, open.tag, open.tag)
+	}
+
+	if position < len(query) {
+		add(templateNode{Kind: templateText, Text: query[position:]})
+	}
+
+	return root.Body, nil
+}
+
+// tokenizeCondition splits a condition into quoted literals, operators and
+// words, keeping the quotes so literals can be told apart
+func tokenizeCondition(condition string) ([]string, error) {
+	tokens := []string{}
+
+	for i := 0; i < len(condition); {
+		c := condition[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '\'' || c == '"':
+			end := i + 1
+
+			for ; end < len(condition); end++ {
+				if condition[end] == c {
+					if end+1 < len(condition) && condition[end+1] == c {
+						end++
+						continue
+					}
+
+					break
+				}
+			}
+
+			if end >= len(condition) {
+				return nil, fmt.Errorf("unterminated string in %q", condition)
+			}
+
+			tokens = append(tokens, condition[i:end+1])
+			i = end + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			end := i + 1
+			for end < len(condition) && strings.ContainsRune("=!<>", rune(condition[end])) {
+				end++
+			}
+
+			tokens = append(tokens, condition[i:end])
+			i = end
+		default:
+			end := i
+			for end < len(condition) && !strings.ContainsRune(" \t'\"=!<>", rune(condition[end])) {
+				end++
+			}
+
+			tokens = append(tokens, condition[i:end])
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+var templateOperators = map[string]string{
+	"==": "==",
+	"=":  "==",
+	"!=": "!=",
+	"<>": "!=",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+var templateNumber = regexp.MustCompile(`^-?\d+([.,]\d+)?$`)
+
+// parseTemplateCondition reads conditions such as "email",
+// "not email and status == 'paid'" or "total >= 100 or vip"
+func parseTemplateCondition(condition string) (templateCondition, error) {
+	tokens, err := tokenizeCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("{%% if %%} needs a condition")
+	}
+
+	operand := func(token string) (templateOperand, error) {
+		switch {
+		case token[0] == '\'' || token[0] == '"':
+			quote := token[:1]
+			return templateOperand{Value: strings.ReplaceAll(token[1:len(token)-1], quote+quote, quote), Literal: true}, nil
+		case templateNumber.MatchString(token):
+			return templateOperand{Value: token, Literal: true}, nil
+		case placeholderName.MatchString(token):
+			return templateOperand{Value: token}, nil
+		}
+
+		return templateOperand{}, fmt.Errorf("unexpected %q in condition %q", token, condition)
+	}
+
+	parsed := templateCondition{{}}
+	expectComparison := true
+
+	for i := 0; i < len(tokens); i++ {
+		word := strings.ToLower(tokens[i])
+
+		if !expectComparison {
+			switch word {
+			case "and":
+			case "or":
+				parsed = append(parsed, []templateComparison{})
+			default:
+				return nil, fmt.Errorf("expected \"and\" or \"or\" before %q in condition %q", tokens[i], condition)
+			}
+
+			expectComparison = true
+			continue
+		}
+
+		comparison := templateComparison{}
+
+		if word == "not" {
+			comparison.Negate = true
+			i++
+		}
+
+		if i >= len(tokens) {
+			return nil, fmt.Errorf("condition %q ends too early", condition)
+		}
+
+		comparison.Left, err = operand(tokens[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if i+1 < len(tokens) {
+			if operator, ok := templateOperators[tokens[i+1]]; ok {
+				if i+2 >= len(tokens) {
+					return nil, fmt.Errorf("condition %q ends too early", condition)
+				}
+
+				comparison.Operator = operator
+
+				comparison.Right, err = operand(tokens[i+2])
+				if err != nil {
+					return nil, err
+				}
+
+				i += 2
+			} else if strings.ContainsRune("=!<>", rune(tokens[i+1][0])) {
+				return nil, fmt.Errorf("unknown operator %q in condition %q", tokens[i+1], condition)
+			}
+		}
+
+		last := len(parsed) - 1
+		parsed[last] = append(parsed[last], comparison)
+		expectComparison = false
+	}
+
+	if expectComparison {
+		return nil, fmt.Errorf("condition %q ends too early", condition)
+	}
+
+	return parsed, nil
+}
+
+// templateRenderer binds templates to rows with the variables of
+// MakeBindedSQL
+type templateRenderer struct {
+	variables []Variable
+}
+
+// value reads a placeholder of a row, as bound by its variable or straight
+// from the row when no variable has that name
+func (r templateRenderer) value(name string, row map[string]interface{}) string {
+	for _, variable := range r.variables {
+		if variable.Value == name {
+			if value, ok := row[variable.Field]; ok {
+				return cellText(value)
+			}
+		}
+	}
+
+	return cellText(row[name])
+}
+
+// operandValue is the text an operand compares as. Values already written
+// as SQL strings are compared without their quotes
+func (r templateRenderer) operandValue(operand templateOperand, row map[string]interface{}) string {
+	if operand.Literal {
+		return operand.Value
+	}
+
+	value := strings.TrimSpace(r.value(operand.Value, row))
+
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+
+	return value
+}
+
+// compareTemplateValues compares as numbers when both sides are numbers,
+// and as text otherwise
+func compareTemplateValues(left, right string) int {
+	leftNumber, leftErr := parseDecimal(left)
+	rightNumber, rightErr := parseDecimal(right)
+
+	if leftErr == nil && rightErr == nil {
+		return leftNumber.Cmp(rightNumber)
+	}
+
+	return strings.Compare(left, right)
+}
+
+// test evaluates a condition for a row. A value on its own is true unless it
+// is empty, NULL or a word boolean variables read as false
+func (r templateRenderer) test(condition templateCondition, row map[string]interface{}) bool {
+	for _, alternative := range condition {
+		matched := true
+
+		for _, comparison := range alternative {
+			left := r.operandValue(comparison.Left, row)
+			result := false
+
+			switch comparison.Operator {
+			case "":
+				boolean, err := parseBoolean(left)
+				result = left != "" && !strings.EqualFold(left, "NULL") && (err != nil || boolean)
+			case "==":
+				result = compareTemplateValues(left, r.operandValue(comparison.Right, row)) == 0
+			case "!=":
+				result = compareTemplateValues(left, r.operandValue(comparison.Right, row)) != 0
+			case "<":
+				result = compareTemplateValues(left, r.operandValue(comparison.Right, row)) < 0
+			case "<=":
+				result = compareTemplateValues(left, r.operandValue(comparison.Right, row)) <= 0
+			case ">":
+				result = compareTemplateValues(left, r.operandValue(comparison.Right, row)) > 0
+			case ">=":
+				result = compareTemplateValues(left, r.operandValue(comparison.Right, row)) >= 0
+			}
+
+			if result == comparison.Negate {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bindPlaceholders replaces the {{ placeholders }} of text with the values
+// of a row, leaving unknown ones as they are
+func (r templateRenderer) bindPlaceholders(text string, row map[string]interface{}) string {
+	return bindingPlaceholder.ReplaceAllStringFunc(text, func(match string) string {
+		for _, variable := range r.variables {
+			if match == fmt.Sprintf("{{ %s }}", variable.Value) {
+				if value, ok := row[variable.Field]; ok {
+					return fmt.Sprintf("%v", value)
+				}
+			}
+		}
+
+		return match
+	})
+}
+
+// render binds nodes to a set of rows. Text and conditions outside an each
+// see the first row of the set
+func (r templateRenderer) render(nodes []templateNode, rows []map[string]interface{}) string {
+	var result strings.Builder
+
+	for _, node := range nodes {
+		switch node.Kind {
+		case templateText:
+			result.WriteString(r.bindPlaceholders(node.Text, rows[0]))
+		case templateIf:
+			if r.test(node.Condition, rows[0]) {
+				result.WriteString(r.render(node.Body, rows))
+			} else {
+				result.WriteString(r.render(node.Otherwise, rows))
+			}
+		case templateGroup:
+			groups := [][]map[string]interface{}{}
+			positions := make(map[string]int)
+
+			for _, row := range rows {
+				key := r.value(node.Key, row)
+
+				i, ok := positions[key]
+				if !ok {
+					i = len(groups)
+					positions[key] = i
+					groups = append(groups, nil)
+				}
+
+				groups[i] = append(groups[i], row)
+			}
+
+			parts := make([]string, len(groups))
+			for i, group := range groups {
+				parts[i] = r.render(node.Body, group)
+			}
+
+			result.WriteString(joinRendered(parts, true))
+		case templateEach:
+			parts := make([]string, len(rows))
+			for i, row := range rows {
+				parts[i] = r.render(node.Body, []map[string]interface{}{row})
+			}
+
+			result.WriteString(joinRendered(parts, true))
+		}
+	}
+
+	return result.String()
+}
+
+// joinRendered puts renderings on lines of their own, leaving out blank
+// ones. Loops also trim the line breaks around each rendering
+func joinRendered(parts []string, trim bool) string {
+	kept := []string{}
+
+	for _, part := range parts {
+		if trim {
+			part = strings.TrimFunc(part, func(r rune) bool { return r == '\n' || r == '\r' })
+		}
+
+		if strings.TrimFunc(part, unicode.IsSpace) != "" {
+			kept = append(kept, part)
+		}
+	}
+
+	return strings.Join(kept, "\n")
+}
+
+// renderTemplate binds a template to every row. Templates without a group or
+// each at the top are repeated once per row; otherwise they are rendered
+// once and the blocks decide what repeats. Plain templates are repeated
+// exactly as written, as they always were
+func renderTemplate(query string, data []map[string]interface{}, variables []Variable) (string, error) {
+	nodes, err := parseTemplate(query)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) == 0 {
+		return "", nil
+	}
+
+	renderer := templateRenderer{variables: variables}
+	blocks := false
+
+	for _, node := range nodes {
+		if node.Kind == templateGroup || node.Kind == templateEach {
+			return renderer.render(nodes, data), nil
+		}
+
+		blocks = blocks || node.Kind != templateText
+	}
+
+	parts := make([]string, len(data))
+	for i, row := range data {
+		parts[i] = renderer.render(nodes, []map[string]interface{}{row})
+	}
+
+	return joinRendered(parts, blocks), nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplatePlain(t *testing.T) {
+	data := []map[string]interface{}{
+		{"Name": "Ana", "Age": 30},
+		{"Name": "Bia", "Age": 25},
+	}
+	variables := []Variable{{Field: "Name", Value: "name"}, {Field: "Age", Value: "age"}}
+
+	result, err := renderTemplate("INSERT INTO people VALUES ('{{ name }}', {{ age }}, {{ other }});\n", data, variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "INSERT INTO people VALUES ('Ana', 30, {{ other }});\n\nINSERT INTO people VALUES ('Bia', 25, {{ other }});\n"
+	if result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestRenderTemplateConditions(t *testing.T) {
+	query := `{% if email %}
+UPDATE users SET email = {{ email }} WHERE id = {{ id }};
+{% else %}
+-- user {{ id }} has no e-mail
+{% endif %}
+{% if status == 'paid' and total >= 1000 or vip %}UPDATE users SET tier = 'gold' WHERE id = {{ id }};{% endif %}`
+
+	data := []map[string]interface{}{
+		{"id": "1", "email": "'ana@example.com'", "status": "'paid'", "total": "1.234,50", "vip": "0"},
+		{"id": "2", "email": "NULL", "status": "'paid'", "total": "999", "vip": "não"},
+		{"id": "3", "email": "''", "status": "'open'", "total": "10", "vip": "sim"},
+	}
+	variables := []Variable{
+		{Field: "id", Value: "id"},
+		{Field: "email", Value: "email"},
+		{Field: "status", Value: "status"},
+		{Field: "total", Value: "total"},
+		{Field: "vip", Value: "vip"},
+	}
+
+	result, err := renderTemplate(query, data, variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"UPDATE users SET email = 'ana@example.com' WHERE id = 1;",
+		"UPDATE users SET tier = 'gold' WHERE id = 1;",
+		"-- user 2 has no e-mail",
+		"-- user 3 has no e-mail",
+		"UPDATE users SET tier = 'gold' WHERE id = 3;",
+	}, "\n")
+
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	result, err = renderTemplate("{% if not name %}skip{% else %}{{ name }}{% endif %}", []map[string]interface{}{{"Name": "Ana"}, {}}, []Variable{{Field: "Name", Value: "name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != "Ana\nskip" {
+		t.Errorf("unexpected negated result %q", result)
+	}
+
+	result, err = renderTemplate("{% if id == 9007199254740993 %}match{% else %}other{% endif %}", []map[string]interface{}{{"id": "9007199254740993"}, {"id": "9007199254740992"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != "match\nother" {
+		t.Errorf("expected large numbers to compare exactly, got %q", result)
+	}
+}
+
+func TestRenderTemplateGroups(t *testing.T) {
+	query := `-- orders
+{% group customer_id %}
+INSERT INTO orders (customer_id) VALUES ({{ customer_id }});
+{% each %}
+{% if quantity > 0 %}
+INSERT INTO order_items (order_id, sku, quantity) VALUES (LAST_INSERT_ID(), '{{ sku }}', {{ quantity }});
+{% endif %}
+{% endeach %}
+{% endgroup %}`
+
+	data := []map[string]interface{}{
+		{"Customer": 10, "SKU": "A1", "Qty": 2},
+		{"Customer": 20, "SKU": "B1", "Qty": 1},
+		{"Customer": 10, "SKU": "A2", "Qty": 0},
+		{"Customer": 10, "SKU": "A3", "Qty": 5},
+	}
+	variables := []Variable{
+		{Field: "Customer", Value: "customer_id"},
+		{Field: "SKU", Value: "sku"},
+		{Field: "Qty", Value: "quantity"},
+	}
+
+	result, err := renderTemplate(query, data, variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"-- orders",
+		"INSERT INTO orders (customer_id) VALUES (10);",
+		"INSERT INTO order_items (order_id, sku, quantity) VALUES (LAST_INSERT_ID(), 'A1', 2);",
+		"INSERT INTO order_items (order_id, sku, quantity) VALUES (LAST_INSERT_ID(), 'A3', 5);",
+		"INSERT INTO orders (customer_id) VALUES (20);",
+		"INSERT INTO order_items (order_id, sku, quantity) VALUES (LAST_INSERT_ID(), 'B1', 1);",
+	}, "\n")
+
+	if result != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, result)
+	}
+
+	minified, err := NewApp().MakeBindedSQL(query, data[:1], variables, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(minified, "\n") || !strings.HasPrefix(minified, "-- orders INSERT INTO orders") {
+		t.Errorf("unexpected minified SQL %q", minified)
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	cases := map[string]string{
+		"{% if email %}\nSELECT 1;":                    "line 1: {% if %} is never closed",
+		"SELECT 1;\n{% endif %}":                       "line 2: {% endif %} without a matching {% if %}",
+		"{% if a %}x{% else %}y{% else %}z{% endif %}": "{% else %} outside of an {% if %}",
+		"{% group a %}x{% endif %}":                    "{% endif %} without a matching {% if %}",
+		"{% for row in rows %}":                        "unknown tag {% for %}",
+		"{% if a == %}x{% endif %}":                    "ends too early",
+		"{% if a => 1 %}x{% endif %}":                  "unknown operator \"=>\"",
+		"{% if a b %}x{% endif %}":                     `expected "and" or "or"`,
+		"{% if a == 'x %}x{% endif %}":                 "unterminated string",
+		"{% group %}x{% endgroup %}":                   "needs one placeholder name",
+		"{% each rows %}x{% endeach %}":                "takes no arguments",
+	}
+
+	for query, message := range cases {
+		_, err := parseTemplate(query)
+
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q: expected an error about %q, got %v", query, message, err)
+		}
+	}
+}
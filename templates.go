@@ -0,0 +1,464 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"sql_script_maker/schema"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Types of QueryVariable, deciding how a spreadsheet value is written into
+// the SQL. Raw values are inserted exactly as read
+const (
+	VariableRaw     = "raw"
+	VariableString  = "string"
+	VariableNumber  = "number"
+	VariableDate    = "date"
+	VariableBoolean = "boolean"
+)
+
+var variableTypes = map[string]bool{
+	VariableRaw:     true,
+	VariableString:  true,
+	VariableNumber:  true,
+	VariableDate:    true,
+	VariableBoolean: true,
+}
+
+var placeholderName = regexp.MustCompile(`^\w+$`)
+
+// QueryVariable binds the {{ Placeholder }} of a saved query to a
+// spreadsheet column. Default is used when the cell is empty or the column
+// is missing
+type QueryVariable struct {
+	Field       string
+	Placeholder string
+	Type        string
+	Default     string
+	Position    int
+}
+
+// DataSource remembers which spreadsheet a saved query was last bound to
+type DataSource struct {
+	Path  string
+	Sheet string
+}
+
+// QueryTemplate is what a saved query needs to be bound again in one step
+type QueryTemplate struct {
+	Variables  []QueryVariable
+	DataSource DataSource
+}
+
+// TemplateBinding is the result of binding a saved query to a spreadsheet.
+// Problems lists values that could not be converted to their variable type;
+// those are written as NULL
+type TemplateBinding struct {
+	SQL           string
+	File          string
+	Sheet         string
+	Rows          int
+	MissingFields []string
+	Problems      []string
+}
+
+// GetQueryTemplate returns the variables and data source saved with a query
+func (a *App) GetQueryTemplate(queryID int) (QueryTemplate, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return loadQueryTemplate(db, queryID)
+}
+
+func loadQueryTemplate(db *sql.DB, queryID int) (QueryTemplate, error) {
+	template := QueryTemplate{Variables: []QueryVariable{}}
+
+	var dataSource string
+
+	err := db.QueryRow("SELECT data_source FROM queries WHERE id = ?", queryID).Scan(&dataSource)
+	if err == sql.ErrNoRows {
+		return template, fmt.Errorf("query not found")
+	}
+
+	if err != nil {
+		return template, err
+	}
+
+	if dataSource != "" {
+		err = json.Unmarshal([]byte(dataSource), &template.DataSource)
+		if err != nil {
+			return template, fmt.Errorf("invalid data source saved with query %d: %w", queryID, err)
+		}
+	}
+
+	rows, err := db.Query("SELECT field, placeholder, type, default_value, position FROM query_variables WHERE query_id = ? ORDER BY position, id", queryID)
+	if err != nil {
+		return template, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variable QueryVariable
+
+		err = rows.Scan(&variable.Field, &variable.Placeholder, &variable.Type, &variable.Default, &variable.Position)
+		if err != nil {
+			return template, err
+		}
+
+		template.Variables = append(template.Variables, variable)
+	}
+
+	return template, rows.Err()
+}
+
+// SaveQueryTemplate replaces the variables and data source of a query
+func (a *App) SaveQueryTemplate(queryID int, template QueryTemplate) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return saveQueryTemplate(db, queryID, template)
+}
+
+func saveQueryTemplate(db *sql.DB, queryID int, template QueryTemplate) error {
+	seen := make(map[string]bool)
+
+	for i := range template.Variables {
+		variable := &template.Variables[i]
+
+		variable.Placeholder = strings.TrimSpace(variable.Placeholder)
+		variable.Field = strings.TrimSpace(variable.Field)
+
+		if variable.Type == "" {
+			variable.Type = VariableRaw
+		}
+
+		if !placeholderName.MatchString(variable.Placeholder) {
+			return fmt.Errorf("invalid placeholder %q: use letters, digits and underscores", variable.Placeholder)
+		}
+
+		if seen[variable.Placeholder] {
+			return fmt.Errorf("placeholder %q is defined twice", variable.Placeholder)
+		}
+
+		if !variableTypes[variable.Type] {
+			return fmt.Errorf("unknown type %q for placeholder %q", variable.Type, variable.Placeholder)
+		}
+
+		if variable.Field == "" && variable.Default == "" {
+			return fmt.Errorf("placeholder %q needs a column or a default value", variable.Placeholder)
+		}
+
+		seen[variable.Placeholder] = true
+	}
+
+	dataSource := ""
+
+	if template.DataSource.Path != "" {
+		encoded, err := json.Marshal(template.DataSource)
+		if err != nil {
+			return err
+		}
+
+		dataSource = string(encoded)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE queries SET data_source = ? WHERE id = ?", dataSource, queryID)
+	if err != nil {
+		return err
+	}
+
+	err = expectAffected(result, "query not found")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM query_variables WHERE query_id = ?", queryID)
+	if err != nil {
+		return err
+	}
+
+	for i, variable := range template.Variables {
+		_, err = tx.Exec("INSERT INTO query_variables (query_id, position, field, placeholder, type, default_value) VALUES (?, ?, ?, ?, ?, ?)",
+			queryID, i, variable.Field, variable.Placeholder, variable.Type, variable.Default)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// BindQueryTemplate asks for a spreadsheet, starting where the query was
+// last bound, and generates the SQL of a saved query for it with the saved
+// variables. The chosen file becomes the remembered data source
+func (a *App) BindQueryTemplate(queryID int, minify bool) (TemplateBinding, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	template, err := loadQueryTemplate(db, queryID)
+	if err != nil {
+		return TemplateBinding{}, err
+	}
+
+	options := runtime.OpenDialogOptions{
+		Title:   "Select File",
+		Filters: xlsxFileFilters,
+	}
+
+	if template.DataSource.Path != "" {
+		options.DefaultDirectory = filepath.Dir(template.DataSource.Path)
+		options.DefaultFilename = filepath.Base(template.DataSource.Path)
+	}
+
+	selection, err := runtime.OpenFileDialog(a.ctx, options)
+	if err != nil {
+		return TemplateBinding{}, err
+	}
+
+	if selection == "" {
+		return TemplateBinding{}, fmt.Errorf("no file selected")
+	}
+
+	binding, err := a.bindQueryTemplate(db, queryID, template, selection, minify)
+	if err != nil {
+		return binding, err
+	}
+
+	template.DataSource = DataSource{Path: selection, Sheet: binding.Sheet}
+
+	return binding, saveQueryTemplate(db, queryID, template)
+}
+
+func (a *App) bindQueryTemplate(db *sql.DB, queryID int, template QueryTemplate, path string, minify bool) (TemplateBinding, error) {
+	binding := TemplateBinding{File: path, MissingFields: []string{}, Problems: []string{}}
+
+	var query sql.NullString
+
+	err := db.QueryRow("SELECT query FROM queries WHERE id = ?", queryID).Scan(&query)
+	if err != nil {
+		return binding, err
+	}
+
+	sheet, err := readSpreadsheet(path, template.DataSource.Sheet)
+	if err != nil {
+		return binding, err
+	}
+
+	binding.Sheet = sheet.Sheet
+	binding.Rows = len(sheet.Rows)
+
+	headers := make(map[string]bool, len(sheet.Headers))
+	for _, header := range sheet.Headers {
+		headers[header] = true
+	}
+
+	for _, variable := range template.Variables {
+		if variable.Field != "" && !headers[variable.Field] {
+			binding.MissingFields = append(binding.MissingFields, variable.Field)
+		}
+	}
+
+	data := make([]map[string]interface{}, len(sheet.Rows))
+	variables := make([]Variable, len(template.Variables))
+
+	for i, variable := range template.Variables {
+		variables[i] = Variable{Field: variable.Placeholder, Value: variable.Placeholder, Position: i}
+	}
+
+	for i, row := range sheet.Rows {
+		data[i] = make(map[string]interface{}, len(template.Variables))
+
+		for _, variable := range template.Variables {
+			value, err := formatVariable(variable, row[variable.Field])
+
+			if err != nil {
+				binding.Problems = append(binding.Problems, fmt.Sprintf("row %d, %s: %v", sheet.Lines[i], variable.Field, err))
+			}
+
+			data[i][variable.Placeholder] = value
+		}
+	}
+
+	binding.SQL, err = a.MakeBindedSQL(query.String, data, variables, minify)
+
+	return binding, err
+}
+
+// formatVariable turns a cell into SQL for the type of variable. Values
+// that do not convert become NULL and the error says why
+func formatVariable(variable QueryVariable, value string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		value = variable.Default
+	}
+
+	trimmed := strings.TrimSpace(value)
+
+	switch variable.Type {
+	case VariableString:
+		return schema.QuoteString(schema.DialectMySQL, value), nil
+	case VariableNumber:
+		if trimmed == "" {
+			return "NULL", nil
+		}
+
+		number, err := parseDecimal(trimmed)
+		if err != nil {
+			return "NULL", err
+		}
+
+		return decimalText(number), nil
+	case VariableDate:
+		if trimmed == "" {
+			return "NULL", nil
+		}
+
+		date, err := parseSpreadsheetDate(trimmed)
+		if err != nil {
+			return "NULL", err
+		}
+
+		if date.Hour() == 0 && date.Minute() == 0 && date.Second() == 0 {
+			return date.Format("'2006-01-02'"), nil
+		}
+
+		return date.Format("'2006-01-02 15:04:05'"), nil
+	case VariableBoolean:
+		if trimmed == "" {
+			return "NULL", nil
+		}
+
+		boolean, err := parseBoolean(trimmed)
+		if err != nil {
+			return "NULL", err
+		}
+
+		if boolean {
+			return "1", nil
+		}
+
+		return "0", nil
+	default:
+		return value, nil
+	}
+}
+
+// parseBoolean reads the words used for yes and no in spreadsheets, in
+// English and Portuguese
+func parseBoolean(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "y", "sim", "s", "x":
+		return true, nil
+	case "0", "false", "no", "n", "não", "nao":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("%q is not a boolean", value)
+}
+
+// normalizeDecimal accepts both 1,234.5 and 1.234,5: whichever separator
+// comes last is the decimal one, and a lone comma is a decimal comma
+func normalizeDecimal(value string) string {
+	comma := strings.LastIndex(value, ",")
+	dot := strings.LastIndex(value, ".")
+
+	if comma > dot {
+		return strings.Replace(strings.ReplaceAll(value, ".", ""), ",", ".", 1)
+	}
+
+	return strings.ReplaceAll(value, ",", "")
+}
+
+var decimalNumber = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE]([+-]?\d+))?$`)
+
+// parseDecimal reads a number in either decimal convention exactly, so long
+// IDs and amounts keep every digit they were typed with. Exponents are
+// limited to the range of a double, as spreadsheets write them
+func parseDecimal(value string) (*big.Rat, error) {
+	normalized := normalizeDecimal(strings.TrimSpace(value))
+
+	match := decimalNumber.FindStringSubmatch(normalized)
+	if match == nil {
+		return nil, fmt.Errorf("%q is not a number", value)
+	}
+
+	if match[4] != "" {
+		exponent, err := strconv.Atoi(match[4])
+		if err != nil || exponent > 308 || exponent < -308 {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+	}
+
+	number, ok := new(big.Rat).SetString(normalized)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a number", value)
+	}
+
+	return number, nil
+}
+
+// decimalText writes a number read by parseDecimal as a plain SQL literal,
+// without exponent or trailing zeros
+func decimalText(number *big.Rat) string {
+	places := 0
+	scaled := new(big.Rat).Set(number)
+	ten := big.NewRat(10, 1)
+
+	for !scaled.IsInt() {
+		scaled.Mul(scaled, ten)
+		places++
+	}
+
+	return number.FloatString(places)
+}
+
+// Date layouts accepted from spreadsheets. Day-first layouts come before
+// month-first ones, as in the locale the app is mostly used in
+var spreadsheetDateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05Z07:00",
+	"02/01/2006",
+	"2/1/2006",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"01-02-06",
+	"1/2/06",
+	"1/2/06 15:04",
+}
+
+// parseSpreadsheetDate reads a date as formatted by excelize or typed by
+// hand. Plain numbers are Excel serial dates
+func parseSpreadsheetDate(value string) (time.Time, error) {
+	for _, layout := range spreadsheetDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 && serial < 2958466 {
+		// Excel counts days from 1899-12-30, including its 1900 leap day bug
+		epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		days := math.Floor(serial)
+		seconds := math.Round((serial - days) * 86400)
+
+		return epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second), nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a date", value)
+}
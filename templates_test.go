@@ -0,0 +1,165 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// writeSpreadsheet saves rows, the first being the header, to a new XLSX file
+func writeSpreadsheet(t *testing.T, sheet string, rows [][]interface{}) string {
+	t.Helper()
+
+	file := excelize.NewFile()
+	defer file.Close()
+
+	if sheet != "Sheet1" {
+		file.SetSheetName("Sheet1", sheet)
+	}
+
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+
+		if err := file.SetSheetRow(sheet, cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "data.xlsx")
+
+	if err := file.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestFormatVariable(t *testing.T) {
+	cases := []struct {
+		variable QueryVariable
+		value    string
+		expected string
+		fails    bool
+	}{
+		{QueryVariable{Type: VariableRaw}, "NOW()", "NOW()", false},
+		{QueryVariable{Type: VariableString}, "O'Brien", "'O''Brien'", false},
+		{QueryVariable{Type: VariableString, Default: "n/a"}, " ", "'n/a'", false},
+		{QueryVariable{Type: VariableNumber}, "1.234,50", "1234.5", false},
+		{QueryVariable{Type: VariableNumber}, "1,234.50", "1234.5", false},
+		{QueryVariable{Type: VariableNumber}, "", "NULL", false},
+		{QueryVariable{Type: VariableNumber}, "abc", "NULL", true},
+		{QueryVariable{Type: VariableNumber}, "9007199254740993", "9007199254740993", false},
+		{QueryVariable{Type: VariableNumber}, "12345678901234567.89", "12345678901234567.89", false},
+		{QueryVariable{Type: VariableNumber}, "-0,50", "-0.5", false},
+		{QueryVariable{Type: VariableNumber}, "007", "7", false},
+		{QueryVariable{Type: VariableNumber}, "1.5E+3", "1500", false},
+		{QueryVariable{Type: VariableNumber}, "1e400", "NULL", true},
+		{QueryVariable{Type: VariableNumber}, "1/3", "NULL", true},
+		{QueryVariable{Type: VariableString}, `C:\temp\`, `'C:\\temp\\'`, false},
+		{QueryVariable{Type: VariableDate}, "31/12/2024", "'2024-12-31'", false},
+		{QueryVariable{Type: VariableDate}, "45657", "'2024-12-31'", false},
+		{QueryVariable{Type: VariableDate}, "2024-12-31 08:30:00", "'2024-12-31 08:30:00'", false},
+		{QueryVariable{Type: VariableDate}, "someday", "NULL", true},
+		{QueryVariable{Type: VariableBoolean}, "Sim", "1", false},
+		{QueryVariable{Type: VariableBoolean, Default: "false"}, "", "0", false},
+		{QueryVariable{Type: VariableBoolean}, "maybe", "NULL", true},
+	}
+
+	for _, c := range cases {
+		value, err := formatVariable(c.variable, c.value)
+
+		if value != c.expected || (err != nil) != c.fails {
+			t.Errorf("%s %q: expected %s (fails %v), got %s (%v)", c.variable.Type, c.value, c.expected, c.fails, value, err)
+		}
+	}
+}
+
+func TestQueryTemplates(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+
+	err := app.InsertQueryInDatabase(Query{
+		Title: "Import users",
+		Query: "INSERT INTO users (name, age, active, source) VALUES ({{ name }}, {{ age }}, {{ active }}, {{ source }});",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := QueryTemplate{
+		Variables: []QueryVariable{
+			{Field: " Name ", Placeholder: "name", Type: VariableString},
+			{Field: "Age", Placeholder: "age", Type: VariableNumber},
+			{Field: "Active", Placeholder: "active", Type: VariableBoolean, Default: "yes"},
+			{Placeholder: "source", Type: VariableString, Default: "sheet"},
+		},
+		DataSource: DataSource{Path: "/old/users.xlsx", Sheet: "Users"},
+	}
+
+	if err := app.SaveQueryTemplate(1, template); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []QueryVariable{
+		{Field: "Name", Placeholder: "{{ name }}"},
+		{Field: "Name", Placeholder: "name", Type: "json"},
+		{Placeholder: "name"},
+	}
+
+	for _, variable := range invalid {
+		if err := app.SaveQueryTemplate(1, QueryTemplate{Variables: []QueryVariable{variable}}); err == nil {
+			t.Errorf("expected %+v to be rejected", variable)
+		}
+	}
+
+	saved, err := app.GetQueryTemplate(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved.Variables) != 4 || saved.Variables[0].Field != "Name" || saved.Variables[3].Default != "sheet" || saved.DataSource.Sheet != "Users" {
+		t.Fatalf("unexpected template %+v", saved)
+	}
+
+	path := writeSpreadsheet(t, "Users", [][]interface{}{
+		{"Name", "Age", "Active"},
+		{"Ana", 34, "no"},
+		{"João d'Ávila", "x", ""},
+	})
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	binding, err := app.bindQueryTemplate(db, 1, saved, path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "INSERT INTO users (name, age, active, source) VALUES ('Ana', 34, 0, 'sheet');\n" +
+		"INSERT INTO users (name, age, active, source) VALUES ('João d''Ávila', NULL, 1, 'sheet');"
+
+	if binding.SQL != expected {
+		t.Errorf("unexpected SQL:\n%s", binding.SQL)
+	}
+
+	if binding.Rows != 2 || binding.Sheet != "Users" || len(binding.MissingFields) != 0 {
+		t.Errorf("unexpected binding %+v", binding)
+	}
+
+	if len(binding.Problems) != 1 || binding.Problems[0] != `row 3, Age: "x" is not a number` {
+		t.Errorf("unexpected problems %v", binding.Problems)
+	}
+
+	// A file without the remembered sheet or a mapped column still binds
+	other := writeSpreadsheet(t, "Sheet1", [][]interface{}{{"Name"}, {"Bia"}})
+
+	binding, err = app.bindQueryTemplate(db, 1, saved, other, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if binding.Sheet != "Sheet1" || len(binding.MissingFields) != 2 {
+		t.Errorf("expected the first sheet and two missing columns, got %+v", binding)
+	}
+}
@@ -0,0 +1,39 @@
+-- A database.db as created by releases before schema_migrations existed
+CREATE TABLE queries (
+	id integer NOT NULL PRIMARY KEY,
+	title TEXT,
+	query TEXT,
+	description TEXT DEFAULT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	deleted_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE TABLE database_connections (
+	id integer NOT NULL PRIMARY KEY,
+	username TEXT,
+	password TEXT,
+	host TEXT,
+	port INTEGER,
+	database TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	deleted_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE TABLE database_structure (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	structure TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO queries (id, title, query, description) VALUES
+	(1, 'Insert users', 'INSERT INTO users (name) VALUES ({{ name }});', 'Bulk user import'),
+	(2, 'Old query', 'DELETE FROM logs;', NULL);
+
+UPDATE queries SET deleted_at = '2024-01-01 00:00:00' WHERE id = 2;
+
+INSERT INTO database_connections (id, username, password, host, port, database) VALUES
+	(1, 'root', 'secret', 'localhost', 3306, 'shop');
+
+INSERT INTO database_structure (structure) VALUES ('{"dbType":"mysql","tables":[]}');
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// defaultTrashRetentionDays keeps deleted queries until a retention is set,
+// so nothing is purged without the user asking for it
+const defaultTrashRetentionDays = 0
+
+// purgeQueries permanently removes the trashed queries matching condition,
+// together with their tags, revisions, variables and shared library files
+func purgeQueries(tx *sql.Tx, condition string, args ...interface{}) (int, error) {
+	selected := "SELECT id FROM queries WHERE deleted_at IS NOT NULL AND " + condition
+
+	for _, dependent := range []string{"query_tags", "query_revisions", "query_variables", "query_parameters", "shared_library_files"} {
+		_, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE query_id IN (%s)", dependent, selected), args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM queries WHERE deleted_at IS NOT NULL AND "+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+
+	return int(purged), err
+}
+
+func purgeQueriesInTransaction(db *sql.DB, condition string, args ...interface{}) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	purged, err := purgeQueries(tx, condition, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
+
+// purgeExpiredQueries removes queries that have been in the trash longer
+// than the retention of the library. A retention of 0 keeps them forever
+func purgeExpiredQueries(db *sql.DB) (int, error) {
+	days, err := getIntSetting(db, settingTrashRetentionDays, defaultTrashRetentionDays)
+	if err != nil || days <= 0 {
+		return 0, err
+	}
+
+	return purgeQueriesInTransaction(db, "deleted_at < datetime('now', ?)", fmt.Sprintf("-%d days", days))
+}
+
+// purgeExpiredQueriesOnOpen applies the trash retention when a library is
+// opened. Failing to purge never prevents the library from opening
+func purgeExpiredQueriesOnOpen() {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	purged, err := purgeExpiredQueries(db)
+
+	if err != nil {
+		log.Printf("failed to purge the trash: %v", err)
+	}
+
+	if purged > 0 {
+		log.Printf("purged %d queries past the trash retention", purged)
+	}
+}
+
+// RestoreQuery takes a query out of the trash
+func (a *App) RestoreQuery(id int) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	result, err := db.Exec("UPDATE queries SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, "query not found in the trash")
+}
+
+// DeleteQueryPermanently removes a trashed query with its tags and revisions.
+// Queries have to be moved to the trash with DeleteQuery first
+func (a *App) DeleteQueryPermanently(id int) error {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	purged, err := purgeQueriesInTransaction(db, "id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if purged == 0 {
+		return fmt.Errorf("query not found in the trash")
+	}
+
+	return nil
+}
+
+// EmptyTrash permanently removes every trashed query and returns how many
+// were removed
+func (a *App) EmptyTrash() (int, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return purgeQueriesInTransaction(db, "1 = 1")
+}
+
+// GetTrashRetentionDays returns how many days deleted queries are kept
+// before being purged, 0 meaning forever
+func (a *App) GetTrashRetentionDays() (int, error) {
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return getIntSetting(db, settingTrashRetentionDays, defaultTrashRetentionDays)
+}
+
+// SetTrashRetentionDays changes the trash retention, 0 keeping deleted
+// queries forever. It takes effect the next time the library is opened
+func (a *App) SetTrashRetentionDays(days int) error {
+	if days < 0 {
+		return fmt.Errorf("the retention cannot be negative")
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	return setSetting(db, settingTrashRetentionDays, fmt.Sprint(days))
+}
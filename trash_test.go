@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTrash(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+
+	for _, title := range []string{"Kept", "Restored", "Purged", "Emptied"} {
+		if err := app.InsertQueryInDatabase(Query{Title: title, Query: "SELECT 1", Tags: []string{"old"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for id := 2; id <= 4; id++ {
+		if err := app.DeleteQuery(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := app.DeleteQuery(2); err == nil {
+		t.Error("expected deleting a trashed query again to fail")
+	}
+
+	if err := app.DeleteQueryPermanently(1); err == nil {
+		t.Error("expected permanently deleting an active query to fail")
+	}
+
+	if err := app.RestoreQuery(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.RestoreQuery(2); err == nil {
+		t.Error("expected restoring an active query to fail")
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	// Mappings of purged queries must not be picked up by a new query reusing the rowid
+	for id := 3; id <= 4; id++ {
+		if _, err := db.Exec("INSERT INTO shared_library_files (path, query_id, file_hash, query_hash) VALUES (?, ?, '', '')", fmt.Sprintf("query-%d.sql", id), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := app.DeleteQueryPermanently(3); err != nil {
+		t.Fatal(err)
+	}
+
+	emptied, err := app.EmptyTrash()
+	if err != nil || emptied != 1 {
+		t.Errorf("expected one query emptied from the trash, got %d (%v)", emptied, err)
+	}
+
+	queries, err := app.GetQueriesList(true, QueryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if titles := queryTitles(queries); titles != "Kept,Restored" {
+		t.Errorf("expected only the active queries to remain, got %s", titles)
+	}
+
+	var leftovers int
+	db.QueryRow("SELECT (SELECT COUNT(*) FROM query_tags WHERE query_id > 2) + (SELECT COUNT(*) FROM query_revisions WHERE query_id > 2) + (SELECT COUNT(*) FROM shared_library_files)").Scan(&leftovers)
+
+	if leftovers != 0 {
+		t.Errorf("expected tags, revisions and shared library files of purged queries to be removed, %d left", leftovers)
+	}
+}
+
+func TestPurgeExpiredQueries(t *testing.T) {
+	useTemporaryLibrary(t)
+	app := NewApp()
+
+	for _, title := range []string{"Recent", "Expired", "Active"} {
+		if err := app.InsertQueryInDatabase(Query{Title: title, Query: "SELECT 1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := openSqliteConnection()
+	defer db.Close()
+
+	_, err := db.Exec(`
+		UPDATE queries SET deleted_at = datetime('now', '-2 days') WHERE id = 1;
+		UPDATE queries SET deleted_at = datetime('now', '-40 days') WHERE id = 2;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if days, err := app.GetTrashRetentionDays(); err != nil || days != 0 {
+		t.Errorf("expected the trash to be kept forever by default, got %d (%v)", days, err)
+	}
+
+	if purged, err := purgeExpiredQueries(db); err != nil || purged != 0 {
+		t.Errorf("expected an unset retention to purge nothing, got %d purged (%v)", purged, err)
+	}
+
+	if err := app.SetTrashRetentionDays(30); err != nil {
+		t.Fatal(err)
+	}
+
+	if purged, err := purgeExpiredQueries(db); err != nil || purged != 1 {
+		t.Errorf("expected the expired query to be purged, got %d (%v)", purged, err)
+	}
+
+	if err := app.SetTrashRetentionDays(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("UPDATE queries SET deleted_at = datetime('now', '-400 days') WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if purged, err := purgeExpiredQueries(db); err != nil || purged != 0 {
+		t.Errorf("expected a retention of 0 to keep the trash, got %d purged (%v)", purged, err)
+	}
+
+	if err := app.SetTrashRetentionDays(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if purged, err := purgeExpiredQueries(db); err != nil || purged != 1 {
+		t.Errorf("expected the shorter retention to apply, got %d purged (%v)", purged, err)
+	}
+
+	if err := app.SetTrashRetentionDays(-1); err == nil {
+		t.Error("expected a negative retention to be rejected")
+	}
+}
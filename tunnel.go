@@ -0,0 +1,400 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	rntm "runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const sshDialTimeout = 15 * time.Second
+
+// sshAgentSupported tells whether the agent can be reached through the unix
+// socket in SSH_AUTH_SOCK. The Windows OpenSSH agent listens on a named pipe
+var sshAgentSupported = rntm.GOOS != "windows"
+
+// sshTunnel forwards connections accepted on a local port to the database
+// through an SSH jump host. The local port stays the same when the SSH
+// connection drops and is re-established, so pooled DSNs remain valid
+type sshTunnel struct {
+	mu          sync.Mutex
+	fingerprint string
+	jumpAddr    string
+	remoteAddr  string
+	config      *ssh.ClientConfig
+	client      *ssh.Client
+	agentConn   net.Conn
+	listener    net.Listener
+	closed      bool
+}
+
+// tunnelManager keeps one tunnel per connection profile
+type tunnelManager struct {
+	mu      sync.Mutex
+	tunnels map[string]*sshTunnel
+}
+
+func newTunnelManager() *tunnelManager {
+	return &tunnelManager{
+		tunnels: make(map[string]*sshTunnel),
+	}
+}
+
+// LocalAddr returns the local address the MySQL driver should dial for the
+// profile, opening the tunnel on first use
+func (m *tunnelManager) LocalAddr(input DatabaseConnection) (string, error) {
+	key := profileKey(input)
+	fingerprint := tunnelFingerprint(input)
+
+	m.mu.Lock()
+	if tunnel, ok := m.tunnels[key]; ok {
+		if tunnel.fingerprint == fingerprint {
+			m.mu.Unlock()
+			return tunnel.listener.Addr().String(), nil
+		}
+
+		tunnel.Close()
+		delete(m.tunnels, key)
+	}
+	m.mu.Unlock()
+
+	// The tunnel is opened without holding the lock, so a slow or
+	// unreachable jump host doesn't block every other profile
+	tunnel, err := openSSHTunnel(input, fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Another caller may have opened a tunnel for the profile meanwhile
+	if existing, ok := m.tunnels[key]; ok {
+		if existing.fingerprint == fingerprint {
+			tunnel.Close()
+			return existing.listener.Addr().String(), nil
+		}
+
+		existing.Close()
+	}
+
+	m.tunnels[key] = tunnel
+
+	return tunnel.listener.Addr().String(), nil
+}
+
+// openSSHTunnel connects to the jump host and starts listening on a local port
+func openSSHTunnel(input DatabaseConnection, fingerprint string) (*sshTunnel, error) {
+	config, agentConn, err := sshClientConfig(input)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnel := &sshTunnel{
+		fingerprint: fingerprint,
+		jumpAddr:    net.JoinHostPort(input.SSHHost, strconv.Itoa(sshPort(input))),
+		remoteAddr:  net.JoinHostPort(input.Host, strconv.Itoa(input.Port)),
+		config:      config,
+		agentConn:   agentConn,
+	}
+
+	// Connect eagerly so authentication problems surface immediately
+	// instead of as an opaque driver error on the first query
+	_, err = tunnel.sshClient()
+	if err != nil {
+		tunnel.Close()
+		return nil, err
+	}
+
+	tunnel.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tunnel.Close()
+		return nil, fmt.Errorf("failed to open local tunnel port: %w", err)
+	}
+
+	go tunnel.serve()
+
+	return tunnel, nil
+}
+
+// Close shuts the tunnel for the profile down
+func (m *tunnelManager) Close(input DatabaseConnection) {
+	key := profileKey(input)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tunnel, ok := m.tunnels[key]; ok {
+		tunnel.Close()
+		delete(m.tunnels, key)
+	}
+}
+
+// CloseAll shuts every tunnel down
+func (m *tunnelManager) CloseAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, tunnel := range m.tunnels {
+		tunnel.Close()
+		delete(m.tunnels, key)
+	}
+}
+
+func (t *sshTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			t.mu.Lock()
+			closed := t.closed
+			t.mu.Unlock()
+
+			if !closed {
+				log.Printf("ssh tunnel to %s stopped accepting: %v", t.remoteAddr, err)
+			}
+			return
+		}
+
+		go t.forward(local)
+	}
+}
+
+func (t *sshTunnel) forward(local net.Conn) {
+	remote, err := t.dialRemote()
+	if err != nil {
+		log.Printf("ssh tunnel to %s: %v", t.remoteAddr, err)
+		local.Close()
+		return
+	}
+
+	go func() {
+		io.Copy(remote, local)
+		remote.Close()
+	}()
+
+	io.Copy(local, remote)
+	local.Close()
+}
+
+// dialRemote opens a channel to the database through the jump host. If the
+// SSH connection went away it reconnects once before giving up
+func (t *sshTunnel) dialRemote() (net.Conn, error) {
+	client, err := t.sshClient()
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := client.Dial("tcp", t.remoteAddr)
+	if err == nil {
+		return remote, nil
+	}
+
+	t.dropClient(client)
+
+	client, err = t.sshClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Dial("tcp", t.remoteAddr)
+}
+
+// sshClient returns the live SSH connection, dialing a new one when needed.
+// The lock is only taken to look at and swap in the client, so a slow jump
+// host doesn't hold up Close and everything waiting on it
+func (t *sshTunnel) sshClient() (*ssh.Client, error) {
+	t.mu.Lock()
+	closed, current := t.closed, t.client
+	t.mu.Unlock()
+
+	if closed {
+		return nil, fmt.Errorf("ssh tunnel is closed")
+	}
+
+	if current != nil {
+		return current, nil
+	}
+
+	client, err := ssh.Dial("tcp", t.jumpAddr, t.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH host %s: %w", t.jumpAddr, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		client.Close()
+		return nil, fmt.Errorf("ssh tunnel is closed")
+	}
+
+	// Another forwarded connection reconnected first
+	if t.client != nil {
+		client.Close()
+		return t.client, nil
+	}
+
+	t.client = client
+
+	// Forget the client as soon as the connection dies so the next
+	// forwarded connection triggers a reconnect
+	go func() {
+		client.Wait()
+		t.dropClient(client)
+	}()
+
+	return client, nil
+}
+
+func (t *sshTunnel) dropClient(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == client {
+		t.client.Close()
+		t.client = nil
+	}
+}
+
+func (t *sshTunnel) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+
+	if t.listener != nil {
+		t.listener.Close()
+	}
+
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+
+	if t.agentConn != nil {
+		t.agentConn.Close()
+	}
+}
+
+func sshPort(input DatabaseConnection) int {
+	if input.SSHPort == 0 {
+		return 22
+	}
+
+	return input.SSHPort
+}
+
+// tunnelFingerprint changes whenever a setting that affects the tunnel does
+func tunnelFingerprint(input DatabaseConnection) string {
+	return fmt.Sprintf("%s@%s:%d|%s|%s|%t|%s|%s:%d",
+		input.SSHUser, input.SSHHost, sshPort(input), input.SSHKeyPath, input.SSHKeyPassphrase,
+		input.SSHUseAgent, input.SSHKnownHostsPath, input.Host, input.Port)
+}
+
+// validateSSHOptions checks the jump host settings without connecting
+func validateSSHOptions(input DatabaseConnection) error {
+	if !input.SSHEnabled {
+		return nil
+	}
+
+	if input.SSHHost == "" {
+		return fmt.Errorf("SSH host is required when the SSH tunnel is enabled")
+	}
+
+	if input.SSHUser == "" {
+		return fmt.Errorf("SSH user is required when the SSH tunnel is enabled")
+	}
+
+	if input.SSHKeyPath == "" && !input.SSHUseAgent {
+		return fmt.Errorf("an SSH key file or the SSH agent is required")
+	}
+
+	if input.SSHUseAgent && !sshAgentSupported {
+		return fmt.Errorf("the SSH agent is not supported on %s, use an SSH key file instead", rntm.GOOS)
+	}
+
+	if input.SSHPort < 0 || input.SSHPort > 65535 {
+		return fmt.Errorf("invalid SSH port %d", input.SSHPort)
+	}
+
+	return nil
+}
+
+// sshClientConfig builds the client configuration for the jump host. When
+// the SSH agent is used, its connection is returned as well and belongs to
+// the caller, since reconnects keep asking it for signers
+func sshClientConfig(input DatabaseConnection) (*ssh.ClientConfig, net.Conn, error) {
+	err := validateSSHOptions(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var methods []ssh.AuthMethod
+	var agentConn net.Conn
+
+	if input.SSHKeyPath != "" {
+		pem, err := os.ReadFile(input.SSHKeyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+
+		var signer ssh.Signer
+		if input.SSHKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(input.SSHKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pem)
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse SSH key: %w", err)
+		}
+
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	knownHostsPath := input.SSHKnownHostsPath
+	if knownHostsPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to locate known_hosts: %w", err)
+		}
+
+		knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	hostKeyCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+
+	if input.SSHUseAgent {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, fmt.Errorf("SSH agent requested but SSH_AUTH_SOCK is not set")
+		}
+
+		agentConn, err = net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+		}
+
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	}
+
+	return &ssh.ClientConfig{
+		User:            input.SSHUser,
+		Auth:            methods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}, agentConn, nil
+}
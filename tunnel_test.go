@@ -0,0 +1,466 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startTestSSHServer runs a minimal sshd stand-in that accepts the given
+// client key and honours direct-tcpip forwarding requests
+func startTestSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) net.Listener {
+	t.Helper()
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "tunnel" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, channels, requests, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(requests)
+
+				for newChannel := range channels {
+					if newChannel.ChannelType() != "direct-tcpip" {
+						newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+
+					var payload struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					ssh.Unmarshal(newChannel.ExtraData(), &payload)
+
+					target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+					if err != nil {
+						newChannel.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+
+					channel, channelRequests, err := newChannel.Accept()
+					if err != nil {
+						target.Close()
+						continue
+					}
+					go ssh.DiscardRequests(channelRequests)
+
+					go func() {
+						io.Copy(target, channel)
+						target.Close()
+					}()
+					go func() {
+						io.Copy(channel, target)
+						channel.Close()
+					}()
+				}
+			}()
+		}
+	}()
+
+	return listener
+}
+
+func TestSSHTunnelForwardsAndReconnects(t *testing.T) {
+	dir := t.TempDir()
+
+	_, hostPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, clientPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	clientSigner, err := ssh.NewSignerFromKey(clientPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(clientPrivate, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The "database" echoes back whatever it receives
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	sshd := startTestSSHServer(t, hostSigner, clientSigner.PublicKey())
+	defer sshd.Close()
+
+	sshdHost, sshdPort, _ := net.SplitHostPort(sshd.Addr().String())
+	port, _ := strconv.Atoi(sshdPort)
+
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(sshd.Addr().String())}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHostsPath, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	echoHost, echoPort, _ := net.SplitHostPort(echo.Addr().String())
+	dbPort, _ := strconv.Atoi(echoPort)
+
+	input := DatabaseConnection{
+		Host:              echoHost,
+		Port:              dbPort,
+		SSHEnabled:        true,
+		SSHHost:           sshdHost,
+		SSHPort:           port,
+		SSHUser:           "tunnel",
+		SSHKeyPath:        keyPath,
+		SSHKnownHostsPath: knownHostsPath,
+	}
+
+	tunnels := newTunnelManager()
+	defer tunnels.CloseAll()
+
+	addr, err := tunnels.LocalAddr(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundTrip := func() {
+		t.Helper()
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+
+		reply := make([]byte, 4)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			t.Fatal(err)
+		}
+
+		if string(reply) != "ping" {
+			t.Fatalf("expected echo of ping, got %q", reply)
+		}
+	}
+
+	roundTrip()
+
+	// Kill the SSH connection behind the tunnel's back; the next forwarded
+	// connection must transparently reconnect on the same local port
+	tunnel := tunnels.tunnels[profileKey(input)]
+	tunnel.mu.Lock()
+	tunnel.client.Close()
+	tunnel.mu.Unlock()
+
+	roundTrip()
+
+	again, err := tunnels.LocalAddr(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again != addr {
+		t.Fatalf("expected tunnel to be reused at %s, got %s", addr, again)
+	}
+}
+
+func TestSSHTunnelRejectsUnknownHost(t *testing.T) {
+	dir := t.TempDir()
+
+	_, hostPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostPrivate)
+
+	_, clientPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	clientSigner, _ := ssh.NewSignerFromKey(clientPrivate)
+	block, _ := ssh.MarshalPrivateKey(clientPrivate, "")
+
+	keyPath := filepath.Join(dir, "id_ed25519")
+	os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600)
+
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	os.WriteFile(knownHostsPath, nil, 0o600)
+
+	sshd := startTestSSHServer(t, hostSigner, clientSigner.PublicKey())
+	defer sshd.Close()
+
+	sshdHost, sshdPort, _ := net.SplitHostPort(sshd.Addr().String())
+	port, _ := strconv.Atoi(sshdPort)
+
+	tunnels := newTunnelManager()
+	defer tunnels.CloseAll()
+
+	_, err := tunnels.LocalAddr(DatabaseConnection{
+		Host:              "127.0.0.1",
+		Port:              3306,
+		SSHEnabled:        true,
+		SSHHost:           sshdHost,
+		SSHPort:           port,
+		SSHUser:           "tunnel",
+		SSHKeyPath:        keyPath,
+		SSHKnownHostsPath: knownHostsPath,
+	})
+
+	if err == nil {
+		t.Fatal("expected host key verification to fail for a host missing from known_hosts")
+	}
+}
+
+func TestSSHTunnelClosesAgentConnectionWhenDialFails(t *testing.T) {
+	dir := t.TempDir()
+
+	_, hostPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, _ := ssh.NewSignerFromKey(hostPrivate)
+
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	os.WriteFile(knownHostsPath, nil, 0o600)
+
+	sshd := startTestSSHServer(t, hostSigner, hostSigner.PublicKey())
+	defer sshd.Close()
+
+	// Unix socket paths are short, so the agent can't live in t.TempDir()
+	socketDir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(socketDir)
+
+	agentListener, err := net.Listen("unix", filepath.Join(socketDir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agentListener.Close()
+
+	t.Setenv("SSH_AUTH_SOCK", agentListener.Addr().String())
+
+	sshdHost, sshdPort, _ := net.SplitHostPort(sshd.Addr().String())
+	port, _ := strconv.Atoi(sshdPort)
+
+	tunnels := newTunnelManager()
+	defer tunnels.CloseAll()
+
+	_, err = tunnels.LocalAddr(DatabaseConnection{
+		Host:              "127.0.0.1",
+		Port:              3306,
+		SSHEnabled:        true,
+		SSHHost:           sshdHost,
+		SSHPort:           port,
+		SSHUser:           "tunnel",
+		SSHUseAgent:       true,
+		SSHKnownHostsPath: knownHostsPath,
+	})
+
+	if err == nil {
+		t.Fatal("expected host key verification to fail")
+	}
+
+	conn, err := agentListener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the agent connection to be closed, got %v", err)
+	}
+}
+
+func TestTunnelManagerDialsWithoutHoldingTheLock(t *testing.T) {
+	dir := t.TempDir()
+
+	_, clientPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	block, _ := ssh.MarshalPrivateKey(clientPrivate, "")
+
+	keyPath := filepath.Join(dir, "id_ed25519")
+	os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600)
+
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	os.WriteFile(knownHostsPath, nil, 0o600)
+
+	// A jump host that accepts connections and never answers
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := silent.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	silentHost, silentPort, _ := net.SplitHostPort(silent.Addr().String())
+	port, _ := strconv.Atoi(silentPort)
+
+	tunnels := newTunnelManager()
+
+	failed := make(chan error, 1)
+	go func() {
+		_, err := tunnels.LocalAddr(DatabaseConnection{
+			Host:              "127.0.0.1",
+			Port:              3306,
+			SSHEnabled:        true,
+			SSHHost:           silentHost,
+			SSHPort:           port,
+			SSHUser:           "tunnel",
+			SSHKeyPath:        keyPath,
+			SSHKnownHostsPath: knownHostsPath,
+		})
+		failed <- err
+	}()
+
+	var conn net.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tunnel never dialed the jump host")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		tunnels.CloseAll()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("expected other profiles not to wait for a pending SSH dial")
+	}
+
+	conn.Close()
+
+	if err := <-failed; err == nil {
+		t.Error("expected the dial to a silent jump host to fail")
+	}
+
+	if len(tunnels.tunnels) != 0 {
+		t.Errorf("expected no tunnel to be kept, got %d", len(tunnels.tunnels))
+	}
+}
+
+func TestSSHTunnelClosesWhileReconnecting(t *testing.T) {
+	// A jump host that accepts connections and never answers
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := silent.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	tunnel := &sshTunnel{
+		jumpAddr: silent.Addr().String(),
+		config:   &ssh.ClientConfig{User: "tunnel", HostKeyCallback: ssh.InsecureIgnoreHostKey(), Timeout: sshDialTimeout},
+	}
+
+	failed := make(chan error, 1)
+	go func() {
+		_, err := tunnel.sshClient()
+		failed <- err
+	}()
+
+	var conn net.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tunnel never dialed the jump host")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		tunnel.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("expected closing the tunnel not to wait for a pending SSH dial")
+	}
+
+	conn.Close()
+
+	if err := <-failed; err == nil {
+		t.Error("expected the dial to a silent jump host to fail")
+	}
+}
+
+func TestValidateSSHOptionsRejectsUnsupportedAgent(t *testing.T) {
+	input := DatabaseConnection{SSHEnabled: true, SSHHost: "jump", SSHUser: "tunnel", SSHUseAgent: true}
+
+	if err := validateSSHOptions(input); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := sshAgentSupported
+	sshAgentSupported = false
+	t.Cleanup(func() { sshAgentSupported = previous })
+
+	if err := validateSSHOptions(input); err == nil || !strings.Contains(err.Error(), "SSH key file instead") {
+		t.Errorf("expected the agent to be rejected, got %v", err)
+	}
+}